@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/cmap"
+)
+
+// The Mutexes and Stateful Goroutines examples solve the same problem, guarding a shared map, with two
+// different tools and finish by printing operation counts. This program puts the choice on a firmer footing:
+// it runs the same read/write workload against a sharded cmap.Map with each synchronization strategy and
+// reports throughput and latency percentiles side by side.
+
+// Each Goroutine keeps at most this many latency samples, picked at random from all of its operations, so
+// memory stays flat however long the run is.
+const maxSamples = 10000
+
+// sampler records a uniform random sample of latencies (reservoir sampling).
+type sampler struct {
+	rnd     *rand.Rand
+	seen    int
+	samples []time.Duration
+}
+
+func (s *sampler) add(d time.Duration) {
+	s.seen++
+	if len(s.samples) < maxSamples {
+		s.samples = append(s.samples, d)
+	} else if i := s.rnd.Intn(s.seen); i < maxSamples {
+		s.samples[i] = d
+	}
+}
+
+// result is what one strategy achieved.
+type result struct {
+	strategy       cmap.Strategy
+	reads, writes  uint64
+	elapsed        time.Duration
+	readLatencies  []time.Duration
+	writeLatencies []time.Duration
+}
+
+func run(strategy cmap.Strategy, shards, keys, readers, writers int, duration time.Duration) result {
+	m := cmap.New[int, int](cmap.IntHash[int], cmap.WithShards(shards), cmap.WithStrategy(strategy))
+	defer m.Close()
+
+	var readOps, writeOps uint64
+	var mu sync.Mutex
+	res := result{strategy: strategy}
+
+	// Every worker runs until stop is closed, then merges its samples into the result.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	worker := func(seed int64, write bool) {
+		defer wg.Done()
+		rnd := rand.New(rand.NewSource(seed))
+		s := &sampler{rnd: rnd}
+		for {
+			select {
+			case <-stop:
+				mu.Lock()
+				if write {
+					res.writeLatencies = append(res.writeLatencies, s.samples...)
+				} else {
+					res.readLatencies = append(res.readLatencies, s.samples...)
+				}
+				mu.Unlock()
+				return
+			default:
+			}
+
+			key := rnd.Intn(keys)
+			start := time.Now()
+			if write {
+				m.Store(key, rnd.Intn(100))
+				s.add(time.Since(start))
+				atomic.AddUint64(&writeOps, 1)
+			} else {
+				m.Load(key)
+				s.add(time.Since(start))
+				atomic.AddUint64(&readOps, 1)
+			}
+		}
+	}
+
+	start := time.Now()
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go worker(int64(r), false)
+	}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go worker(int64(readers+w), true)
+	}
+	time.Sleep(duration)
+	close(stop)
+	wg.Wait()
+
+	res.elapsed = time.Since(start)
+	res.reads = atomic.LoadUint64(&readOps)
+	res.writes = atomic.LoadUint64(&writeOps)
+	return res
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p/100*float64(len(sorted)-1))]
+}
+
+func main() {
+	duration := flag.Duration("duration", time.Second, "how long to run each strategy")
+	shards := flag.Int("shards", 32, "number of shards in the map")
+	keys := flag.Int("keys", 1000, "number of distinct keys")
+	readers := flag.Int("readers", 100, "number of reading Goroutines")
+	writers := flag.Int("writers", 10, "number of writing Goroutines")
+	only := flag.String("strategy", "", "run only this strategy (mutex, rwmutex or channel)")
+	flag.Parse()
+
+	strategies := cmap.Strategies
+	if *only != "" {
+		s, err := cmap.ParseStrategy(*only)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		strategies = []cmap.Strategy{s}
+	}
+
+	fmt.Printf("%d readers, %d writers, %d keys, %d shards, %v per strategy\n\n",
+		*readers, *writers, *keys, *shards, *duration)
+
+	// tabwriter lines up the columns of the report.
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "strategy\treads/s\twrites/s\tread p50\tread p99\twrite p50\twrite p99\t")
+	for _, s := range strategies {
+		res := run(s, *shards, *keys, *readers, *writers, *duration)
+		sort.Slice(res.readLatencies, func(i, j int) bool { return res.readLatencies[i] < res.readLatencies[j] })
+		sort.Slice(res.writeLatencies, func(i, j int) bool { return res.writeLatencies[i] < res.writeLatencies[j] })
+		secs := res.elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%v\t%v\t%v\t%v\t\n", s,
+			float64(res.reads)/secs, float64(res.writes)/secs,
+			percentile(res.readLatencies, 50), percentile(res.readLatencies, 99),
+			percentile(res.writeLatencies, 50), percentile(res.writeLatencies, 99))
+	}
+	tw.Flush()
+
+	// > go run sharded-map.go -duration 2s -readers 8 -writers 8
+	// With many readers the RWMutex lets reads proceed side by side, while the channel strategy pays for a
+	// Goroutine hand-off on every operation. Try fewer shards or keys to see how contention changes things.
+}
@@ -37,6 +37,9 @@ func main() {
 	reads := make(chan ReadOp)
 	writes := make(chan WriteOp)
 
+	// Closing the stop channel tells every Goroutine below to return, so none of them outlive the example.
+	stop := make(chan struct{})
+
 	// Here is the Goroutine that owns the state, which is a map as in the Mutex example, but now private to the
 	// stateful Goroutine. This Goroutine repeatedly selects on  the reads and writes channels, responding to
 	// requests as they arrive. A response is executed by first performing the requested operation and then
@@ -51,6 +54,8 @@ func main() {
 			case write := <-writes:
 				state[write.key] = write.val
 				write.resp <- true
+			case <-stop:
+				return
 			}
 		}
 	}()
@@ -64,7 +69,11 @@ func main() {
 				read := ReadOp{
 					key:  rand.Intn(5),
 					resp: make(chan int)}
-				reads <- read
+				select {
+				case reads <- read:
+				case <-stop:
+					return
+				}
 				<-read.resp
 				atomic.AddUint64(&readOps, 1)
 				time.Sleep(time.Millisecond)
@@ -80,7 +89,11 @@ func main() {
 					key:  rand.Intn(5),
 					val:  rand.Intn(100),
 					resp: make(chan bool)}
-				writes <- write
+				select {
+				case writes <- write:
+				case <-stop:
+					return
+				}
 				<-write.resp
 				atomic.AddUint64(&writeOps, 1)
 				time.Sleep(time.Millisecond)
@@ -88,8 +101,9 @@ func main() {
 		}()
 	}
 
-	// Let the Goroutines work for a second
+	// Let the Goroutines work for a second, then stop them
 	time.Sleep(time.Second)
+	close(stop)
 
 	// Capture and report the operation counts
 	readOpsFinal := atomic.LoadUint64(&readOps)
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/keithwegner/go-by-example/pkg/jsonpath"
+)
+
+// The JSON example reaches into decoded data with type assertions such as dat["strs"].([]interface{}), which
+// panic the moment the data has a different shape. A JSONPath query describes the values to pull out instead,
+// and simply finds nothing where the data doesn't fit. This command is a small jq: it runs a query over each
+// JSON document in its input and prints what it finds.
+
+// printer writes query results in one of the output formats.
+type printer struct {
+	w      *bufio.Writer
+	format string
+	n      int
+}
+
+func (p *printer) print(v interface{}) error {
+	switch p.format {
+	case "json":
+		// One indented array holds the results from every document.
+		sep := ",\n  "
+		if p.n == 0 {
+			sep = "[\n  "
+		}
+		b, err := json.MarshalIndent(v, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		p.w.WriteString(sep)
+		p.w.Write(b)
+	case "raw":
+		// Strings are printed as they are, without quotes or escapes, which suits shell pipelines.
+		if s, ok := v.(string); ok {
+			p.w.WriteString(s + "\n")
+			break
+		}
+		fallthrough
+	case "ndjson":
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		p.w.Write(b)
+		p.w.WriteByte('\n')
+	}
+	p.n++
+	return nil
+}
+
+func (p *printer) close() error {
+	if p.format == "json" && p.n == 0 {
+		p.w.WriteString("[]\n")
+	} else if p.format == "json" {
+		p.w.WriteString("\n]\n")
+	}
+	return p.w.Flush()
+}
+
+// query runs path over every JSON value in r, which may be one document, several concatenated or NDJSON.
+func query(path *jsonpath.Path, r io.Reader, p *printer) error {
+	dec := json.NewDecoder(r)
+	// json.Number keeps large integers exact, and filters still compare them as numbers.
+	dec.UseNumber()
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("at offset %d: %w", dec.InputOffset(), err)
+		}
+		results, err := path.Eval(doc)
+		if err != nil {
+			return err
+		}
+		for _, v := range results {
+			if err := p.print(v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func main() {
+	format := flag.String("o", "json", "output format: json (one array), ndjson or raw (strings unquoted)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: jq [-o json|ndjson|raw] PATH [FILE...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "json" && *format != "ndjson" && *format != "raw" {
+		log.Fatalf("unknown output format %q", *format)
+	}
+
+	// A syntax error says where in the expression the problem is, so point at it.
+	path, err := jsonpath.Compile(flag.Arg(0))
+	var serr *jsonpath.SyntaxError
+	if errors.As(err, &serr) {
+		log.Fatalf("%s\n%s\n%s^", serr.Msg, serr.Expr, strings.Repeat(" ", serr.Offset))
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	p := &printer{w: bufio.NewWriter(os.Stdout), format: *format}
+	defer p.close()
+	files := flag.Args()[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		in := io.Reader(os.Stdin)
+		if name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				p.close()
+				log.Fatal(err)
+			}
+			defer f.Close()
+			in = f
+		}
+		if err := query(path, in, p); err != nil {
+			p.close()
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	// Query a document, or each line of NDJSON, and choose how the results are printed.
+	// > echo '{"items":[{"name":"fig","qty":3,"price":0.5},{"name":"kiwi","qty":1,"price":0.25}]}' > shop.json
+	// > go run jq.go '$.items[*].name' shop.json
+	// > go run jq.go -o raw '$.items[?(@.qty > 2)].name' shop.json
+	// > go run jq.go -o ndjson '$..price' shop.json
+	// > go run jq.go '$.items[?(@.qty > )]' shop.json
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/keithwegner/go-by-example/pkg/jsonpatch"
+	"github.com/keithwegner/go-by-example/pkg/jsonpath"
+	"github.com/keithwegner/go-by-example/pkg/jsonschema"
+	"github.com/keithwegner/go-by-example/pkg/jsonstream"
 )
 
 // Go offers built-in support for JSON encoding and decoding, including to and from built-in custom data types
@@ -86,6 +93,13 @@ func main() {
 	string1 := strings[0].(string)
 	fmt.Println("string1=", string1)
 
+	// Each of those conversions panics if the data isn't shaped the way we expect. A jsonpath query looks the
+	// value up instead, and finds nothing rather than panicking when the data doesn't fit.
+	found, _ := jsonpath.Query("$.strs[0]", dat)
+	fmt.Println("found=", found)
+	missing, _ := jsonpath.Query("$.strs[0].name", dat)
+	fmt.Println("missing=", missing)
+
 	// We can also decode it into custom data types, such as response2 above.
 	// This has the advantages of adding additional type-safety to our program and eliminating the need for type
 	// for type assertions when accessing the decoded data.
@@ -95,6 +109,20 @@ func main() {
 	fmt.Println("res  =", res)
 	fmt.Println(res.Fruits[0])
 
+	// json.Unmarshal is forgiving, though: it ignores keys it doesn't know and leaves missing fields at their zero
+	// values, so a document with a misspelled key decodes without error. The jsonschema package builds a JSON
+	// Schema from the struct tags, which lets response2 describe the documents it accepts...
+	schema := jsonschema.Reflect(response2{})
+	schemaB, _ := json.MarshalIndent(schema, "", "  ")
+	fmt.Println(string(schemaB))
+
+	// ...and validating a document against it before decoding reports every problem, with a JSON Pointer to
+	// each bad value.
+	bad := `{"page": "one", "fruit": ["apple"]}`
+	if err := schema.ValidateJSON([]byte(bad)); err != nil {
+		fmt.Println(err)
+	}
+
 	// In the example above, we always used bytes and strings as intermediates between the data and JSON
 	// representation on standard out. We can also stream JSON encodings directory to os.Writers such as
 	// os.Stdout or even HTTP response bodies
@@ -103,6 +131,19 @@ func main() {
 	d := map[string]int{"apple": 5, "lettuce": 7}
 	enc.Encode(d)
 
+	// Streaming works for decoding too. A jsonstream Reader reads a huge array one element at a time, so only
+	// the element in hand is ever in memory.
+	r := jsonstream.NewReader[map[string]int](bytes.NewBufferString(`[{"apple": 5}, {"lettuce": 7}]`))
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		fmt.Println("rec  =", rec)
+	}
+
 	// We can use maps to encode unstructured data. The keys must be strings, the values can be any serializable data.
 	birds := map[string]interface{}{
 		"sounds": map[string]string{
@@ -114,6 +155,19 @@ func main() {
 	data, _ := json.Marshal(birds)
 	fmt.Println("Birds=", string(data))
 
+	// Documents like these often serve as configuration, and changing one field shouldn't mean resending all of
+	// them. jsonpatch.Diff computes just the changes from one version to the next...
+	var before, after interface{}
+	json.Unmarshal([]byte(`{"page": 1, "fruits": ["apple", "peach"]}`), &before)
+	json.Unmarshal([]byte(`{"page": 2, "fruits": ["apple", "pear"]}`), &after)
+	patch := jsonpatch.Diff(before, after)
+	patchB, _ := json.Marshal(patch)
+	fmt.Println("patch=", string(patchB))
+
+	// ...and jsonpatch.Apply makes them to the old version, giving the new one.
+	patched, _ := jsonpatch.Apply(before, patch)
+	fmt.Println(jsonpatch.Equal(patched, after))
+
 	// It is preferred to use structs when the data can be modeled.
 
 	// Check out the JSON and Go blog post for more...
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/keithwegner/go-by-example/pkg/jsonpatch"
+)
+
+// Sending a whole configuration document to change one field is wasteful and hides what changed. This command
+// compares two JSON documents and prints the difference, either for people to read or as a JSON Patch or
+// merge patch that a program can apply. With -apply it applies such a patch instead.
+
+// ANSI escape codes for the human-readable diff.
+const (
+	red   = "\x1b[31m"
+	green = "\x1b[32m"
+	reset = "\x1b[0m"
+)
+
+func readJSON(name string) (interface{}, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// json.Number keeps numbers exactly as written, so 10 doesn't come back out as 1e+01.
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%s: invalid data after the document at offset %d", name, dec.InputOffset())
+	}
+	return v, nil
+}
+
+// useColor decides whether to color the output: always, never, or when it goes to a terminal and NO_COLOR
+// isn't set.
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// printDiff writes one line for each value the patch removes, in red, and for each it adds, in green. It
+// applies the operations to doc one at a time, in place, to know the old value behind each path, since a path
+// refers to the document as the operations before it left it. doc is used up in the process.
+func printDiff(w io.Writer, doc interface{}, patch jsonpatch.Patch, color bool) error {
+	line := func(c, sign, path string, v interface{}) {
+		b, _ := json.Marshal(v)
+		if color {
+			fmt.Fprintf(w, "%s%s %s: %s%s\n", c, sign, path, b, reset)
+		} else {
+			fmt.Fprintf(w, "%s %s: %s\n", sign, path, b)
+		}
+	}
+	for _, op := range patch {
+		if op.Op == "remove" || op.Op == "replace" {
+			old, err := jsonpatch.Get(doc, op.Path)
+			if err != nil {
+				return err
+			}
+			line(red, "-", op.Path, old)
+		}
+		if op.Op == "add" || op.Op == "replace" {
+			line(green, "+", op.Path, op.Value)
+		}
+		var err error
+		if doc, err = jsonpatch.ApplyOp(doc, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	output := flag.String("o", "diff", "output: diff (for people), patch (RFC 6902) or merge (RFC 7396)")
+	color := flag.String("color", "auto", "color the diff: auto, always or never")
+	apply := flag.String("apply", "", "apply this patch file to DOC instead: a JSON array is a JSON Patch, anything else a merge patch")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: jsondiff [-o diff|patch|merge] OLD NEW\n       jsondiff -apply PATCH DOC")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	if *color != "auto" && *color != "always" && *color != "never" {
+		log.Fatalf("unknown color mode %q", *color)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	// log.Fatal skips deferred calls, so anything already buffered, such as the first lines of a diff, is
+	// written out first.
+	fatal := func(err error) {
+		w.Flush()
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if *apply != "" {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		doc, err := readJSON(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		patch, err := readJSON(*apply)
+		if err != nil {
+			fatal(err)
+		}
+		// A JSON Patch is all or nothing: if a test operation fails, or any other, the document is unchanged.
+		if ops, ok := patch.([]interface{}); ok {
+			var p jsonpatch.Patch
+			b, _ := json.Marshal(ops)
+			if err := json.Unmarshal(b, &p); err != nil {
+				fatal(err)
+			}
+			if doc, err = jsonpatch.Apply(doc, p); err != nil {
+				fatal(err)
+			}
+		} else {
+			doc = jsonpatch.MergePatch(doc, patch)
+		}
+		enc.Encode(doc)
+		return
+	}
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	a, err := readJSON(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	b, err := readJSON(flag.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+	switch *output {
+	case "diff":
+		if err := printDiff(w, a, jsonpatch.Diff(a, b), useColor(*color)); err != nil {
+			fatal(err)
+		}
+	case "patch":
+		patch := jsonpatch.Diff(a, b)
+		if patch == nil {
+			patch = jsonpatch.Patch{}
+		}
+		enc.Encode(patch)
+	case "merge":
+		enc.Encode(jsonpatch.CreateMergePatch(a, b))
+	default:
+		fatal(fmt.Errorf("unknown output %q", *output))
+	}
+
+	// Compare two configurations shaped like response2 from the JSON example, then ship and apply the change.
+	// > echo '{"page": 1, "fruits": ["apple", "peach", "pear"]}' > old.json
+	// > echo '{"page": 2, "fruits": ["apple", "pear", "plum"]}' > new.json
+	// > go run jsondiff.go old.json new.json
+	// > go run jsondiff.go -o patch old.json new.json > patch.json
+	// > go run jsondiff.go -apply patch.json old.json
+	// > go run jsondiff.go -o merge old.json new.json
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/keithwegner/go-by-example/pkg/jsonstream"
+)
+
+// The JSON example decodes whole documents at once, which is fine for small values but not for a
+// multi-gigabyte export. This command converts a JSON array to NDJSON (one value per line) or back, reading
+// and writing one record at a time, so it runs in the same memory however large the input is.
+func main() {
+	from := flag.String("from", "auto", "input format: auto, array or ndjson")
+	to := flag.String("to", "", "output format: array or ndjson (default: the other one)")
+	skipBad := flag.Bool("skip-bad", false, "report records that aren't valid JSON and carry on, where possible")
+	flag.Parse()
+	log.SetFlags(0)
+
+	inFormat, err := jsonstream.ParseFormat(*from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// Each record is kept as a json.RawMessage: it is checked to be valid JSON but never decoded into maps
+	// and slices, which would only be encoded again.
+	r := jsonstream.NewReader[json.RawMessage](in, jsonstream.WithFormat(inFormat))
+
+	// The output format can default to the opposite of the input's only once the first record shows what the
+	// input is, so the writer is created then.
+	var w *jsonstream.Writer[json.RawMessage]
+	newWriter := func() *jsonstream.Writer[json.RawMessage] {
+		outFormat := jsonstream.NDJSON
+		if *to != "" {
+			if outFormat, err = jsonstream.ParseFormat(*to); err != nil {
+				log.Fatal(err)
+			}
+		} else if r.Format() == jsonstream.NDJSON {
+			outFormat = jsonstream.Array
+		}
+		return jsonstream.NewWriter[json.RawMessage](os.Stdout, outFormat)
+	}
+	n, bad := 0, 0
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if w == nil {
+			w = newWriter()
+		}
+		if err != nil && *skipBad && r.Err() == nil {
+			log.Println(err)
+			bad++
+			continue
+		} else if err != nil {
+			// Closing would end an array as if the input had been read whole; the records converted so far are
+			// written out, but an array is left unterminated so nothing reading it mistakes it for complete.
+			w.Flush()
+			log.Fatal(err)
+		}
+		if err := w.Write(rec); err != nil {
+			log.Fatal(err)
+		}
+		n++
+	}
+	if w == nil {
+		w = newWriter()
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d records converted, %d skipped\n", n, bad)
+
+	// Convert an array to NDJSON and back again. Offsets in errors count bytes from the start of the input.
+	// > echo '[{"name":"fig","qty":3}, {"name":"kiwi","qty":1}]' | go run ndjson.go
+	// > echo '[{"name":"fig","qty":3}, {"name":"kiwi","qty":1}]' | go run ndjson.go | go run ndjson.go
+	// > printf '{"name":"fig"}\n{"name":}\n{"name":"kiwi"}\n' | go run ndjson.go -skip-bad
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
+
+	"github.com/keithwegner/go-by-example/pkg/xmljson"
+	"github.com/keithwegner/go-by-example/pkg/xmlstream"
 )
 
 // Go offers built in support for XML and XML-like formats with the encoding.xml package.
@@ -15,7 +21,7 @@ type Plant struct {
 	XMLName xml.Name `xml:"plant"`
 	Id      int      `xml:"id,attr"`
 	Name    string   `xml:"name"`
-	Origin  []string `name:"origin"`
+	Origin  []string `xml:"origin"`
 }
 
 func (p Plant) String() string {
@@ -56,4 +62,29 @@ func main() {
 	nesting.Plants = []*Plant{coffee, tomato}
 	out, _ = xml.MarshalIndent(nesting, " ", " ")
 	fmt.Println(string(out))
+	fmt.Println()
+
+	// Unmarshal needs the whole document in memory and a struct for every level of it. A feed of millions of
+	// plants is better read with xml.Decoder.Token, which returns the document one token at a time; the
+	// xmlstream package uses it to find each <plant>, however deeply nested, and decode just that element.
+	r := xmlstream.NewReader(bytes.NewReader(out), "plant")
+	for {
+		var p Plant
+		if err := r.Next(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		fmt.Println(p)
+	}
+	fmt.Println()
+
+	// When there is no struct for a document at all, the xmljson package converts it to JSON: attributes become
+	// "@" members, and repeated elements arrays. The xmljson command converts files both ways.
+	v, err := xmljson.ToJSON(bytes.NewReader(out))
+	if err != nil {
+		panic(err)
+	}
+	js, _ := json.Marshal(v)
+	fmt.Println(string(js))
 }
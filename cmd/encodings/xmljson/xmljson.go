@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/keithwegner/go-by-example/pkg/xmljson"
+	"github.com/keithwegner/go-by-example/pkg/xmlstream"
+)
+
+// The XML example maps documents onto structs declared for them. This command converts any XML document to
+// JSON, to feed it to tools like the jq command, and JSON in the same shape back to XML. Attributes become
+// "@name" members, text "#text", and repeated child elements arrays; -order keeps everything else, such as
+// the order of mixed content and comments, so the conversion back gives the same document.
+//
+// With -each, it instead pulls every element with the given name out of the document one at a time and writes
+// each as a line of NDJSON, so a feed of any size converts in the memory of one element.
+func main() {
+	to := flag.String("to", "", "output format: json or xml (default: the other one)")
+	each := flag.String("each", "", "write each element with this name as a line of NDJSON")
+	order := flag.Bool("order", false, "keep the order of content, comments and processing instructions")
+	local := flag.Bool("local", false, "drop namespace prefixes and declarations")
+	arrays := flag.String("arrays", "", "comma-separated names of elements that are always arrays")
+	attr := flag.String("attr", "@", "prefix of attribute members")
+	text := flag.String("text", "#text", "member that holds text")
+	indent := flag.String("indent", "  ", "indentation of the output")
+	flag.Parse()
+	log.SetFlags(0)
+
+	opts := []xmljson.Option{xmljson.WithAttrPrefix(*attr), xmljson.WithTextKey(*text), xmljson.WithIndent(*indent)}
+	if *order {
+		opts = append(opts, xmljson.WithOrder())
+	}
+	if *local {
+		opts = append(opts, xmljson.WithLocalNames())
+	}
+	if *arrays != "" {
+		opts = append(opts, xmljson.WithArrays(strings.Split(*arrays, ",")...))
+	}
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	br := bufio.NewReader(in)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if *each != "" {
+		n, bad := 0, 0
+		r := xmlstream.NewReader(br, *each)
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		for {
+			e := xmljson.Element{Options: opts}
+			err := r.Next(&e)
+			if err == io.EOF {
+				break
+			}
+			var eerr *xmlstream.ElementError
+			if errors.As(err, &eerr) {
+				log.Print(err)
+				bad++
+				continue
+			} else if err != nil {
+				out.Flush()
+				log.Fatal(err)
+			}
+			enc.Encode(e)
+			n++
+		}
+		fmt.Fprintf(os.Stderr, "%d elements converted, %d skipped\n", n, bad)
+		return
+	}
+
+	// The input is XML if it starts with '<', after any white space.
+	isXML := false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			break
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			isXML = c == '<'
+			br.UnreadByte()
+			break
+		}
+	}
+	if *to == "" {
+		*to = "json"
+		if !isXML {
+			*to = "xml"
+		}
+	}
+
+	switch {
+	case *to == "json" && isXML:
+		v, err := xmljson.ToJSON(br, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", *indent)
+		enc.Encode(v)
+	case *to == "xml" && !isXML:
+		dec := json.NewDecoder(br)
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			log.Fatal(err)
+		}
+		if err := xmljson.FromJSON(out, v, opts...); err != nil {
+			log.Fatal(err)
+		}
+	case *to == "json" || *to == "xml":
+		log.Fatalf("the input is already %s", *to)
+	default:
+		log.Fatalf("unknown output format %q", *to)
+	}
+
+	// > go run xmljson.go catalog.xml
+	// > go run xmljson.go catalog.xml | go run xmljson.go
+	// > go run xmljson.go -order page.xhtml | go run xmljson.go
+	// > go run xmljson.go -each plant -arrays origin catalog.xml
+}
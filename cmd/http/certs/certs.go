@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/keithwegner/go-by-example/pkg/tlsutil"
+)
+
+// HTTPS needs a certificate that the client trusts. A public CA won't issue one for localhost, so for local
+// development we become our own CA: generate a CA certificate, sign a certificate for the server with it, and
+// tell the client to trust that CA and nothing else. The same CA signs a client certificate, which a server
+// started with -mtls requires before it answers at all.
+func main() {
+	dir := flag.String("dir", "certs", "directory to write the certificates and keys to")
+	hosts := flag.String("hosts", "localhost,127.0.0.1,::1", "comma-separated host names and IP addresses for the server certificate")
+	flag.Parse()
+
+	files, err := tlsutil.Generate(*dir, strings.Split(*hosts, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("CA certificate:    ", files.CA)
+	fmt.Println("server certificate:", files.Cert)
+	fmt.Println("client certificate:", files.ClientCert)
+
+	// Generate the certificates, then serve HTTPS and HTTP/2 with them. Running this again reissues the server
+	// and client certificates but keeps the CA, so clients that trust it don't need to change.
+	// > go run certs.go -dir /tmp/certs
+	// > go run ../server/server.go -tls /tmp/certs
+	// > curl --cacert /tmp/certs/ca.pem https://localhost:8090/hello
+	//
+	// With -mtls the server also requires the client certificate.
+	// > go run ../server/server.go -tls /tmp/certs -mtls
+	// > curl --cacert /tmp/certs/ca.pem --cert /tmp/certs/client.pem --key /tmp/certs/client-key.pem https://localhost:8090/hello
+	// > go run ../client/client.go -url https://localhost:8090/hello -tls /tmp/certs -mtls
+}
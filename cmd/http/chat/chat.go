@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/keithwegner/go-by-example/pkg/pubsub"
+	"github.com/keithwegner/go-by-example/pkg/router"
+	"github.com/keithwegner/go-by-example/pkg/websocket"
+)
+
+// Server-Sent Events only flow one way. For a chat room, where everyone both talks and listens, we'll upgrade
+// the HTTP connection to a WebSocket, which carries messages in both directions for as long as it stays open.
+// The room itself is a pub/sub broker: every connection subscribes to its room's topic and publishes what its
+// user says to it.
+
+var broker = pubsub.NewBroker[string]()
+
+// join serves GET /rooms/{room}?name=..., turning the request into a member of the room.
+func join(w http.ResponseWriter, r *http.Request) {
+	room, name := router.Param(r, "room"), r.URL.Query().Get("name")
+	// Room names become a topic word, so they can't contain the broker's separator or wildcards.
+	if strings.ContainsAny(room, ".*#") || name == "" {
+		http.Error(w, "bad room or name", http.StatusBadRequest)
+		return
+	}
+	topic := "chat." + room
+
+	// Subscribe before upgrading, so a member hears everything said from the moment their connection opens. A
+	// member who can't keep up is disconnected rather than allowed to slow the room down.
+	sub, err := broker.Subscribe(topic, pubsub.WithPolicy(pubsub.Disconnect))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	c, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	broker.Publish(topic, "* "+name+" joined")
+
+	// One goroutine writes what the room says to the member while this one reads what the member says. Writes
+	// may happen from any goroutine, but only one may read.
+	go func() {
+		for msg := range sub.C() {
+			if err := c.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
+				return
+			}
+		}
+		if sub.Stats().Disconnected {
+			c.Close(websocket.ClosePolicyViolation, "too slow")
+		}
+	}()
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			// The Conn has already answered the member's close frame, or failed the connection if the member
+			// broke the protocol. Either way they're gone.
+			break
+		}
+		broker.Publish(topic, name+": "+string(msg))
+	}
+	broker.Publish(topic, "* "+name+" left")
+}
+
+// member is a chat client: a connection and the name it joined with.
+type member struct {
+	name string
+	conn *websocket.Conn
+}
+
+func dial(url, room, name string) *member {
+	c, _, err := websocket.Dial(context.Background(), url+"/rooms/"+room+"?name="+name)
+	if err != nil {
+		panic(err)
+	}
+	return &member{name, c}
+}
+
+func (m *member) say(text string) {
+	if err := m.conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+		panic(err)
+	}
+}
+
+// hear reads the next n messages from the room and prints them.
+func (m *member) hear(n int) {
+	for i := 0; i < n; i++ {
+		_, msg, err := m.conn.ReadMessage()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%-6s <- %s\n", m.name, msg)
+	}
+}
+
+// leave closes the connection. Close waits for the server to answer our close frame, which only ReadMessage
+// can see, so we read until it arrives.
+func (m *member) leave() {
+	go m.conn.Close(websocket.CloseNormal, "bye")
+	for {
+		if _, _, err := m.conn.ReadMessage(); err != nil {
+			fmt.Printf("%-6s left: %v\n", m.name, err)
+			return
+		}
+	}
+}
+
+func main() {
+	// The chat server runs on loopback. The ws:// URL is the same address with a different scheme.
+	mux := router.New()
+	mux.Get("/rooms/{room}", join)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// Each step waits until every member has heard what was said, so the transcript comes out in the same
+	// order every time even though each member has its own connection.
+	alice := dial(url, "gophers", "alice")
+	alice.hear(1)
+	bob := dial(url, "gophers", "bob")
+	alice.hear(1)
+	bob.hear(1)
+
+	alice.say("hi bob")
+	alice.hear(1)
+	bob.hear(1)
+	bob.say("hi alice, brb")
+	alice.hear(1)
+	bob.hear(1)
+
+	bob.leave()
+	alice.hear(1)
+	alice.leave()
+
+	// > go run chat.go
+	// alice  <- * alice joined
+	// alice  <- * bob joined
+	// bob    <- * bob joined
+	// alice  <- alice: hi bob
+	// bob    <- alice: hi bob
+	// alice  <- bob: hi alice, brb
+	// bob    <- bob: hi alice, brb
+	// bob    left: websocket: close 1000
+	// alice  <- * bob left
+	// alice  left: websocket: close 1000
+}
@@ -2,24 +2,77 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/cassette"
+	"github.com/keithwegner/go-by-example/pkg/httpclient"
+	"github.com/keithwegner/go-by-example/pkg/tlsutil"
 )
 
 // The Go standard library comes with excellent support for HTTP clients and servers in the net/http package.
 // In this example, we'll use it to issue simple HTTP requests.
 func main() {
+	// Talking to a real server makes the example hard to run offline. With -cassette the requests go through
+	// a cassette.Recorder instead, which can record the exchange to a file once and replay it from then on.
+	cassettePath := flag.String("cassette", "", "cassette file to replay from or record to")
+	mode := flag.String("mode", "replay", "cassette mode: replay, record or replay-or-record")
+	url := flag.String("url", "https://gobyexample.com", "URL to get")
+	tlsDir := flag.String("tls", "", "trust only the CA that cmd/http/certs wrote to this directory")
+	mutualTLS := flag.Bool("mtls", false, "with -tls, present the client certificate from the same directory")
+	flag.Parse()
+
+	var transport http.RoundTripper = http.DefaultTransport
+	// With -tls the client pins the local CA: it trusts servers with a certificate signed by that CA and no
+	// others, not even ones the system trusts. Cloning the default transport keeps its proxy and timeout
+	// settings, and HTTP/2 is still negotiated with servers that support it.
+	if *tlsDir != "" {
+		cfg, err := tlsutil.ClientConfig(tlsutil.FilesIn(*tlsDir), *mutualTLS)
+		if err != nil {
+			panic(err)
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = cfg
+		transport = t
+	}
+	if *cassettePath != "" {
+		m, err := cassette.ParseMode(*mode)
+		if err != nil {
+			panic(err)
+		}
+		// Strict replay fails loudly on a request that was never recorded rather than quietly going online.
+		rec, err := cassette.New(*cassettePath, cassette.WithMode(m), cassette.Strict(), cassette.WithTransport(transport))
+		if err != nil {
+			panic(err)
+		}
+		transport = rec
+	}
+
 	// Issue an HTTP GET request to a server. http.Get is a convenient shortcut around creating an http.Client
 	// object and calling its Get method; it uses the http.DefaultClient object which has useful default
-	// settings.
-	response, err := http.Get("http://gobyexample.com")
+	// settings. Those defaults include no timeout at all, though, and a single failed attempt is final.
+	// httpclient.NewTransport wraps a transport so each attempt gets a timeout, transient failures are retried
+	// with backoff, and a host that keeps failing stops being called.
+	client := &http.Client{
+		Transport: httpclient.NewTransport(transport,
+			httpclient.WithTimeout(5*time.Second),
+			httpclient.WithMaxRetries(3)),
+		Timeout: 20 * time.Second,
+	}
+	response, err := client.Get(*url)
 	if err != nil {
 		panic(err)
 	}
 	defer response.Body.Close()
 
-	// Print the HTTP response status.
-	fmt.Println("Response status:", response.Status)
+	// Print the HTTP response status. A response is returned for any status, so a 404 or a 500 that survived
+	// the retries isn't an error as far as Get is concerned; check for it explicitly.
+	fmt.Println("Response status:", response.Status, response.Proto)
+	if response.StatusCode != http.StatusOK {
+		return
+	}
 
 	// Print the first 5 lines of the response body.
 	scanner := bufio.NewScanner(response.Body)
@@ -29,4 +82,15 @@ func main() {
 	if err := scanner.Err(); err != nil {
 		panic(err)
 	}
+
+	// Record a real exchange with gobyexample.com once, then replay it without a network.
+	// > go run client.go -cassette /tmp/gobyexample.json -mode record
+	// > go run client.go -cassette /tmp/gobyexample.json
+	//
+	// testdata/stub.json isn't a recording but a cassette written by hand for the made-up stub.example host,
+	// so the replay side can be tried without ever going online.
+	// > go run client.go -cassette testdata/stub.json -url https://stub.example/
+	//
+	// Or get a page from the HTTP Server example over HTTPS, trusting only the CA from cmd/http/certs.
+	// > go run client.go -url https://localhost:8090/hello -tls /tmp/certs
 }
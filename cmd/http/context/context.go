@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/lifecycle"
+	"github.com/keithwegner/go-by-example/pkg/tlsutil"
 )
 
 // In the HTTP server example, we looked at setting up a simple HTTP server. HTTP servers are useful for demonstrating
@@ -30,11 +37,31 @@ func hello(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// As before, register the handler on the "/hello" route and start serving.
+// As before, register the handler on the "/hello" route and start serving. The server itself shuts down
+// gracefully: on SIGINT or SIGTERM it waits up to -shutdown-timeout for running requests before cutting them
+// off, which cancels their contexts too.
 func main() {
+	addrs := flag.String("addr", ":8090", "comma-separated addresses to listen on")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "how long to let requests finish on shutdown")
+	tlsDir := flag.String("tls", "", "serve HTTPS with the certificates cmd/http/certs wrote to this directory")
+	mutualTLS := flag.Bool("mtls", false, "with -tls, require clients to present a certificate from the same CA")
+	flag.Parse()
+
+	opts := []lifecycle.Option{
+		lifecycle.WithAddrs(strings.Split(*addrs, ",")...),
+		lifecycle.WithShutdownTimeout(*shutdownTimeout),
+	}
+	if *tlsDir != "" {
+		cfg, err := tlsutil.ServerConfig(tlsutil.FilesIn(*tlsDir), *mutualTLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, lifecycle.WithTLS(cfg))
+	}
+
 	http.HandleFunc("/hello", hello)
-	if err := http.ListenAndServe(":8090", nil); err != nil {
-		panic(err)
+	if err := lifecycle.ListenAndServe(context.Background(), http.DefaultServeMux, opts...); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -43,3 +70,10 @@ func main() {
 // > go run context.go
 // > curl localhost:8090/hello
 // ^C
+// Hitting CTRL+C on the server instead lets the request finish before the server exits. With
+// -shutdown-timeout 2s the request is cut off, and the handler sees its context cancelled. With -tls the same
+// works over HTTPS, using certificates from cmd/http/certs.
+// > go run context.go -tls /tmp/certs
+// > curl --cacert /tmp/certs/ca.pem https://localhost:8090/hello
+// The context ends at this server, though. The deadlines example shows how to carry the deadline and the
+// cancellation on to the backends a handler calls.
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/deadline"
+	"github.com/keithwegner/go-by-example/pkg/group"
+	"github.com/keithwegner/go-by-example/pkg/router"
+)
+
+// The Context example stops a single handler when its client gives up. Real requests often pass through several
+// services, though, and a backend that keeps working after the client has gone is wasting its time. Here we'll
+// build a small chain on loopback, a gateway that calls an inventory and a pricing backend in parallel, and
+// follow a deadline and a cancellation as they travel down it.
+
+// start is when the program began; every trace line is stamped with the time since.
+var start = time.Now()
+
+// trace prints one line of the trace, tagged with the service and the request ID it is working on.
+func trace(ctx context.Context, service, format string, args ...interface{}) {
+	fmt.Printf("%6.0fms  %-9s %s  %s\n", float64(time.Since(start).Microseconds())/1000, service,
+		router.RequestIDFrom(ctx), fmt.Sprintf(format, args...))
+}
+
+// backend simulates a service that needs a number of steps of work. Between steps it checks its context, which
+// deadline.Handler has given the deadline from the X-Request-Deadline header, and stops as soon as it is done.
+func backend(name string, steps int, step time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if d, ok := ctx.Deadline(); ok {
+			trace(ctx, name, "started, %v left", time.Until(d).Round(time.Millisecond))
+		} else {
+			trace(ctx, name, "started, no deadline")
+		}
+		for i := 1; i <= steps; i++ {
+			select {
+			case <-time.After(step):
+			case <-ctx.Done():
+				trace(ctx, name, "stopped at step %d/%d: %v", i, steps, ctx.Err())
+				http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
+				return
+			}
+		}
+		trace(ctx, name, "finished %d steps", steps)
+		fmt.Fprintf(w, "%s ok", name)
+	}
+}
+
+// gateway calls every backend at once. The outgoing requests use the incoming request's context, so the client
+// going away cancels them, and deadline.Transport passes the deadline on. The group cancels the remaining calls
+// as soon as one fails, since the gateway can't answer without all of them.
+func gateway(backends map[string]string) http.HandlerFunc {
+	client := &http.Client{Transport: &deadline.Transport{Margin: 5 * time.Millisecond}}
+	return func(w http.ResponseWriter, r *http.Request) {
+		trace(r.Context(), "gateway", "started")
+		g := group.New(r.Context())
+		var mu sync.Mutex
+		var parts []string
+		for name, url := range backends {
+			name, url := name, url
+			g.Go(func(ctx context.Context) error {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				if err != nil {
+					return err
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != http.StatusOK {
+					return fmt.Errorf("%s: %s", name, resp.Status)
+				}
+				mu.Lock()
+				parts = append(parts, string(body))
+				mu.Unlock()
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			trace(r.Context(), "gateway", "failed: %v", err)
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		trace(r.Context(), "gateway", "finished")
+		sort.Strings(parts)
+		fmt.Fprintln(w, strings.Join(parts, ", "))
+	}
+}
+
+// waitIdle returns once *running has stayed at zero for quiet.
+func waitIdle(running *int64, quiet time.Duration) {
+	for idleSince := time.Now(); time.Since(idleSince) < quiet; time.Sleep(5 * time.Millisecond) {
+		if atomic.LoadInt64(running) > 0 {
+			idleSince = time.Now()
+		}
+	}
+}
+
+func main() {
+	// Every service gets a request ID and honors the deadline header. running counts the handlers at work, so
+	// a scenario can wait until all services have stopped before the next one starts printing. Neither a
+	// WaitGroup nor a fixed number of handlers to wait for will do here: a backend's handler can start after
+	// the client has given up, and a backend the gateway gives up on before calling doesn't start at all. So a
+	// scenario ends once no handler has been running for a little while.
+	var running int64
+	serve := func(h http.Handler) *httptest.Server {
+		h = router.Chain(h, router.RequestID(), deadline.Handler)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+			h.ServeHTTP(w, r)
+		}))
+	}
+
+	inventory := serve(backend("inventory", 3, 50*time.Millisecond))
+	defer inventory.Close()
+	pricing := serve(backend("pricing", 5, 100*time.Millisecond))
+	defer pricing.Close()
+	gw := serve(gateway(map[string]string{"inventory": inventory.URL, "pricing": pricing.URL}))
+	defer gw.Close()
+
+	client := &http.Client{Transport: &deadline.Transport{}}
+	scenarios := []struct {
+		name    string
+		timeout time.Duration
+		hangUp  time.Duration
+	}{
+		{"a generous deadline", time.Second, 0},
+		{"a deadline too short for pricing", 250 * time.Millisecond, 0},
+		{"a client that hangs up", 0, 120 * time.Millisecond},
+	}
+	for i, s := range scenarios {
+		start = time.Now()
+		fmt.Printf("\n--- %s\n", s.name)
+
+		// The client's own context sets the deadline, which deadline.Transport puts in the header. Hanging up
+		// is modelled by cancelling the context, which closes the connection to the gateway.
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if s.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		}
+		if s.hangUp > 0 {
+			ctx, cancel = context.WithCancel(ctx)
+			time.AfterFunc(s.hangUp, func() {
+				trace(ctx, "client", "hanging up")
+				cancel()
+			})
+		}
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gw.URL, nil)
+		req.Header.Set(router.RequestIDHeader, fmt.Sprintf("req-%d", i+1))
+		resp, err := client.Do(req)
+		if err != nil {
+			trace(ctx, "client", "error: %v", err)
+		} else {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			trace(ctx, "client", "%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		cancel()
+		waitIdle(&running, 100*time.Millisecond)
+	}
+
+	// > go run deadlines.go
+	// With the deadline too short, pricing stops at step 3 while inventory finishes. When the client hangs up,
+	// the gateway's context is cancelled, its outgoing requests are aborted, and both backends stop mid-way.
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/lifecycle"
+	"github.com/keithwegner/go-by-example/pkg/proxy"
+	"github.com/keithwegner/go-by-example/pkg/router"
+)
+
+// A reverse proxy is an HTTP server whose handler answers each request by making the same request to another
+// server. Put one in front of several copies of the HTTP Server example and it becomes a load balancer: it
+// spreads requests across them and stops sending any to a copy that stops answering its health checks.
+
+// upstreamList collects -upstream flags. Each is a URL, optionally followed by its own timeout, as in
+// "http://localhost:8091,timeout=2s".
+type upstreamList []proxy.Upstream
+
+func (l *upstreamList) String() string {
+	var urls []string
+	for _, u := range *l {
+		urls = append(urls, u.URL)
+	}
+	return strings.Join(urls, " ")
+}
+
+func (l *upstreamList) Set(s string) error {
+	rawURL, opt, hasOpt := strings.Cut(s, ",")
+	u := proxy.Upstream{URL: rawURL}
+	if hasOpt {
+		if !strings.HasPrefix(opt, "timeout=") {
+			return fmt.Errorf("unknown upstream option %q", opt)
+		}
+		d, err := time.ParseDuration(strings.TrimPrefix(opt, "timeout="))
+		if err != nil {
+			return err
+		}
+		u.Timeout = d
+	}
+	*l = append(*l, u)
+	return nil
+}
+
+var (
+	addr           = flag.String("addr", ":8080", "address to listen on")
+	balance        = flag.String("balance", "round-robin", "balancing: round-robin, least-conn or hash")
+	hashHeader     = flag.String("hash-header", "", "header to hash with -balance hash, instead of the client IP")
+	timeout        = flag.Duration("timeout", 30*time.Second, "timeout for upstreams that don't set one")
+	healthPath     = flag.String("health-path", "/healthz", "path requested by health checks")
+	healthInterval = flag.Duration("health-interval", 5*time.Second, "time between health checks")
+	upstreams      upstreamList
+)
+
+func balancer(name string) (proxy.Balancer, error) {
+	switch name {
+	case "round-robin":
+		return proxy.RoundRobin(), nil
+	case "least-conn":
+		return proxy.LeastConnections(), nil
+	case "hash":
+		if *hashHeader == "" {
+			return proxy.ConsistentHash(nil), nil
+		}
+		return proxy.ConsistentHash(func(r *http.Request) string { return r.Header.Get(*hashHeader) }), nil
+	}
+	return nil, fmt.Errorf("unknown balancer %q", name)
+}
+
+// demoBackends starts n servers on loopback for the proxy to balance across when no -upstream is given.
+func demoBackends(n int) []proxy.Upstream {
+	var list []proxy.Upstream
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("demo-%d", i)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "hello from %s, forwarded for %s\n", name, r.Header.Get("X-Forwarded-For"))
+		}))
+		log.Printf("started %s at %s", name, srv.URL)
+		list = append(list, proxy.Upstream{URL: srv.URL})
+	}
+	return list
+}
+
+func main() {
+	flag.Var(&upstreams, "upstream", "upstream URL, optionally with \",timeout=DURATION\"; repeat for each upstream")
+	flag.Parse()
+	if len(upstreams) == 0 {
+		upstreams = demoBackends(3)
+	}
+	b, err := balancer(*balance)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p, err := proxy.New(upstreams,
+		proxy.WithBalancer(b),
+		proxy.WithTimeout(*timeout),
+		proxy.WithHealthCheck(*healthPath, *healthInterval, 2*time.Second))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Health checks run in the background for as long as the proxy serves.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go p.HealthCheck(ctx)
+
+	// The Proxy is an http.Handler like any other, so the router's middleware can log what passes through it.
+	h := router.Chain(p, router.Logger(log.Default()))
+	if err := lifecycle.ListenAndServe(ctx, h, lifecycle.WithAddrs(*addr)); err != nil {
+		log.Fatal(err)
+	}
+
+	// Run the proxy with its own demo backends and send it a few requests, which go to each backend in turn.
+	// > go run proxy.go
+	// > curl localhost:8080/
+	//
+	// Or balance across copies of the HTTP Server example, which answer health checks on /healthz. Stop one
+	// and, after two failed checks, the proxy stops sending it requests; start it again and they come back.
+	// > go run ../server/server.go -addr :8091 & go run ../server/server.go -addr :8092 &
+	// > go run proxy.go -upstream http://localhost:8091 -upstream http://localhost:8092,timeout=1s -balance least-conn
+	// > curl localhost:8080/hello/gopher
+}
@@ -1,23 +1,75 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/fileserver"
+	"github.com/keithwegner/go-by-example/pkg/lifecycle"
+	"github.com/keithwegner/go-by-example/pkg/metrics"
+	"github.com/keithwegner/go-by-example/pkg/router"
+	"github.com/keithwegner/go-by-example/pkg/sse"
+	"github.com/keithwegner/go-by-example/pkg/tlsutil"
 )
 
 // Writing a basic HTTP server is easy using the net/http package.
 
+// We'll also count the requests each route serves. The metrics registry holds our counters and can serve them
+// to a Prometheus scraper.
+var (
+	registry = metrics.NewRegistry()
+	requests = registry.CounterVec("http_requests_total", "Requests served, by route.", "route")
+)
+
+// The greeting can be changed while the server runs: edit the file named by -greeting and send the process a
+// SIGHUP. An atomic.Value lets handlers read it while a reload replaces it.
+var (
+	addrs           = flag.String("addr", ":8090", "comma-separated addresses to listen on")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to let requests finish on shutdown")
+	greetingFile    = flag.String("greeting", "", "file holding the greeting, re-read on SIGHUP")
+	staticDir       = flag.String("static", "", "directory to serve under /static/")
+	listing         = flag.String("listing", "html", "how /static/ lists directories: none, html, json or auto")
+	tlsDir          = flag.String("tls", "", "serve HTTPS with the certificates cmd/http/certs wrote to this directory")
+	mutualTLS       = flag.Bool("mtls", false, "with -tls, require clients to present a certificate from the same CA")
+	greeting        atomic.Value
+)
+
+func loadGreeting() error {
+	if *greetingFile == "" {
+		greeting.Store("Hello")
+		return nil
+	}
+	b, err := os.ReadFile(*greetingFile)
+	if err != nil {
+		return err
+	}
+	greeting.Store(strings.TrimSpace(string(b)))
+	return nil
+}
+
 // A fundamental concept in net/http servers is Handlers. A handler is an object implementing the http.Handler interface.
 // A common way to write a handler is by using the http.HandlerFunc adapter on functions with the appropriate signature.
 func hello(w http.ResponseWriter, r *http.Request) {
+	requests.With("/hello").Inc()
+
 	// Functions serving as handlers take an http.ResponseWriter and an http.Request as arguments. The response writer
-	// is used to fill in the HTTP response. Here, our simple response is just "Hello\n".
-	fmt.Fprintf(w, "Hello\n")
+	// is used to fill in the HTTP response. Here, our simple response is just the greeting, "Hello\n" by default.
+	fmt.Fprintf(w, "%s\n", greeting.Load())
 }
 
 // This handler does something a little more sophisticated by reading all the HTTP request headers and echoing them
 // into the body.
 func headers(w http.ResponseWriter, r *http.Request) {
+	requests.With("/headers").Inc()
+
 	for name, headers := range r.Header {
 		for _, h := range headers {
 			fmt.Fprintf(w, "%v: %v\n", name, h)
@@ -25,19 +77,123 @@ func headers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// The default router only matches fixed paths. With pkg/router a route can capture parts of the path as
+// parameters, which the handler reads back with router.Param.
+func greet(w http.ResponseWriter, r *http.Request) {
+	requests.With("/hello/{name}").Inc()
+
+	fmt.Fprintf(w, "%s, %s\n", greeting.Load(), router.Param(r, "name"))
+}
+
+// Every handler above writes a whole response and returns. A dashboard wanting live numbers would have to keep
+// polling, so instead /events streams them with Server-Sent Events: the response stays open and the sse.Server
+// flushes an event down it each time one is published. Events only flow to the client; the chat example in
+// cmd/http/chat uses pkg/websocket for traffic in both directions.
+var events = sse.NewServer()
+
+// publishCounts sends the request count of every route as a JSON event once a second.
+func publishCounts(ctx context.Context) {
+	routes := []string{"/hello", "/hello/{name}", "/headers"}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			counts := make(map[string]uint64, len(routes))
+			for _, route := range routes {
+				counts[route] = requests.With(route).Value()
+			}
+			data, _ := json.Marshal(counts)
+			events.Publish(sse.Event{Event: "requests", Data: string(data)})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func main() {
-	// Register the handlers on server routes using the http.HandleFunc convenience function.
-	// It sets up the Default Router in the net/http package and takes a function as an argument.
-	http.HandleFunc("/hello", hello)
-	http.HandleFunc("/headers", headers)
+	flag.Parse()
+	if err := loadGreeting(); err != nil {
+		log.Fatal(err)
+	}
+
+	// The http.HandleFunc convenience function registers handlers on the Default Router in the net/http package.
+	// Here we register them on a router.Router instead, which also matches on the request method and answers
+	// other methods with 405 Method Not Allowed.
+	r := router.New()
+
+	// Middleware wraps every request: each one gets an ID, is logged, and a panicking handler becomes a 500
+	// instead of a dropped connection.
+	r.Use(router.RequestID(), router.Logger(log.Default()), router.Recoverer(log.Default()))
+
+	r.Get("/hello", hello)
+	r.Get("/hello/{name}", greet)
+	r.Get("/headers", headers)
+
+	// A load balancer such as the one in cmd/http/proxy asks every server it forwards to whether it is healthy.
+	// Answering at all is enough here.
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "ok") })
+
+	// The registry's Handler is an http.Handler too, so it is registered with Handle instead.
+	r.Handle(http.MethodGet, "/metrics", registry.Handler())
+	r.Handle(http.MethodGet, "/events", events)
+
+	// With -static, the files under a directory are served too. The wildcard matches the rest of the path, and
+	// StripPrefix removes /static so that /static/css/site.css is looked up as css/site.css under the directory.
+	if *staticDir != "" {
+		l, err := fileserver.ParseListing(*listing)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files, err := fileserver.New(*staticDir, fileserver.WithListing(l))
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.Handle(http.MethodGet, "/static/{path...}", http.StripPrefix("/static", files))
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go publishCounts(ctx)
+
+	opts := []lifecycle.Option{
+		lifecycle.WithAddrs(strings.Split(*addrs, ",")...),
+		lifecycle.WithShutdownTimeout(*shutdownTimeout),
+		lifecycle.WithReload(loadGreeting),
+		lifecycle.WithHTTPServer(func(s *http.Server) { s.RegisterOnShutdown(events.Close) }),
+	}
+	// With -tls, the server speaks HTTPS with a certificate signed by a local CA, and HTTP/2 to clients that
+	// offer it. With -mtls as well, a client without a certificate from that CA can't even complete the
+	// handshake.
+	if *tlsDir != "" {
+		cfg, err := tlsutil.ServerConfig(tlsutil.FilesIn(*tlsDir), *mutualTLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, lifecycle.WithTLS(cfg))
+	}
 
-	// Finally, call ListenAndServe with a port and a handler. nil tells it to use the default router we just set up.
-	if err := http.ListenAndServe(":8090", nil); err != nil {
-		panic(err)
+	// Finally, serve the router on the configured addresses. http.ListenAndServe would do, but Ctrl+C would then
+	// kill requests halfway through. lifecycle.ListenAndServe instead stops accepting connections on SIGINT or
+	// SIGTERM and gives in-flight requests up to -shutdown-timeout to finish. SIGHUP reloads the greeting. Event
+	// streams never finish by themselves, so they are closed as soon as shutdown begins.
+	if err := lifecycle.ListenAndServe(ctx, r, opts...); err != nil {
+		log.Fatal(err)
 	}
 
 	// Run the server in the background and access the routes
 	// > go run server.go
 	// > curl localhost:8090/hello
+	// > curl localhost:8090/hello/gopher
+	// > curl -X POST localhost:8090/hello
 	// > curl localhost:8090/headers
+	// > curl localhost:8090/metrics
+	// > curl -N localhost:8090/events
+	// > go run server.go -static ../../files -listing auto
+	// > curl -H 'Accept: application/json' localhost:8090/static/
+	// > curl -r 0-9 --compressed -i localhost:8090/static/paths/file-paths.go
+	// > echo Howdy > greeting.txt && go run server.go -greeting greeting.txt -addr :8090,:8091
+	// > kill -HUP <pid>
+	// > go run ../certs/certs.go -dir /tmp/certs && go run server.go -tls /tmp/certs
+	// > curl --cacert /tmp/certs/ca.pem https://localhost:8090/hello
 }
@@ -1,6 +1,6 @@
 module github.com/keithwegner/go-by-example
 
-go 1.17
+go 1.18
 
 require github.com/gernest/wow v0.1.0
 
@@ -0,0 +1,428 @@
+// Package cassette records HTTP exchanges to a file and plays them back, so code like the HTTP Client
+// example can be tested without a network. A Recorder is an http.RoundTripper: in Record mode it passes
+// requests to a real transport and appends each request and response to its cassette file, and in Replay
+// mode it answers requests from the file instead. Which recorded exchange answers a request is decided by
+// Matchers comparing method, URL, chosen headers or a hash of the body.
+//
+// Credentials shouldn't end up in files that get committed, so sensitive headers such as Authorization are
+// redacted before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNoMatch is returned, with a description of the request, when a strict Recorder has nothing recorded
+// for a request.
+var ErrNoMatch = errors.New("cassette: no recorded interaction matches")
+
+// Redacted replaces the values of redacted headers.
+const Redacted = "REDACTED"
+
+// Mode decides whether a Recorder talks to the network.
+type Mode int
+
+const (
+	// Replay answers requests from the cassette. Requests with no recorded match go to the real transport,
+	// or fail with ErrNoMatch if the Recorder is strict.
+	Replay Mode = iota
+	// Record sends every request to the real transport and records the exchange, replacing any cassette
+	// file from an earlier run.
+	Record
+	// ReplayOrRecord answers requests from the cassette when it can and records the rest.
+	ReplayOrRecord
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Replay:
+		return "replay"
+	case Record:
+		return "record"
+	case ReplayOrRecord:
+		return "replay-or-record"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode returns the Mode named by s, as printed by Mode.String.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{Replay, Record, ReplayOrRecord} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("cassette: unknown mode %q", s)
+}
+
+// Body is a request or response body. It is stored in the cassette as a JSON string when it is valid UTF-8,
+// which keeps text bodies readable, and as {"base64": "..."} otherwise.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(struct {
+		Base64 string `json:"base64"`
+	}{base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var enc struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc.Base64)
+	*b = raw
+	return err
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+	BodySHA256 string      `json:"body_sha256,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Interaction is one recorded exchange.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type file struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Matcher reports whether a recorded request can answer an incoming one. The incoming request has been
+// through the same redaction as recorded ones, so redacted headers compare equal.
+type Matcher func(incoming, recorded *Request) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(incoming, recorded *Request) bool {
+	return incoming.Method == recorded.Method
+}
+
+// MatchURL matches requests for the same URL, including the query string.
+func MatchURL(incoming, recorded *Request) bool {
+	return incoming.URL == recorded.URL
+}
+
+// MatchBody matches requests whose bodies have the same SHA-256 hash.
+func MatchBody(incoming, recorded *Request) bool {
+	return incoming.BodySHA256 == recorded.BodySHA256
+}
+
+// MatchHeaders returns a Matcher for requests with the same values for each of the named headers.
+func MatchHeaders(names ...string) Matcher {
+	return func(incoming, recorded *Request) bool {
+		for _, name := range names {
+			a, b := incoming.Header.Values(name), recorded.Header.Values(name)
+			if len(a) != len(b) {
+				return false
+			}
+			for i := range a {
+				if a[i] != b[i] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithMode sets the mode. The default is Replay.
+func WithMode(m Mode) Option {
+	return func(r *Recorder) {
+		r.mode = m
+	}
+}
+
+// WithTransport sets the transport real requests are sent with. The default is http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithMatchers sets the matchers a recorded request must satisfy, all of them, to answer an incoming one.
+// The default is MatchMethod and MatchURL.
+func WithMatchers(m ...Matcher) Option {
+	return func(r *Recorder) {
+		r.matchers = m
+	}
+}
+
+// WithRedactedHeaders adds headers whose values are replaced by Redacted when recorded. Authorization,
+// Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key are always redacted.
+func WithRedactedHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		for _, name := range names {
+			r.redact[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// Strict makes a Recorder in Replay mode fail requests it has no recording for with ErrNoMatch, instead of
+// sending them to the network.
+func Strict() Option {
+	return func(r *Recorder) {
+		r.strict = true
+	}
+}
+
+// Recorder is an http.RoundTripper that records and replays exchanges. It is safe for concurrent use.
+type Recorder struct {
+	path      string
+	mode      Mode
+	strict    bool
+	transport http.RoundTripper
+	matchers  []Matcher
+	redact    map[string]bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	// used counts how many times each interaction has been replayed.
+	used []int
+}
+
+// New returns a Recorder backed by the cassette file at path. In Replay mode the file must exist, and in
+// ReplayOrRecord mode it is loaded if it does.
+func New(path string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		transport: http.DefaultTransport,
+		matchers:  []Matcher{MatchMethod, MatchURL},
+		redact: map[string]bool{
+			"Authorization":       true,
+			"Proxy-Authorization": true,
+			"Cookie":              true,
+			"Set-Cookie":          true,
+			"X-Api-Key":           true,
+		},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == Record {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && r.mode == ReplayOrRecord {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cassette: %s: %w", path, err)
+	}
+	r.interactions = f.Interactions
+	r.used = make([]int, len(f.Interactions))
+	return r, nil
+}
+
+// Client returns an http.Client that sends its requests through r.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the exchanges in the cassette, including any recorded so far.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Interaction, len(r.interactions))
+	for i, in := range r.interactions {
+		out[i] = *in
+	}
+	return out
+}
+
+// RoundTrip answers req from the cassette or the network, depending on the mode.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	incoming, err := r.capture(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode != Record {
+		if in := r.lookup(incoming); in != nil {
+			return in.Response.toHTTP(req), nil
+		}
+		if r.mode == Replay && r.strict {
+			return nil, fmt.Errorf("%w: %s %s (body sha256 %s) among %d recorded interactions in %s",
+				ErrNoMatch, incoming.Method, incoming.URL, incoming.BodySHA256, len(r.Interactions()), r.path)
+		}
+	}
+
+	// capture consumed the body, so send a copy of the request with a fresh reader.
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(incoming.Body))
+	if len(incoming.Body) == 0 {
+		out.Body = http.NoBody
+	}
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil || r.mode == Replay {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: reading response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.record(&Interaction{
+		Request:  *incoming,
+		Response: Response{Status: resp.StatusCode, Header: r.redactHeader(resp.Header), Body: body},
+	}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// capture reads req into a Request with sensitive headers redacted. It consumes req.Body.
+func (r *Recorder) capture(req *http.Request) (*Request, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: reading request: %w", err)
+		}
+	}
+	sum := sha256.Sum256(body)
+	return &Request{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Header:     r.redactHeader(req.Header),
+		Body:       body,
+		BodySHA256: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for name, values := range out {
+		if r.redact[name] {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return out
+}
+
+// lookup returns the recorded interaction for req. Matching interactions are replayed in the order they were
+// recorded, so a sequence of identical requests gets the sequence of responses that was recorded; once all
+// have been used the last one keeps answering.
+func (r *Recorder) lookup(req *Request) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, in := range r.interactions {
+		if !r.matches(req, &in.Request) {
+			continue
+		}
+		if r.used[i] == 0 {
+			r.used[i]++
+			return in
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil
+	}
+	r.used[last]++
+	return r.interactions[last]
+}
+
+func (r *Recorder) matches(incoming, recorded *Request) bool {
+	for _, m := range r.matchers {
+		if !m(incoming, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// record appends an interaction and rewrites the cassette file. The file is written to a temporary name and
+// renamed, so an interrupted run never leaves a half-written cassette.
+func (r *Recorder) record(in *Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, in)
+	// A freshly recorded interaction has already served its request.
+	r.used = append(r.used, 1)
+
+	data, err := json.MarshalIndent(file{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	return nil
+}
+
+func (resp *Response) toHTTP(req *http.Request) *http.Response {
+	header := resp.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.Status, http.StatusText(resp.Status)),
+		StatusCode:    resp.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
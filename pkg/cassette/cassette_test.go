@@ -0,0 +1,195 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// backend answers with a running count, the method, path and body it received, and a session cookie.
+func backend(t *testing.T) (*httptest.Server, *int64) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&hits, 1)
+		body, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		fmt.Fprintf(w, "%d %s %s %s", n, r.Method, r.URL.Path, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func do(t *testing.T, c *http.Client, method, url, body string, header http.Header) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	srv, hits := backend(t)
+	path := filepath.Join(t.TempDir(), "nested", "cassette.json")
+
+	rec, err := New(path, WithMode(Record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := http.Header{"Authorization": {"Bearer hunter2"}}
+	var recorded []string
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodGet, "/items", ""},
+		{http.MethodGet, "/items", ""},
+		{http.MethodPost, "/items", "apple"},
+	} {
+		got, err := do(t, rec.Client(), r.method, srv.URL+r.path, r.body, auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "session=secret"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	// Replaying must not touch the server, and identical requests get the recorded responses in order.
+	before := atomic.LoadInt64(hits)
+	play, err := New(path, Strict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method, path, body, want string
+	}{
+		{http.MethodGet, "/items", "", recorded[0]},
+		{http.MethodGet, "/items", "", recorded[1]},
+		{http.MethodGet, "/items", "", recorded[1]},
+		{http.MethodPost, "/items", "pear", recorded[2]},
+	}
+	for _, test := range tests {
+		got, err := do(t, play.Client(), test.method, srv.URL+test.path, test.body, nil)
+		if err != nil || got != test.want {
+			t.Errorf("%s %s: got %q, %v, want %q", test.method, test.path, got, err, test.want)
+		}
+	}
+	if _, err := do(t, play.Client(), http.MethodDelete, srv.URL+"/items", "", nil); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("got %v, want %v", err, ErrNoMatch)
+	}
+	if n := atomic.LoadInt64(hits); n != before {
+		t.Errorf("replay sent %d requests to the server", n-before)
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	srv, _ := backend(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	matchers := WithMatchers(MatchMethod, MatchURL, MatchBody, MatchHeaders("Accept"))
+
+	rec, err := New(path, WithMode(Record), matchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for _, body := range []string{"apple", "pear"} {
+		for _, accept := range []string{"text/plain", "application/json"} {
+			got, err := do(t, rec.Client(), http.MethodPost, srv.URL, body, http.Header{"Accept": {accept}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[body+accept] = got
+		}
+	}
+
+	play, err := New(path, Strict(), matchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"pear", "apple"} {
+		for _, accept := range []string{"application/json", "text/plain"} {
+			got, err := do(t, play.Client(), http.MethodPost, srv.URL, body, http.Header{"Accept": {accept}})
+			if err != nil || got != want[body+accept] {
+				t.Errorf("%s %s: got %q, %v, want %q", body, accept, got, err, want[body+accept])
+			}
+		}
+	}
+	if _, err := do(t, play.Client(), http.MethodPost, srv.URL, "plum", http.Header{"Accept": {"text/plain"}}); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("got %v, want %v", err, ErrNoMatch)
+	}
+}
+
+func TestLenientReplayAndReplayOrRecord(t *testing.T) {
+	srv, hits := backend(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	if _, err := New(path); err == nil {
+		t.Fatal("Replay with a missing cassette succeeded")
+	}
+
+	// The first run records, the second replays.
+	for run := 0; run < 2; run++ {
+		rec, err := New(path, WithMode(ReplayOrRecord))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := do(t, rec.Client(), http.MethodGet, srv.URL+"/a", "", nil); err != nil || got != "1 GET /a " {
+			t.Errorf("run %d: got %q, %v", run, got, err)
+		}
+	}
+
+	// Without Strict an unmatched request goes to the server but isn't recorded.
+	rec, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := do(t, rec.Client(), http.MethodGet, srv.URL+"/b", "", nil); err != nil || got != "2 GET /b " {
+		t.Errorf("got %q, %v, want the live response", got, err)
+	}
+	if n := len(rec.Interactions()); n != 1 || atomic.LoadInt64(hits) != 2 {
+		t.Errorf("got %d interactions after %d requests, want 1 after 2", n, atomic.LoadInt64(hits))
+	}
+}
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		body Body
+		json string
+	}{
+		{Body("hello"), `"hello"`},
+		{Body{0xff, 0x00}, `{"base64":"/wA="}`},
+	}
+	for _, test := range tests {
+		data, err := test.body.MarshalJSON()
+		if err != nil || string(data) != test.json {
+			t.Errorf("got %s, %v, want %s", data, err, test.json)
+		}
+		var back Body
+		if err := back.UnmarshalJSON(data); err != nil || !bytes.Equal(back, test.body) {
+			t.Errorf("got %q, %v, want %q", back, err, test.body)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// Package cmap is a concurrent map split into shards, each guarded by one of several interchangeable
+// synchronization strategies. The Mutexes example protects a single map with a sync.Mutex; sharding spreads
+// the keys over several independently locked maps so unrelated keys rarely contend, and the strategy can be
+// swapped to compare a sync.Mutex, a sync.RWMutex and the channel-owning Goroutine from the Stateful
+// Goroutines example on the same workload.
+package cmap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Strategy selects how each shard synchronizes access to its map.
+type Strategy int
+
+const (
+	// Mutex guards each shard with a sync.Mutex.
+	Mutex Strategy = iota
+	// RWMutex guards each shard with a sync.RWMutex so reads can proceed in parallel.
+	RWMutex
+	// Channel gives each shard to an owning Goroutine that serves reads and writes sent over channels.
+	Channel
+)
+
+// Strategies lists every Strategy, in declaration order.
+var Strategies = []Strategy{Mutex, RWMutex, Channel}
+
+func (s Strategy) String() string {
+	switch s {
+	case Mutex:
+		return "mutex"
+	case RWMutex:
+		return "rwmutex"
+	case Channel:
+		return "channel"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// ParseStrategy returns the Strategy with the given name, as printed by String.
+func ParseStrategy(name string) (Strategy, error) {
+	for _, s := range Strategies {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("cmap: unknown strategy %q", name)
+}
+
+// shard is one independently synchronized part of the map.
+type shard[K comparable, V any] interface {
+	load(key K) (V, bool)
+	store(key K, val V)
+	delete(key K)
+	len() int
+	rangeAll(f func(K, V) bool) bool
+	close()
+}
+
+// Option configures a Map.
+type Option func(*options)
+
+type options struct {
+	shards   int
+	strategy Strategy
+}
+
+// WithShards sets the number of shards. Values below 1 are treated as 1. The default is 32.
+func WithShards(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		o.shards = n
+	}
+}
+
+// WithStrategy sets the synchronization strategy used by every shard. The default is Mutex.
+func WithStrategy(s Strategy) Option {
+	return func(o *options) {
+		o.strategy = s
+	}
+}
+
+// Map is a concurrent map from K to V. It is safe for use by multiple Goroutines.
+type Map[K comparable, V any] struct {
+	shards   []shard[K, V]
+	hash     func(K) uint64
+	strategy Strategy
+}
+
+// New returns an empty Map that places keys in shards using hash, for example StringHash or IntHash. Call
+// Close when done with a Map using the Channel strategy so its Goroutines exit.
+func New[K comparable, V any](hash func(K) uint64, opts ...Option) *Map[K, V] {
+	o := options{shards: 32, strategy: Mutex}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &Map[K, V]{shards: make([]shard[K, V], o.shards), hash: hash, strategy: o.strategy}
+	for i := range m.shards {
+		switch o.strategy {
+		case RWMutex:
+			m.shards[i] = &rwMutexShard[K, V]{state: make(map[K]V)}
+		case Channel:
+			m.shards[i] = newChannelShard[K, V]()
+		default:
+			m.shards[i] = &mutexShard[K, V]{state: make(map[K]V)}
+		}
+	}
+	return m
+}
+
+func (m *Map[K, V]) shardFor(key K) shard[K, V] {
+	return m.shards[m.hash(key)%uint64(len(m.shards))]
+}
+
+// Strategy returns the strategy the map was created with.
+func (m *Map[K, V]) Strategy() Strategy {
+	return m.strategy
+}
+
+// Load returns the value stored under key and whether it was present.
+func (m *Map[K, V]) Load(key K) (V, bool) {
+	return m.shardFor(key).load(key)
+}
+
+// Store sets the value under key.
+func (m *Map[K, V]) Store(key K, val V) {
+	m.shardFor(key).store(key, val)
+}
+
+// Delete removes key.
+func (m *Map[K, V]) Delete(key K) {
+	m.shardFor(key).delete(key)
+}
+
+// Len returns the number of keys. Shards are counted one at a time, so the result is only exact when no
+// writes happen concurrently.
+func (m *Map[K, V]) Len() int {
+	n := 0
+	for _, s := range m.shards {
+		n += s.len()
+	}
+	return n
+}
+
+// Range calls f for every key and value, one shard at a time, until f returns false. f must not call
+// methods on the same Map.
+func (m *Map[K, V]) Range(f func(key K, val V) bool) {
+	for _, s := range m.shards {
+		if !s.rangeAll(f) {
+			return
+		}
+	}
+}
+
+// Close releases the Goroutines of a Channel map. It is a no-op for the other strategies, and when called
+// again. The map must not be used after Close.
+func (m *Map[K, V]) Close() {
+	for _, s := range m.shards {
+		s.close()
+	}
+}
+
+// StringHash is an FNV-1a hash for string keys.
+func StringHash(s string) uint64 {
+	const offset, prime = 14695981039346656037, 1099511628211
+	h := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+// IntHash mixes the bits of an integer key so that sequential keys spread evenly over the shards.
+func IntHash[I ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64](i I) uint64 {
+	x := uint64(i)
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+type mutexShard[K comparable, V any] struct {
+	mu    sync.Mutex
+	state map[K]V
+}
+
+func (s *mutexShard[K, V]) load(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.state[key]
+	return v, ok
+}
+
+func (s *mutexShard[K, V]) store(key K, val V) {
+	s.mu.Lock()
+	s.state[key] = val
+	s.mu.Unlock()
+}
+
+func (s *mutexShard[K, V]) delete(key K) {
+	s.mu.Lock()
+	delete(s.state, key)
+	s.mu.Unlock()
+}
+
+func (s *mutexShard[K, V]) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.state)
+}
+
+func (s *mutexShard[K, V]) rangeAll(f func(K, V) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.state {
+		if !f(k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *mutexShard[K, V]) close() {}
+
+type rwMutexShard[K comparable, V any] struct {
+	mu    sync.RWMutex
+	state map[K]V
+}
+
+func (s *rwMutexShard[K, V]) load(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.state[key]
+	return v, ok
+}
+
+func (s *rwMutexShard[K, V]) store(key K, val V) {
+	s.mu.Lock()
+	s.state[key] = val
+	s.mu.Unlock()
+}
+
+func (s *rwMutexShard[K, V]) delete(key K) {
+	s.mu.Lock()
+	delete(s.state, key)
+	s.mu.Unlock()
+}
+
+func (s *rwMutexShard[K, V]) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.state)
+}
+
+func (s *rwMutexShard[K, V]) rangeAll(f func(K, V) bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, v := range s.state {
+		if !f(k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *rwMutexShard[K, V]) close() {}
+
+// channelShard is the Stateful Goroutines pattern: the map belongs to one Goroutine and readOp and writeOp
+// messages carry requests to it along with a channel for the reply.
+type channelShard[K comparable, V any] struct {
+	reads  chan readOp[K, V]
+	writes chan writeOp[K, V]
+	scans  chan scanOp[K, V]
+	stop   chan struct{}
+	// closeOnce makes a second Close a no-op, as it is for the other strategies.
+	closeOnce sync.Once
+}
+
+type readOp[K comparable, V any] struct {
+	key  K
+	resp chan readResult[V]
+}
+
+type readResult[V any] struct {
+	val V
+	ok  bool
+}
+
+type writeOp[K comparable, V any] struct {
+	key    K
+	val    V
+	delete bool
+	resp   chan bool
+}
+
+// scanOp asks the owner to run f over the map; the owner replies with the number of keys and whether f
+// visited all of them.
+type scanOp[K comparable, V any] struct {
+	f    func(K, V) bool
+	resp chan scanResult
+}
+
+type scanResult struct {
+	len      int
+	finished bool
+}
+
+func newChannelShard[K comparable, V any]() *channelShard[K, V] {
+	s := &channelShard[K, V]{
+		reads:  make(chan readOp[K, V]),
+		writes: make(chan writeOp[K, V]),
+		scans:  make(chan scanOp[K, V]),
+		stop:   make(chan struct{}),
+	}
+	go func() {
+		state := make(map[K]V)
+		for {
+			select {
+			case read := <-s.reads:
+				v, ok := state[read.key]
+				read.resp <- readResult[V]{val: v, ok: ok}
+			case write := <-s.writes:
+				if write.delete {
+					delete(state, write.key)
+				} else {
+					state[write.key] = write.val
+				}
+				write.resp <- true
+			case scan := <-s.scans:
+				res := scanResult{len: len(state), finished: true}
+				if scan.f != nil {
+					for k, v := range state {
+						if !scan.f(k, v) {
+							res.finished = false
+							break
+						}
+					}
+				}
+				scan.resp <- res
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *channelShard[K, V]) load(key K) (V, bool) {
+	read := readOp[K, V]{key: key, resp: make(chan readResult[V], 1)}
+	s.reads <- read
+	res := <-read.resp
+	return res.val, res.ok
+}
+
+func (s *channelShard[K, V]) store(key K, val V) {
+	write := writeOp[K, V]{key: key, val: val, resp: make(chan bool, 1)}
+	s.writes <- write
+	<-write.resp
+}
+
+func (s *channelShard[K, V]) delete(key K) {
+	write := writeOp[K, V]{key: key, delete: true, resp: make(chan bool, 1)}
+	s.writes <- write
+	<-write.resp
+}
+
+func (s *channelShard[K, V]) len() int {
+	scan := scanOp[K, V]{resp: make(chan scanResult, 1)}
+	s.scans <- scan
+	return (<-scan.resp).len
+}
+
+func (s *channelShard[K, V]) rangeAll(f func(K, V) bool) bool {
+	scan := scanOp[K, V]{f: f, resp: make(chan scanResult, 1)}
+	s.scans <- scan
+	return (<-scan.resp).finished
+}
+
+func (s *channelShard[K, V]) close() {
+	s.closeOnce.Do(func() { close(s.stop) })
+}
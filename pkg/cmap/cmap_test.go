@@ -0,0 +1,108 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	for _, s := range Strategies {
+		t.Run(s.String(), func(t *testing.T) {
+			m := New[int, int](IntHash[int], WithShards(4), WithStrategy(s))
+			defer m.Close()
+
+			// 10 Goroutines each write their own 100 keys, so every key ends up with a known value.
+			var wg sync.WaitGroup
+			for w := 0; w < 10; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						m.Store(w*100+i, w)
+						m.Load(i)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			if got := m.Len(); got != 1000 {
+				t.Fatalf("got %d keys, want 1000", got)
+			}
+			if v, ok := m.Load(523); !ok || v != 5 {
+				t.Errorf("Load(523) = %d, %v, want 5, true", v, ok)
+			}
+
+			m.Delete(523)
+			if _, ok := m.Load(523); ok {
+				t.Error("key 523 still present after Delete")
+			}
+
+			sum := 0
+			m.Range(func(k, v int) bool {
+				sum += v
+				return true
+			})
+			if want := 100*(0+1+2+3+4+5+6+7+8+9) - 5; sum != want {
+				t.Errorf("got sum %d, want %d", sum, want)
+			}
+
+			seen := 0
+			m.Range(func(k, v int) bool {
+				seen++
+				return seen < 3
+			})
+			if seen != 3 {
+				t.Errorf("Range visited %d keys after f returned false, want 3", seen)
+			}
+		})
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for _, s := range Strategies {
+		got, err := ParseStrategy(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseStrategy(%q) = %v, %v, want %v", s.String(), got, err, s)
+		}
+	}
+	if _, err := ParseStrategy("spinlock"); err == nil {
+		t.Error("ParseStrategy accepted an unknown name")
+	}
+}
+func TestCloseTwice(t *testing.T) {
+	// A deferred Close after an explicit one is common, and must not panic whatever the strategy.
+	for _, s := range Strategies {
+		m := New[string, int](StringHash, WithStrategy(s))
+		m.Store("a", 1)
+		m.Close()
+		m.Close()
+	}
+}
+
+func BenchmarkMap(b *testing.B) {
+	for _, s := range Strategies {
+		b.Run(s.String(), func(b *testing.B) {
+			m := New[string, int](StringHash, WithStrategy(s))
+			defer m.Close()
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = fmt.Sprint("key", i)
+				m.Store(keys[i], i)
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					// Nine reads for every write, roughly the mix in the Mutexes example.
+					if i%10 == 0 {
+						m.Store(keys[i%len(keys)], i)
+					} else {
+						m.Load(keys[i%len(keys)])
+					}
+					i++
+				}
+			})
+		})
+	}
+}
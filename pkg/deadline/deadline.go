@@ -0,0 +1,98 @@
+// Package deadline carries a request's deadline from one service to the next. The Context example shows a
+// handler giving up when its request's context is done, but that context ends at the process boundary: a
+// backend called by the handler knows nothing about how long the original caller is prepared to wait. Transport
+// writes the outgoing request's context deadline into the X-Request-Deadline header, and Handler turns that
+// header back into a context deadline on the receiving side, so every hop in a call chain stops working at
+// the same moment the first caller gives up.
+//
+// The header holds an absolute time, so the clocks of the services involved need to roughly agree. Transport
+// can subtract a margin from the deadline to leave each hop time to report a timeout of its own.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/router"
+)
+
+// Header is the request header the deadline travels in, formatted as RFC 3339 with nanoseconds.
+const Header = "X-Request-Deadline"
+
+// Parse returns the deadline in h, and false if there is none.
+func Parse(h http.Header) (time.Time, bool, error) {
+	v := h.Get(Header)
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("deadline: malformed %s header %q", Header, v)
+	}
+	return t, true, nil
+}
+
+// Set writes d into h.
+func Set(h http.Header, d time.Time) {
+	h.Set(Header, d.UTC().Format(time.RFC3339Nano))
+}
+
+// Handler applies the deadline in an incoming request's header to its context. A request whose deadline has
+// already passed is answered with 504 Gateway Timeout without calling next, and one with a malformed header
+// with 400 Bad Request.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok, err := Parse(r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !time.Now().Before(d) {
+			http.Error(w, "deadline already passed", http.StatusGatewayTimeout)
+			return
+		}
+		// WithDeadline keeps the earlier of the two deadlines, so a closer one the server set itself still wins.
+		ctx, cancel := context.WithDeadline(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Transport is an http.RoundTripper that copies the request context's deadline, less Margin, into the
+// X-Request-Deadline header. It also forwards the request ID set by router.RequestID, so the log lines of
+// every hop can be tied to the same request.
+type Transport struct {
+	// Base sends the requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Margin is taken off the deadline passed downstream.
+	Margin time.Duration
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	d, hasDeadline := req.Context().Deadline()
+	id := router.RequestIDFrom(req.Context())
+	if !hasDeadline && id == "" {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request it is given, so the headers are set on a copy.
+	out := req.Clone(req.Context())
+	if hasDeadline {
+		Set(out.Header, d.Add(-t.Margin))
+	}
+	if id != "" && out.Header.Get(router.RequestIDHeader) == "" {
+		out.Header.Set(router.RequestIDHeader, id)
+	}
+	return base.RoundTrip(out)
+}
@@ -0,0 +1,145 @@
+package deadline
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/router"
+)
+
+func TestParseAndSet(t *testing.T) {
+	d := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("X", 3600))
+	h := make(http.Header)
+	Set(h, d)
+	got, ok, err := Parse(h)
+	if err != nil || !ok || !got.Equal(d) {
+		t.Errorf("got %v, %v, %v, want %v", got, ok, err, d)
+	}
+
+	if _, ok, err := Parse(http.Header{}); ok || err != nil {
+		t.Errorf("got %v, %v for no header, want false, nil", ok, err)
+	}
+	if _, _, err := Parse(http.Header{Header: {"soon"}}); err == nil {
+		t.Error("malformed header parsed")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		header string
+		code   int
+		want   time.Time
+	}{
+		{"none", "", http.StatusOK, time.Time{}},
+		{"future", future.Format(time.RFC3339Nano), http.StatusOK, future},
+		{"past", time.Now().Add(-time.Second).Format(time.RFC3339Nano), http.StatusGatewayTimeout, time.Time{}},
+		{"malformed", "soon", http.StatusBadRequest, time.Time{}},
+	}
+	for _, test := range tests {
+		var got time.Time
+		h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = r.Context().Deadline()
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			req.Header.Set(Header, test.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.code || !got.Equal(test.want) {
+			t.Errorf("%s: got %d with deadline %v, want %d with %v", test.name, w.Code, got, test.code, test.want)
+		}
+	}
+}
+
+// outcome is what the backend saw of its request.
+type outcome struct {
+	id       string
+	deadline time.Time
+	err      error
+}
+
+// chain starts a backend that waits for its context to end, and a gateway that calls it through a Transport.
+// The channel receives the backend's outcome once it stops.
+func chain(t *testing.T) (gateway *httptest.Server, stopped <-chan outcome) {
+	ch := make(chan outcome, 1)
+	backend := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		d, _ := r.Context().Deadline()
+		ch <- outcome{r.Header.Get(router.RequestIDHeader), d, r.Context().Err()}
+		http.Error(w, r.Context().Err().Error(), http.StatusGatewayTimeout)
+	})))
+	t.Cleanup(backend.Close)
+
+	client := &http.Client{Transport: &Transport{Margin: 10 * time.Millisecond}}
+	gateway = httptest.NewServer(router.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}), router.RequestID(), Handler))
+	t.Cleanup(gateway.Close)
+	return gateway, ch
+}
+
+func TestPropagatesDeadline(t *testing.T) {
+	gateway, stopped := chain(t)
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL, nil)
+	req.Header.Set(router.RequestIDHeader, "req-1")
+	Set(req.Header, deadline)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	got := <-stopped
+	if got.id != "req-1" {
+		t.Errorf("got request ID %q at the backend, want req-1", got.id)
+	}
+	if want := deadline.Add(-10 * time.Millisecond); !got.deadline.Equal(want) {
+		t.Errorf("got backend deadline %v, want %v", got.deadline, want)
+	}
+	if got.err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", got.err, context.DeadlineExceeded)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+	}
+}
+
+func TestClientDisconnectCancelsBackend(t *testing.T) {
+	gateway, stopped := chain(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gateway.URL, nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Fatal("request succeeded after the client cancelled it")
+	}
+
+	select {
+	case got := <-stopped:
+		if got.err != context.Canceled {
+			t.Errorf("got %v at the backend, want %v", got.err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend kept working after the client went away")
+	}
+}
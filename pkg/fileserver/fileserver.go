@@ -0,0 +1,420 @@
+// Package fileserver serves a directory tree over HTTP, which the HTTP Server example otherwise has no way to
+// do. It speaks the parts of HTTP that make file serving efficient: every file gets a strong ETag computed from
+// its contents, so clients can revalidate with If-None-Match or If-Modified-Since and get a 304 Not Modified
+// instead of the whole file again; byte Range requests let a client resume a download or seek in a video; and
+// compressible files are gzipped on the fly for clients that accept it. Directories can be listed as HTML or
+// JSON.
+//
+// Request paths are mapped onto the root with the filepath functions from the File Paths example, and no
+// request can reach a file outside the root: ".." segments are resolved before the path is joined, and
+// symbolic links are followed only if they lead somewhere inside the root. Files and directories whose names
+// start with a dot, such as .git or .env, are never served.
+package fileserver
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Listing decides how a directory without an index file is shown.
+type Listing int
+
+const (
+	// NoListing answers requests for directories with 404 Not Found.
+	NoListing Listing = iota
+	// HTMLListing lists a directory as an HTML page of links.
+	HTMLListing
+	// JSONListing lists a directory as a JSON document.
+	JSONListing
+	// AutoListing lists a directory as JSON for clients whose Accept header asks for it, and as HTML otherwise.
+	AutoListing
+)
+
+func (l Listing) String() string {
+	switch l {
+	case NoListing:
+		return "none"
+	case HTMLListing:
+		return "html"
+	case JSONListing:
+		return "json"
+	case AutoListing:
+		return "auto"
+	}
+	return fmt.Sprintf("Listing(%d)", int(l))
+}
+
+// ParseListing returns the Listing named by s, as printed by Listing.String.
+func ParseListing(s string) (Listing, error) {
+	for l := NoListing; l <= AutoListing; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("fileserver: unknown listing %q", s)
+}
+
+// Option configures a Server.
+type Option func(*config)
+
+type config struct {
+	listing     Listing
+	index       string
+	gzipMinSize int64
+}
+
+// WithListing sets how directories without an index file are shown. The default is NoListing.
+func WithListing(l Listing) Option {
+	return func(c *config) {
+		c.listing = l
+	}
+}
+
+// WithIndex sets the file served for a directory that contains one. The default is "index.html"; "" turns index
+// files off.
+func WithIndex(name string) Option {
+	return func(c *config) {
+		c.index = name
+	}
+}
+
+// WithGzipMinSize sets the smallest file that is gzipped, since compressing a few bytes only makes them bigger.
+// The default is 1 KiB; a negative size turns compression off.
+func WithGzipMinSize(n int64) Option {
+	return func(c *config) {
+		c.gzipMinSize = n
+	}
+}
+
+// Server is an http.Handler that serves the files under a root directory. It is safe for concurrent use.
+type Server struct {
+	root string
+	cfg  config
+
+	// etags caches each file's ETag, keyed by path and valid while its size and modification time are unchanged.
+	mu    sync.Mutex
+	etags map[string]etagEntry
+}
+
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// New returns a Server for the directory root.
+func New(root string, opts ...Option) (*Server, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	// Resolving links in the root itself lets later checks compare it with resolved file paths.
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(abs); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("fileserver: %s is not a directory", root)
+	}
+
+	cfg := config{index: "index.html", gzipMinSize: 1024}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Server{root: abs, cfg: cfg, etags: make(map[string]etagEntry)}, nil
+}
+
+var errOutsideRoot = errors.New("fileserver: path outside root")
+
+// resolve maps a URL path onto a file under the root. It fails for hidden names and for paths that lead
+// outside the root, whether through ".." or a symbolic link.
+func (s *Server) resolve(urlPath string) (string, error) {
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", errOutsideRoot
+	}
+	// Cleaning the path as if it were absolute resolves every ".." against the root, so "/../../etc/passwd"
+	// becomes "/etc/passwd", which is then looked for inside the root.
+	clean := path.Clean("/" + urlPath)
+	for _, seg := range strings.Split(clean, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return "", fs.ErrNotExist
+		}
+	}
+	name := filepath.Join(s.root, filepath.FromSlash(clean))
+
+	// A symbolic link may still point anywhere, so the real path must be inside the root too. Rel fails, or
+	// starts with "..", for a target outside it.
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return real, nil
+}
+
+// ServeHTTP serves the file or directory named by the request path. Only GET and HEAD are allowed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name, err := s.resolve(r.URL.Path)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	if fi.IsDir() {
+		// Relative links in a directory's page only work if its URL ends in a slash. The redirect is relative
+		// too, since behind http.StripPrefix r.URL.Path isn't the path the client asked for. http.Redirect
+		// would resolve it against that path, so the header is set directly.
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			u := url.URL{Path: path.Base(r.URL.Path) + "/", RawQuery: r.URL.RawQuery}
+			// When the prefix was the whole path, as for /static, there is no last segment to name, and ./
+			// would lead above the mount point, so the redirect uses the path the client sent instead.
+			if r.URL.Path == "" {
+				u.Path = "/"
+				if orig, err := url.ParseRequestURI(r.RequestURI); err == nil {
+					u.Path = orig.Path + "/"
+				}
+			}
+			w.Header().Set("Location", u.String())
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		// The index file goes through resolve as well, since it could be a link leading out of the root.
+		if s.cfg.index != "" {
+			if indexName, err := s.resolve(r.URL.Path + s.cfg.index); err == nil {
+				if index, err := os.Open(indexName); err == nil {
+					defer index.Close()
+					if ifi, err := index.Stat(); err == nil && ifi.Mode().IsRegular() {
+						s.serveFile(w, r, indexName, index, ifi)
+						return
+					}
+				}
+			}
+		}
+		s.serveDir(w, r, f)
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		s.fail(w, fs.ErrNotExist)
+		return
+	}
+	s.serveFile(w, r, name, f, fi)
+}
+
+// fail answers with the status matching err without revealing anything about the file system.
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, errOutsideRoot), errors.Is(err, syscall.ENOTDIR):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
+
+// etag returns the file's strong ETag, a hash of its contents, computing it only when the file has changed.
+func (s *Server) etag(name string, f *os.File, fi fs.FileInfo) (string, error) {
+	s.mu.Lock()
+	e, ok := s.etags[name]
+	s.mu.Unlock()
+	if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		return e.etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.mu.Lock()
+	s.etags[name] = etagEntry{size: fi.Size(), modTime: fi.ModTime(), etag: etag}
+	s.mu.Unlock()
+	return etag, nil
+}
+
+// contentType guesses a file's type from its extension or, failing that, its first 512 bytes.
+func contentType(name string, f *os.File) (string, error) {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+	var buf [512]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// compressible reports whether a type is worth gzipping. Images, video and archives are already compressed.
+func compressible(ctype string) bool {
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml", "application/wasm":
+		return true
+	}
+	return false
+}
+
+// serveFile answers a request for a regular file, honouring conditional and Range headers.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string, f *os.File, fi fs.FileInfo) {
+	etag, err := s.etag(name, f, fi)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	ctype, err := contentType(name, f)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	// The gzipped body is a different representation from the file itself, so it gets an ETag of its own.
+	gz := s.cfg.gzipMinSize >= 0 && fi.Size() >= s.cfg.gzipMinSize && compressible(ctype) &&
+		r.Header.Get("Range") == "" && acceptsGzip(r)
+	if gz {
+		etag = strings.TrimSuffix(etag, `"`) + `-gzip"`
+	}
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	if s.cfg.gzipMinSize >= 0 && compressible(ctype) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if notModified(r, etag, fi.ModTime()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", ctype)
+
+	if gz {
+		h.Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		zw := gzip.NewWriter(w)
+		io.Copy(zw, f)
+		zw.Close()
+		return
+	}
+
+	h.Set("Accept-Ranges", "bytes")
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && ifRange(r, etag, fi.ModTime()) {
+		ranges, err := parseRange(rangeHeader, fi.Size())
+		if err == errUnsatisfiable {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", fi.Size()))
+			http.Error(w, "416 requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		// A malformed or excessive Range header is ignored, as the RFC allows, and the whole file is sent.
+		if err == nil {
+			serveRanges(w, r, f, fi.Size(), ctype, ranges)
+			return
+		}
+	}
+
+	h.Set("Content-Length", fmt.Sprint(fi.Size()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, f)
+	}
+}
+
+// acceptsGzip reports whether the client's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if strings.TrimSpace(coding) == "gzip" || strings.TrimSpace(coding) == "*" {
+				return strings.ReplaceAll(params, " ", "") != "q=0"
+			}
+		}
+	}
+	return false
+}
+
+// notModified reports whether the client's cached copy is current. If-None-Match takes precedence over
+// If-Modified-Since, which only has a resolution of one second.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// ifRange reports whether a Range header should be honoured. With If-Range, the client only wants the
+// ranges if its copy is still current, and the whole new file otherwise.
+func ifRange(r *http.Request, etag string, modTime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		return ir == etag
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && modTime.Truncate(time.Second).Equal(t)
+}
+
+// etagListMatches reports whether the comma-separated ETags in list include etag. The comparison is the weak
+// one If-None-Match uses, which ignores a W/ prefix.
+func etagListMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
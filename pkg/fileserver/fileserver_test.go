@@ -0,0 +1,327 @@
+package fileserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var text = strings.Repeat("hello world\n", 200)
+
+// tree builds a root directory to serve, next to a secret file that must stay out of reach.
+func tree(t *testing.T) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	files := map[string]string{
+		"secret":                 "outside the root",
+		"root/hello.txt":         text,
+		"root/small.txt":         "hi",
+		"root/empty.txt":         "",
+		"root/image.png":         "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 2000),
+		"root/.env":              "PASSWORD=hunter2",
+		"root/site/index.html":   "<h1>home</h1>",
+		"root/list/a.txt":        "a",
+		"root/list/b/c.txt":      "c",
+		"root/list/.hidden":      "h",
+		"root/list/what?#1.json": "{}",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "link-out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "small.txt"), filepath.Join(root, "link-in")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func serve(s *Server, method, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func newServer(t *testing.T, opts ...Option) *Server {
+	s, err := New(tree(t), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPathTraversal(t *testing.T) {
+	s := newServer(t)
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/small.txt", http.StatusOK},
+		{"/link-in", http.StatusOK},
+		{"/list/../small.txt", http.StatusOK},
+		{"/../secret", http.StatusNotFound},
+		{"/%2e%2e/secret", http.StatusNotFound},
+		{"/list/../../secret", http.StatusNotFound},
+		{"/..%5csecret", http.StatusNotFound},
+		{"/link-out", http.StatusNotFound},
+		{"/.env", http.StatusNotFound},
+		{"/list/.hidden", http.StatusNotFound},
+		{"/missing", http.StatusNotFound},
+		{"/small.txt/x", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := serve(s, http.MethodGet, test.target)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.target, w.Code, test.status)
+		}
+		if strings.Contains(w.Body.String(), "outside") || strings.Contains(w.Body.String(), "hunter2") {
+			t.Errorf("%s: leaked %q", test.target, w.Body.String())
+		}
+	}
+	if w := serve(s, http.MethodPost, "/small.txt"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := newServer(t)
+	w := serve(s, http.MethodGet, "/hello.txt")
+	etag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || w.Body.String() != text || len(etag) != 34 {
+		t.Fatalf("got %d with ETag %q", w.Code, etag)
+	}
+	earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		header []string
+		status int
+	}{
+		{"matching ETag", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"weak matching ETag", []string{"If-None-Match", `"other", W/` + etag}, http.StatusNotModified},
+		{"star", []string{"If-None-Match", "*"}, http.StatusNotModified},
+		{"stale ETag", []string{"If-None-Match", `"other"`}, http.StatusOK},
+		{"not modified since", []string{"If-Modified-Since", modified}, http.StatusNotModified},
+		{"modified since", []string{"If-Modified-Since", earlier}, http.StatusOK},
+		{"ETag wins over date", []string{"If-None-Match", `"other"`, "If-Modified-Since", modified}, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := serve(s, http.MethodGet, "/hello.txt", test.header...)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("%s: 304 with a body or without the ETag", test.name)
+		}
+	}
+
+	// Changing the file changes its ETag.
+	os.WriteFile(filepath.Join(s.root, "hello.txt"), []byte("changed"), 0644)
+	if w := serve(s, http.MethodGet, "/hello.txt", "If-None-Match", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("got %d with ETag %q after the file changed", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestRanges(t *testing.T) {
+	s := newServer(t)
+	size := strconv.Itoa(len(text))
+	etag := serve(s, http.MethodGet, "/hello.txt").Header().Get("ETag")
+	tests := []struct {
+		name         string
+		header       []string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"first bytes", []string{"Range", "bytes=0-4"}, http.StatusPartialContent, "hello", "bytes 0-4/" + size},
+		{"open ended", []string{"Range", "bytes=2398-"}, http.StatusPartialContent, "d\n", "bytes 2398-2399/" + size},
+		{"suffix", []string{"Range", "bytes=-6"}, http.StatusPartialContent, "world\n", "bytes 2394-2399/" + size},
+		{"end past the file", []string{"Range", "bytes=2394-9999"}, http.StatusPartialContent, "world\n", "bytes 2394-2399/" + size},
+		{"unsatisfiable", []string{"Range", "bytes=9999-"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */" + size},
+		{"malformed", []string{"Range", "lines=0-4"}, http.StatusOK, text, ""},
+		{"backwards", []string{"Range", "bytes=4-0"}, http.StatusOK, text, ""},
+		{"current If-Range", []string{"Range", "bytes=0-4", "If-Range", etag}, http.StatusPartialContent, "hello", "bytes 0-4/" + size},
+		{"stale If-Range", []string{"Range", "bytes=0-4", "If-Range", `"other"`}, http.StatusOK, text, ""},
+	}
+	for _, test := range tests {
+		w := serve(s, http.MethodGet, "/hello.txt", test.header...)
+		if w.Code != test.status || w.Header().Get("Content-Range") != test.contentRange {
+			t.Errorf("%s: got %d with Content-Range %q, want %d with %q", test.name, w.Code,
+				w.Header().Get("Content-Range"), test.status, test.contentRange)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: got body %.20q, want %.20q", test.name, w.Body.String(), test.body)
+		}
+	}
+
+	// No range of an empty file is satisfiable, not even a suffix.
+	for _, header := range []string{"bytes=-5", "bytes=0-", "bytes=0-0"} {
+		w := serve(s, http.MethodGet, "/empty.txt", "Range", header)
+		if w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */0" {
+			t.Errorf("empty file, %s: got %d with Content-Range %q, want 416", header, w.Code, w.Header().Get("Content-Range"))
+		}
+	}
+}
+
+func TestMultipleRanges(t *testing.T) {
+	s := newServer(t)
+	w := serve(s, http.MethodGet, "/hello.txt", "Range", "bytes=0-4,6-10")
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if n, _ := strconv.Atoi(w.Header().Get("Content-Length")); n != w.Body.Len() {
+		t.Errorf("got Content-Length %d for a %d byte body", n, w.Body.Len())
+	}
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType != "multipart/byteranges" {
+		t.Fatalf("got Content-Type %q", mediaType)
+	}
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for _, want := range []struct{ body, contentRange string }{
+		{"hello", "bytes 0-4/2400"},
+		{"world", "bytes 6-10/2400"},
+	} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != want.body || part.Header.Get("Content-Range") != want.contentRange {
+			t.Errorf("got part %q with %q, want %q with %q", body, part.Header.Get("Content-Range"), want.body, want.contentRange)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("got %v after the last part, want io.EOF", err)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	s := newServer(t)
+	plain := serve(s, http.MethodGet, "/hello.txt")
+	w := serve(s, http.MethodGet, "/hello.txt", "Accept-Encoding", "br, gzip;q=0.8")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("got headers %v, want a gzipped response", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != text {
+		t.Errorf("got %d bytes after decompressing, want the file", len(body))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == plain.Header().Get("ETag") || !strings.HasSuffix(etag, `-gzip"`) {
+		t.Errorf("got ETag %q for the gzipped file, want a different one from %q", etag, plain.Header().Get("ETag"))
+	}
+	if w := serve(s, http.MethodGet, "/hello.txt", "Accept-Encoding", "gzip", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("got status %d revalidating the gzipped file", w.Code)
+	}
+
+	for _, test := range []struct {
+		name, target string
+		header       []string
+	}{
+		{"too small", "/small.txt", []string{"Accept-Encoding", "gzip"}},
+		{"already compressed", "/image.png", []string{"Accept-Encoding", "gzip"}},
+		{"not accepted", "/hello.txt", []string{"Accept-Encoding", "gzip;q=0"}},
+		{"range", "/hello.txt", []string{"Accept-Encoding", "gzip", "Range", "bytes=0-4"}},
+	} {
+		if w := serve(s, http.MethodGet, test.target, test.header...); w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: got a gzipped response", test.name)
+		}
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	s := newServer(t)
+	if w := serve(s, http.MethodGet, "/list/"); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d listing a directory with listings off", w.Code)
+	}
+	if w := serve(s, http.MethodGet, "/site/"); w.Body.String() != "<h1>home</h1>" {
+		t.Errorf("got %q, want the index file", w.Body.String())
+	}
+	if w := serve(s, http.MethodGet, "/list?x=1"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "list/?x=1" {
+		t.Errorf("got %d to %q, want a redirect to the slashed URL", w.Code, w.Header().Get("Location"))
+	}
+
+	// Mounted under a prefix, the redirect has to stay under it, so it is relative to the client's URL.
+	mounted := httptest.NewServer(http.StripPrefix("/static", newServer(t, WithListing(AutoListing))))
+	defer mounted.Close()
+	resp, err := http.Get(mounted.URL + "/static/list/b?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Request.URL.Path + "?" + resp.Request.URL.RawQuery; resp.StatusCode != http.StatusOK || got != "/static/list/b/?x=1" {
+		t.Errorf("behind StripPrefix: got %d from %s, want 200 from /static/list/b/?x=1", resp.StatusCode, got)
+	}
+	// The bare prefix strips to an empty path, which has to go to the prefix's own directory.
+	resp, err = http.Get(mounted.URL + "/static?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Request.URL.Path + "?" + resp.Request.URL.RawQuery; resp.StatusCode != http.StatusOK || got != "/static/?x=1" {
+		t.Errorf("behind StripPrefix: got %d from %s, want 200 from /static/?x=1", resp.StatusCode, got)
+	}
+
+	s = newServer(t, WithListing(AutoListing))
+	w := serve(s, http.MethodGet, "/list/")
+	body := w.Body.String()
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(body, `<a href="./a.txt">a.txt</a>`) ||
+		!strings.Contains(body, `<a href="./b/">b/</a>`) ||
+		!strings.Contains(body, `<a href="./what%3F%231.json">what?#1.json</a>`) ||
+		strings.Contains(body, ".hidden") {
+		t.Errorf("got HTML listing %s", body)
+	}
+
+	w = serve(s, http.MethodGet, "/list/", "Accept", "application/json")
+	var listing DirListing
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range listing.Entries {
+		names = append(names, e.Name)
+	}
+	if got, want := strings.Join(names, " "), "a.txt b what?#1.json"; got != want || listing.Path != "/list/" || !listing.Entries[1].Dir {
+		t.Errorf("got JSON listing %+v, want entries %q", listing, want)
+	}
+}
+
+func TestHead(t *testing.T) {
+	s := newServer(t)
+	w := serve(s, http.MethodHead, "/hello.txt")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(len(text)) {
+		t.Errorf("got %d with %d bytes and Content-Length %q", w.Code, w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if !bytes.Equal(serve(s, http.MethodGet, "/image.png").Body.Bytes()[:4], []byte("\x89PNG")) {
+		t.Error("image not served")
+	}
+}
@@ -0,0 +1,106 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is one file or subdirectory in a JSON directory listing.
+type Entry struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// DirListing is the JSON document a directory is listed as.
+type DirListing struct {
+	Path    string  `json:"path"`
+	Entries []Entry `json:"entries"`
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{"link": entryLink}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{- if ne .Path "/"}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{link .}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td>{{if not .Dir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// entryLink returns the relative URL of a listed entry. The name is escaped as a path segment, so a file called
+// "a?b" or "#1" links to itself, and the "./" keeps a name containing a colon from being read as a URL scheme.
+func entryLink(e Entry) string {
+	link := "./" + url.PathEscape(e.Name)
+	if e.Dir {
+		link += "/"
+	}
+	return link
+}
+
+// serveDir lists the directory d in the configured format, leaving out hidden entries.
+func (s *Server) serveDir(w http.ResponseWriter, r *http.Request, d *os.File) {
+	format := s.cfg.listing
+	if format == AutoListing {
+		format = HTMLListing
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			format = JSONListing
+		}
+		w.Header().Add("Vary", "Accept")
+	}
+	if format == NoListing {
+		s.fail(w, os.ErrNotExist)
+		return
+	}
+
+	dirEntries, err := d.ReadDir(-1)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	listing := DirListing{Path: r.URL.Path, Entries: []Entry{}}
+	for _, de := range dirEntries {
+		if strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		e := Entry{Name: de.Name(), Dir: fi.IsDir(), ModTime: fi.ModTime()}
+		if !e.Dir {
+			e.Size = fi.Size()
+		}
+		listing.Entries = append(listing.Entries, e)
+	}
+	sort.Slice(listing.Entries, func(i, j int) bool { return listing.Entries[i].Name < listing.Entries[j].Name })
+
+	// Listings change whenever the directory does, so they are never cached.
+	w.Header().Set("Cache-Control", "no-cache")
+	if format == JSONListing {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodHead {
+			json.NewEncoder(w).Encode(listing)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method != http.MethodHead {
+		listingTemplate.Execute(w, listing)
+	}
+}
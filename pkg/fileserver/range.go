@@ -0,0 +1,152 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxRanges is the most ranges one request may ask for. A request for many small or overlapping ranges costs
+// the server far more than sending the file, so it gets the whole file instead.
+const maxRanges = 16
+
+var (
+	errUnsatisfiable = errors.New("fileserver: range not satisfiable")
+	errBadRange      = errors.New("fileserver: malformed range")
+)
+
+// byteRange is the inclusive range of bytes from start to end.
+type byteRange struct {
+	start, end int64
+}
+
+func (r byteRange) length() int64 { return r.end - r.start + 1 }
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// parseRange parses a Range header such as "bytes=0-99,200-,-50" for a file of the given size. Ranges that
+// start beyond the end of the file, and every range of an empty file, are dropped; if that leaves none, the
+// error is errUnsatisfiable.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header {
+		return nil, errBadRange
+	}
+	parts := strings.Split(spec, ",")
+	if len(parts) > maxRanges {
+		return nil, errBadRange
+	}
+
+	var ranges []byteRange
+	for _, part := range parts {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, errBadRange
+		}
+		var r byteRange
+		if first == "" {
+			// "-n" is the last n bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errBadRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{size - n, size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errBadRange
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, errBadRange
+				}
+				if end > size-1 {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start, end}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return ranges, nil
+}
+
+// serveRanges answers with 206 Partial Content: the bytes themselves for a single range, or a
+// multipart/byteranges body with one part per range.
+func serveRanges(w http.ResponseWriter, r *http.Request, f *os.File, size int64, ctype string, ranges []byteRange) {
+	h := w.Header()
+	if len(ranges) == 1 {
+		br := ranges[0]
+		h.Set("Content-Range", br.contentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(br.length(), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			io.Copy(w, io.NewSectionReader(f, br.start, br.length()))
+		}
+		return
+	}
+
+	// The body is streamed, so its length is worked out beforehand by writing the part headers alone.
+	var length countingWriter
+	cw := multipart.NewWriter(&length)
+	for _, br := range ranges {
+		cw.CreatePart(partHeader(ctype, br, size))
+		length += countingWriter(br.length())
+	}
+	cw.Close()
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+cw.Boundary())
+	h.Set("Content-Length", strconv.FormatInt(int64(length), 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return
+	}
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(cw.Boundary())
+	for _, br := range ranges {
+		part, err := mw.CreatePart(partHeader(ctype, br, size))
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(part, io.NewSectionReader(f, br.start, br.length())); err != nil {
+			return
+		}
+	}
+	mw.Close()
+}
+
+func partHeader(ctype string, br byteRange, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {ctype},
+		"Content-Range": {br.contentRange(size)},
+	}
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,170 @@
+// Package group runs related Goroutines and waits for them, like the WaitGroups example, but lets each one
+// report an error. By default the first error cancels the context shared by the group so the others can
+// stop early, and Wait returns that error. A group can also cap how many Goroutines run at once, or keep
+// going after a failure and report every error at the end. A panic in a Goroutine is recovered and returned
+// as a *PanicError carrying the stack trace.
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Option configures a Group.
+type Option func(*Group)
+
+// CollectAll makes the group run every function to completion even after one fails. Wait then returns a
+// MultiError holding every error, and the shared context is only cancelled by Wait or by its parent.
+func CollectAll() Option {
+	return func(g *Group) {
+		g.collectAll = true
+	}
+}
+
+// Group is a collection of Goroutines working on parts of the same task. The zero value is not usable;
+// call New.
+type Group struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	collectAll bool
+
+	wg  sync.WaitGroup
+	sem chan struct{}
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// New returns a Group whose functions receive a context derived from ctx.
+func New(ctx context.Context, opts ...Option) *Group {
+	g := &Group{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Context returns the context passed to every function in the group.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// SetLimit limits the group to at most n functions running at once; Go blocks until a slot is free. A
+// negative n removes the limit. SetLimit must not be called while functions are running.
+func (g *Group) SetLimit(n int) {
+	if len(g.sem) != 0 {
+		panic(fmt.Sprintf("group: SetLimit called with %d functions running", len(g.sem)))
+	}
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go runs f in a new Goroutine, passing it the group's context. If a limit is set, Go first waits for a free
+// slot.
+func (g *Group) Go(f func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		if err := call(g.ctx, f); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// call runs f and turns a panic into a *PanicError.
+func call(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return f(ctx)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.errs = append(g.errs, err)
+	if !g.collectAll && len(g.errs) == 1 {
+		g.cancel()
+	}
+}
+
+// Wait blocks until every function has returned, then cancels the group's context. It returns the first
+// error, or with CollectAll a MultiError of all of them, or nil if every function succeeded.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case len(g.errs) == 0:
+		return nil
+	case g.collectAll:
+		return MultiError(append([]error(nil), g.errs...))
+	default:
+		return g.errs[0]
+	}
+}
+
+// PanicError is returned in place of a panic that escaped a function run by the group.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("group: panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns the panic value if it is an error, so errors.Is and errors.As see through the panic.
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// MultiError is every error returned by a group created with CollectAll, in the order they occurred.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the errors matches target.
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target.
+func (m MultiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitNoErrors(t *testing.T) {
+	g := New(context.Background())
+	var done int32
+	for i := 0; i < 5; i++ {
+		g.Go(func(ctx context.Context) error {
+			atomic.AddInt32(&done, 1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if done != 5 {
+		t.Errorf("got %d finished, want 5", done)
+	}
+	if g.Context().Err() == nil {
+		t.Error("context not cancelled after Wait")
+	}
+}
+
+func TestFirstErrorCancels(t *testing.T) {
+	errFirst := errors.New("first")
+	g := New(context.Background())
+
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+	g.Go(func(ctx context.Context) error {
+		// This sibling only returns once the failure above has cancelled the shared context.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("sibling was not cancelled")
+		}
+	})
+
+	if err := g.Wait(); !errors.Is(err, errFirst) {
+		t.Errorf("got %v, want %v", err, errFirst)
+	}
+}
+
+func TestCollectAll(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	g := New(context.Background(), CollectAll())
+
+	var finished int32
+	for _, err := range []error{errA, nil, errB} {
+		err := err
+		g.Go(func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			if ctx.Err() == nil {
+				atomic.AddInt32(&finished, 1)
+			}
+			return err
+		})
+	}
+
+	err := g.Wait()
+	var multi MultiError
+	if !errors.As(err, &multi) || len(multi) != 2 {
+		t.Fatalf("got %v, want a MultiError with 2 errors", err)
+	}
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("got %v, want it to match both a and b", err)
+	}
+	if finished != 3 {
+		t.Errorf("%d functions saw an uncancelled context, want 3", finished)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	g := New(context.Background())
+	g.SetLimit(2)
+
+	var running, peak int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	g.Wait()
+
+	if peak != 2 {
+		t.Errorf("got peak concurrency %d, want 2", peak)
+	}
+}
+
+func TestPanicRecovered(t *testing.T) {
+	g := New(context.Background())
+	g.Go(func(ctx context.Context) error {
+		var m map[string]int
+		m["boom"] = 1
+		return nil
+	})
+
+	err := g.Wait()
+	var p *PanicError
+	if !errors.As(err, &p) {
+		t.Fatalf("got %v, want a *PanicError", err)
+	}
+	if !strings.Contains(string(p.Stack), "TestPanicRecovered") {
+		t.Errorf("stack does not mention the panicking function:\n%s", p.Stack)
+	}
+	if p.Unwrap() == nil {
+		t.Error("runtime error panic value should unwrap to an error")
+	}
+}
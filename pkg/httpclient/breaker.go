@@ -0,0 +1,121 @@
+package httpclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// State is the state of a host's circuit breaker.
+type State int
+
+const (
+	// Closed lets every request through and counts consecutive failures.
+	Closed State = iota
+	// Open fails every request at once until the cooldown has passed.
+	Open
+	// HalfOpen lets a single probe request through. Its success closes the circuit and its failure opens it
+	// again.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// breaker is the circuit breaker for one host.
+type breaker struct {
+	clock     clock.Clock
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	gen      uint64 // counts state changes, so outcomes of requests let through before one can be told apart
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// setState moves the breaker to state s. It is called with mu held.
+func (b *breaker) setState(s State) {
+	b.state = s
+	b.gen++
+	b.probing = false
+	if s == Open {
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// allow reports whether a request may be sent now, and the generation to report its outcome under. In the
+// half-open state only one request at a time is allowed, and its outcome must be reported with done.
+func (b *breaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return 0, false
+		}
+		b.setState(HalfOpen)
+		b.probing = true
+	case HalfOpen:
+		if b.probing {
+			return 0, false
+		}
+		b.probing = true
+	}
+	return b.gen, true
+}
+
+// done records the outcome of a request that allow let through under generation gen. A request that was let
+// through before the last change of state says nothing about the host since, so its outcome is ignored: a
+// slow success from before the circuit opened mustn't close it while the probe is still out.
+func (b *breaker) done(gen uint64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		return
+	}
+	if ok {
+		b.failures = 0
+		if b.state != Closed {
+			b.setState(Closed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.setState(Open)
+	}
+}
+
+func (b *breaker) current() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.clock.Now().Sub(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// abort releases a request that allow let through without recording an outcome, for requests the caller
+// cancelled.
+func (b *breaker) abort(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen == b.gen && b.state == HalfOpen {
+		b.probing = false
+	}
+}
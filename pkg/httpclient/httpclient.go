@@ -0,0 +1,342 @@
+// Package httpclient makes the HTTP Client example's requests resilient. Its Transport wraps another
+// http.RoundTripper and adds what http.Get leaves out: a timeout for each attempt, retries with exponential
+// backoff and jitter for idempotent requests that fail with a transient network error, such as a timeout or a
+// reset connection, or with a transient status such as 503, respect for the server's Retry-After header, and
+// a circuit breaker per host that stops sending requests to a host that keeps failing and lets a single probe
+// through once it has had time to recover.
+//
+//	client := httpclient.New(httpclient.WithTimeout(2*time.Second), httpclient.WithMaxRetries(3))
+//	resp, err := client.Get("http://gobyexample.com")
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// ErrCircuitOpen is returned, wrapped with the host name, for requests to a host whose circuit is open.
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+// Option configures a Transport.
+type Option func(*config)
+
+type config struct {
+	timeout      time.Duration
+	totalTimeout time.Duration
+	maxRetries   int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	retryStatus  map[int]bool
+	threshold    int
+	cooldown     time.Duration
+	clock        clock.Clock
+	rand         *rand.Rand
+}
+
+// WithTimeout limits each attempt, including reading the response body, to d. The default is no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithTotalTimeout sets the Timeout of the client returned by New, which covers every attempt and the waits
+// between them. The default is no limit.
+func WithTotalTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.totalTimeout = d
+	}
+}
+
+// WithMaxRetries sets how many times a failed idempotent request is retried. The default is 3; 0 disables
+// retries.
+func WithMaxRetries(n int) Option {
+	return func(c *config) {
+		c.maxRetries = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the most any delay can grow to. Each retry doubles
+// the delay, and a random jitter of up to half of it is taken off so that clients don't retry in lockstep.
+// The defaults are 100ms and 5s.
+func WithBackoff(base, max time.Duration) Option {
+	return func(c *config) {
+		c.baseDelay = base
+		c.maxDelay = max
+	}
+}
+
+// WithRetryStatus sets the response status codes that are retried. The default is 429, 500, 502, 503 and
+// 504.
+func WithRetryStatus(codes ...int) Option {
+	return func(c *config) {
+		c.retryStatus = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			c.retryStatus[code] = true
+		}
+	}
+}
+
+// WithBreaker sets how many consecutive failures open a host's circuit, and how long it stays open before
+// a probe is let through. A failure is a network error or a 5xx response. The defaults are 5 and 30s.
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *config) {
+		c.threshold = threshold
+		c.cooldown = cooldown
+	}
+}
+
+// WithClock sets the clock used for backoff waits, Retry-After dates and breaker cooldowns. The default is
+// the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithRand sets the source of randomness used for jitter, which lets tests make it repeatable.
+func WithRand(r *rand.Rand) Option {
+	return func(c *config) {
+		c.rand = r
+	}
+}
+
+// Transport is an http.RoundTripper that adds timeouts, retries and circuit breaking to another one. It is
+// safe for concurrent use.
+type Transport struct {
+	base http.RoundTripper
+	cfg  config
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	randMu   sync.Mutex
+}
+
+// NewTransport returns a Transport that sends requests through base, or http.DefaultTransport if base is
+// nil.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := config{
+		maxRetries: 3,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   5 * time.Second,
+		retryStatus: map[int]bool{
+			http.StatusTooManyRequests:     true,
+			http.StatusInternalServerError: true,
+			http.StatusBadGateway:          true,
+			http.StatusServiceUnavailable:  true,
+			http.StatusGatewayTimeout:      true,
+		},
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		clock:     clock.Real{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.rand == nil {
+		cfg.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &Transport{base: base, cfg: cfg, breakers: make(map[string]*breaker)}
+}
+
+// New returns an http.Client that uses a Transport built from opts on top of http.DefaultTransport.
+func New(opts ...Option) *http.Client {
+	t := NewTransport(nil, opts...)
+	return &http.Client{Transport: t, Timeout: t.cfg.totalTimeout}
+}
+
+// State returns the state of the circuit breaker for host, which is a host:port as found in URL.Host.
+func (t *Transport) State(host string) State {
+	t.mu.Lock()
+	b, ok := t.breakers[host]
+	t.mu.Unlock()
+	if !ok {
+		return Closed
+	}
+	return b.current()
+}
+
+func (t *Transport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{clock: t.cfg.clock, threshold: t.cfg.threshold, cooldown: t.cfg.cooldown}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// RoundTrip sends req, retrying it if it is idempotent and fails in a way that may be transient.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	b := t.breaker(req.URL.Host)
+	retry := t.cfg.maxRetries > 0 && idempotent(req) && rewindable(req)
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: rewinding body: %w", err)
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		gen, ok := b.allow()
+		if !ok {
+			if r.Body != nil {
+				r.Body.Close()
+			}
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, req.URL.Host)
+		}
+		resp, err := t.attempt(r)
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the host's health.
+			b.abort(gen)
+			return resp, err
+		}
+		if err != nil && !transient(err) {
+			// A bad certificate or a malformed request fails the same way every time, and says nothing about
+			// whether the host is up, so it is neither retried nor held against the host.
+			b.abort(gen)
+			return nil, err
+		}
+		b.done(gen, err == nil && resp.StatusCode < 500)
+
+		if !retry || attempt == t.cfg.maxRetries || (err == nil && !t.cfg.retryStatus[resp.StatusCode]) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			if d, ok := t.retryAfter(resp); ok && d > wait {
+				wait = d
+			}
+		}
+		// There is no point waiting past the caller's deadline; hand back what we have instead.
+		if deadline, ok := ctx.Deadline(); ok && t.cfg.clock.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain the body so the connection can be reused for the retry.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-t.cfg.clock.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt sends one request, bounded by the per-attempt timeout. The timeout's context stays alive until the
+// response body is closed, so the caller can still read it.
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	if t.cfg.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.cfg.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// backoff returns the delay before retry number attempt+1: the base delay doubled attempt times, capped at
+// the maximum, less a random jitter of up to half.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.cfg.baseDelay
+	for i := 0; i < attempt && d < t.cfg.maxDelay; i++ {
+		d *= 2
+	}
+	if d > t.cfg.maxDelay {
+		d = t.cfg.maxDelay
+	}
+	if half := int64(d / 2); half > 0 {
+		t.randMu.Lock()
+		d -= time.Duration(t.cfg.rand.Int63n(half + 1))
+		t.randMu.Unlock()
+	}
+	return d
+}
+
+// retryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date.
+func (t *Transport) retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		if d := when.Sub(t.cfg.clock.Now()); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// idempotent reports whether sending req twice has the same effect as sending it once, either because of its
+// method or because the caller marked it with an Idempotency-Key header.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// transient reports whether a transport error may go away if the request is sent again: a timeout, a refused,
+// reset or aborted connection, or a connection closed before the response was complete.
+func transient(err error) bool {
+	var ne net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &ne):
+		return ne.Timeout()
+	}
+	return false
+}
+
+// rewindable reports whether req's body can be sent again.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
@@ -0,0 +1,314 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// flaky returns a server that answers the first failures requests with status and the rest with 200 OK,
+// along with a count of the requests it has seen.
+func flaky(t *testing.T, failures int, status int) (*httptest.Server, *int64) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := atomic.AddInt64(&hits, 1); n <= int64(failures) {
+			http.Error(w, "try again", status)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func fast(opts ...Option) *http.Client {
+	opts = append([]Option{WithBackoff(time.Millisecond, 2*time.Millisecond), WithRand(rand.New(rand.NewSource(1)))}, opts...)
+	return New(opts...)
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		key        string
+		failures   int
+		status     int
+		wantStatus int
+		wantHits   int64
+	}{
+		{"recovers", http.MethodGet, "", 2, http.StatusServiceUnavailable, 200, 3},
+		{"gives up", http.MethodGet, "", 10, http.StatusBadGateway, http.StatusBadGateway, 4},
+		{"not retryable status", http.MethodGet, "", 1, http.StatusNotFound, http.StatusNotFound, 1},
+		{"post not retried", http.MethodPost, "", 1, http.StatusServiceUnavailable, http.StatusServiceUnavailable, 1},
+		{"post with idempotency key", http.MethodPost, "abc", 1, http.StatusServiceUnavailable, 200, 2},
+		{"put", http.MethodPut, "", 1, http.StatusServiceUnavailable, 200, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, hits := flaky(t, test.failures, test.status)
+			req, _ := http.NewRequest(test.method, srv.URL, strings.NewReader("payload"))
+			if test.key != "" {
+				req.Header.Set("Idempotency-Key", test.key)
+			}
+			resp, err := fast(WithMaxRetries(3)).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus || *hits != test.wantHits {
+				t.Errorf("got %d after %d requests, want %d after %d", resp.StatusCode, *hits, test.wantStatus, test.wantHits)
+			}
+		})
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if atomic.AddInt64(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	resp, err := fast().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("got bodies %q, want the payload sent twice", bodies)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	resp, err := fast(WithTimeout(50 * time.Millisecond)).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// The body must still be readable after RoundTrip returns; the attempt's context lives until Close.
+	if b, err := io.ReadAll(resp.Body); err != nil || string(b) != "ok" || atomic.LoadInt64(&hits) != 2 {
+		t.Errorf("got %q, %v after %d requests, want ok after 2", b, err, atomic.LoadInt64(&hits))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	fake := clock.NewFake(time.Unix(0, 0))
+	client := fast(WithClock(fake))
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	// The backoff alone would be a millisecond or two; the client must wait for the full two seconds.
+	fake.BlockUntil(1)
+	fake.Advance(1999 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("retried before Retry-After elapsed (err %v)", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	fake.Advance(time.Millisecond)
+	if err := <-done; err != nil || atomic.LoadInt64(&hits) != 2 {
+		t.Errorf("got %v after %d requests, want success after 2", err, atomic.LoadInt64(&hits))
+	}
+}
+
+// failing is a transport whose every request fails with err.
+type failing struct {
+	err   error
+	calls int
+}
+
+func (f *failing) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func TestPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+		state State
+	}{
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, 3, Open},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, 3, Open},
+		{"EOF", io.EOF, 3, Open},
+		{"timeout", context.DeadlineExceeded, 3, Open},
+		{"unknown authority", x509.UnknownAuthorityError{}, 1, Closed},
+		{"bad host name", x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}, 1, Closed},
+		{"unsupported scheme", errors.New(`unsupported protocol scheme "ftp"`), 1, Closed},
+	}
+	for _, tt := range tests {
+		base := &failing{err: tt.err}
+		tr := NewTransport(base, WithMaxRetries(2), WithBackoff(time.Microsecond, time.Microsecond), WithBreaker(3, time.Minute))
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if _, err := tr.RoundTrip(req); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		if base.calls != tt.calls || tr.State("example.com") != tt.state {
+			t.Errorf("%s: got %d attempts and state %v, want %d and %v", tt.name, base.calls, tr.State("example.com"), tt.calls, tt.state)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy, hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if atomic.LoadInt64(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	host := mustParse(t, srv.URL).Host
+
+	fake := clock.NewFake(time.Unix(0, 0))
+	tr := NewTransport(nil, WithMaxRetries(0), WithBreaker(3, time.Minute), WithClock(fake))
+	client := &http.Client{Transport: tr}
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := tr.State(host); s != Open {
+		t.Fatalf("got state %v after 3 failures, want %v", s, Open)
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || atomic.LoadInt64(&hits) != 3 {
+		t.Errorf("got %v after %d requests, want %v without a request", err, atomic.LoadInt64(&hits), ErrCircuitOpen)
+	}
+
+	// After the cooldown a failing probe opens the circuit again.
+	fake.Advance(time.Minute)
+	if s := tr.State(host); s != HalfOpen {
+		t.Errorf("got state %v after the cooldown, want %v", s, HalfOpen)
+	}
+	get()
+	if s := tr.State(host); s != Open || atomic.LoadInt64(&hits) != 4 {
+		t.Errorf("got state %v after %d requests, want %v after a failed probe", s, atomic.LoadInt64(&hits), Open)
+	}
+
+	// A successful probe closes it.
+	fake.Advance(time.Minute)
+	atomic.StoreInt64(&healthy, 1)
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if s := tr.State(host); s != Closed {
+		t.Errorf("got state %v after a good probe, want %v", s, Closed)
+	}
+}
+
+func TestBreakerIgnoresStaleOutcomes(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	b := &breaker{clock: fake, threshold: 1, cooldown: time.Minute}
+
+	slow, _ := b.allow()
+	failed, _ := b.allow()
+	b.done(failed, false)
+	fake.Advance(time.Minute)
+	probe, ok := b.allow()
+	if !ok {
+		t.Fatal("the probe wasn't let through after the cooldown")
+	}
+
+	// The slow request was sent before the circuit opened; its success doesn't close it under the probe.
+	b.done(slow, true)
+	if b.current() != HalfOpen {
+		t.Errorf("got state %v after a stale success, want %v", b.current(), HalfOpen)
+	}
+	if _, ok := b.allow(); ok {
+		t.Error("a second request was let through while the probe was out")
+	}
+	b.abort(slow)
+	if _, ok := b.allow(); ok {
+		t.Error("a stale abort released the probe")
+	}
+	b.done(probe, false)
+	if b.current() != Open {
+		t.Errorf("got state %v after a failed probe, want %v", b.current(), Open)
+	}
+}
+
+func TestCancelledRequestDoesNotTripBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	tr := NewTransport(nil, WithBreaker(1, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("request succeeded after its context expired")
+	}
+	if s := tr.State(mustParse(t, srv.URL).Host); s != Closed {
+		t.Errorf("got state %v, want %v", s, Closed)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
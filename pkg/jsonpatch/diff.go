@@ -0,0 +1,128 @@
+package jsonpatch
+
+import (
+	"sort"
+	"strconv"
+)
+
+// maxDiffCells bounds the table used to align two arrays. Arrays whose differing middles are larger than
+// that are replaced whole rather than aligned element by element.
+const maxDiffCells = 1 << 20
+
+// Diff returns a patch that turns a into b. It touches only what differs: objects are compared member by
+// member and arrays element by element, so a change deep inside a document becomes one operation on that
+// value. Elements are added to or removed from arrays where that takes fewer operations than replacing them.
+func Diff(a, b interface{}) Patch {
+	var p Patch
+	diff("", a, b, &p)
+	return p
+}
+
+func diff(path string, a, b interface{}, p *Patch) {
+	if Equal(a, b) {
+		return
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			diffObjects(path, a, b, p)
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			diffArrays(path, a, b, p)
+			return
+		}
+	}
+	*p = append(*p, Operation{Op: "replace", Path: path, Value: b})
+}
+
+func diffObjects(path string, a, b map[string]interface{}, p *Patch) {
+	for _, k := range sortedKeys(a) {
+		if _, ok := b[k]; !ok {
+			*p = append(*p, Operation{Op: "remove", Path: appendPointer(path, k)})
+		}
+	}
+	for _, k := range sortedKeys(b) {
+		if v, ok := a[k]; ok {
+			diff(appendPointer(path, k), v, b[k], p)
+		} else {
+			*p = append(*p, Operation{Op: "add", Path: appendPointer(path, k), Value: b[k]})
+		}
+	}
+}
+
+// diffArrays finds the fewest insertions, deletions and substitutions that turn a into b, the edit distance,
+// with a table over the elements that differ after any common prefix and suffix are set aside.
+func diffArrays(path string, a, b []interface{}, p *Patch) {
+	start := 0
+	for start < len(a) && start < len(b) && Equal(a[start], b[start]) {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && Equal(a[len(a)-1-end], b[len(b)-1-end]) {
+		end++
+	}
+	x, y := a[start:len(a)-end], b[start:len(b)-end]
+	if (len(x)+1)*(len(y)+1) > maxDiffCells {
+		*p = append(*p, Operation{Op: "replace", Path: path, Value: b})
+		return
+	}
+
+	// dist[i][j] is the number of edits that turn x[i:] into y[j:].
+	dist := make([][]int, len(x)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(y)+1)
+		dist[i][len(y)] = len(x) - i
+	}
+	for j := range y {
+		dist[len(x)][j] = len(y) - j
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if Equal(x[i], y[j]) {
+				dist[i][j] = dist[i+1][j+1]
+			} else {
+				dist[i][j] = 1 + min(dist[i+1][j+1], min(dist[i+1][j], dist[i][j+1]))
+			}
+		}
+	}
+
+	// Walk the table from the front. Each operation sees the array as the earlier ones left it, so at is the
+	// index in that array of the next element of x. Where removing or adding an element costs no more than
+	// replacing one, that is preferred: the diff reads as the element having moved rather than as every
+	// element between changing.
+	i, j, at := 0, 0, start
+	for i < len(x) || j < len(y) {
+		elem := appendPointer(path, strconv.Itoa(at))
+		switch {
+		case i < len(x) && j < len(y) && Equal(x[i], y[j]):
+			i, j, at = i+1, j+1, at+1
+		case i < len(x) && dist[i][j] == 1+dist[i+1][j]:
+			*p = append(*p, Operation{Op: "remove", Path: elem})
+			i++
+		case j < len(y) && dist[i][j] == 1+dist[i][j+1]:
+			*p = append(*p, Operation{Op: "add", Path: elem, Value: y[j]})
+			j, at = j+1, at+1
+		default:
+			diff(elem, x[i], y[j], p)
+			i, j, at = i+1, j+1, at+1
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
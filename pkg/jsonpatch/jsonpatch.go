@@ -0,0 +1,404 @@
+// Package jsonpatch describes and applies changes to JSON documents, so a change to a configuration shaped
+// like the JSON example's response2 struct can be shipped without sending the whole document again.
+//
+// A Patch is an RFC 6902 JSON Patch: a list of operations (add, remove, replace, move, copy and test), each
+// naming the value it works on with an RFC 6901 JSON Pointer such as /fruits/0. Diff computes a patch that
+// turns one document into another, and Apply applies one, all or nothing. RFC 7396 merge patches are
+// supported too: they are simpler, a partial document in which null means "delete", but can't express every
+// change. See MergePatch and CreateMergePatch.
+//
+// Documents are decoded JSON as json.Unmarshal produces it for an interface{}. Numbers may be float64 or
+// json.Number, and compare equal when their values are.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrTestFailed is returned when a test operation finds a different value.
+	ErrTestFailed = errors.New("jsonpatch: test failed")
+	// ErrNotFound is returned when a path names a value that doesn't exist.
+	ErrNotFound = errors.New("jsonpatch: path not found")
+	// ErrInvalidPath is returned for a path that isn't a JSON Pointer, or an array index that is out of range.
+	ErrInvalidPath = errors.New("jsonpatch: invalid path")
+	// ErrInvalidOp is returned for an unknown operation or one that is missing a member it needs.
+	ErrInvalidOp = errors.New("jsonpatch: invalid operation")
+)
+
+// Operation is one step of a Patch. Value is used by add, replace and test, and From by move and copy.
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// MarshalJSON implements json.Marshaler. Value is written for the operations that use it, even when it is
+// null.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Op    string       `json:"op"`
+		Path  string       `json:"path"`
+		From  string       `json:"from,omitempty"`
+		Value *interface{} `json:"value,omitempty"`
+	}{Op: o.Op, Path: o.Path, From: o.From}
+	if o.Op == "add" || o.Op == "replace" || o.Op == "test" {
+		out.Value = &o.Value
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Numbers in Value are decoded as json.Number.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var in struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*o = Operation{Op: in.Op}
+	switch {
+	case in.Path == nil:
+		return fmt.Errorf("%w: %s has no path", ErrInvalidOp, in.Op)
+	case (in.Op == "move" || in.Op == "copy") && in.From == nil:
+		return fmt.Errorf("%w: %s has no from", ErrInvalidOp, in.Op)
+	case (in.Op == "add" || in.Op == "replace" || in.Op == "test") && in.Value == nil:
+		return fmt.Errorf("%w: %s has no value", ErrInvalidOp, in.Op)
+	}
+	o.Path = *in.Path
+	if in.From != nil {
+		o.From = *in.From
+	}
+	if in.Value != nil {
+		return decode(in.Value, &o.Value)
+	}
+	return nil
+}
+
+func decode(data []byte, v *interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Patch is an RFC 6902 JSON Patch. It encodes to and decodes from the standard JSON form.
+type Patch []Operation
+
+// OpError reports the operation that made Apply fail.
+type OpError struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	Op    Operation
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("%v (operation %d, %s %s)", e.Err, e.Index, e.Op.Op, e.Op.Path)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Apply returns doc with the patch applied. Patches are atomic: if any operation fails, including a test, the
+// error is an *OpError and doc is left as it was. doc itself is never modified; the result is a copy.
+func Apply(doc interface{}, patch Patch) (interface{}, error) {
+	doc = deepCopy(doc)
+	for i, op := range patch {
+		var err error
+		if doc, err = apply(doc, op); err != nil {
+			return nil, &OpError{Index: i, Op: op, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+// ApplyOp applies a single operation to doc in place and returns the result, which only differs from doc when
+// the operation replaces the whole document. It doesn't copy doc first, so walking a long patch one operation
+// at a time costs no more than applying it with Apply, but unlike Apply a failed operation may leave doc part
+// way changed. Values the operation adds are still copied, so op can be reused.
+func ApplyOp(doc interface{}, op Operation) (interface{}, error) {
+	return apply(doc, op)
+}
+
+func apply(doc interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return add(doc, path, deepCopy(op.Value))
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		return replace(doc, path, deepCopy(op.Value))
+	case "test":
+		v, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(v, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == "copy" {
+			v, err = get(doc, from)
+			v = deepCopy(v)
+		} else if op.Path == op.From {
+			return doc, nil
+		} else if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: can't move %s into itself", ErrInvalidOp, op.From)
+		} else {
+			doc, v, err = remove(doc, from)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidOp, op.Op)
+}
+
+// Get returns the value at a JSON Pointer in doc.
+func Get(doc interface{}, pointer string) (interface{}, error) {
+	path, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return get(doc, path)
+}
+
+func get(v interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = c[tok]; !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrNotFound, tok)
+			}
+		case []interface{}:
+			i, err := index(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			v = c[i]
+		default:
+			return nil, fmt.Errorf("%w: %q in a %s", ErrNotFound, tok, kind(v))
+		}
+	}
+	return v, nil
+}
+
+// modify calls fn with the object or array holding the last value in path and stores the container fn
+// returns in its place, since changing an array's length makes a new slice.
+func modify(v interface{}, path []string, fn func(parent interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(v, path[0])
+	}
+	switch c := v.(type) {
+	case map[string]interface{}:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: no member %q", ErrNotFound, path[0])
+		}
+		child, err := modify(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = child
+		return c, nil
+	case []interface{}:
+		i, err := index(path[0], len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		if c[i], err = modify(c[i], path[1:], fn); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %q in a %s", ErrNotFound, path[0], kind(v))
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modify(doc, path, func(parent interface{}, tok string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			c[tok] = value
+			return c, nil
+		case []interface{}:
+			i, err := index(tok, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("%w: can't add %q to a %s", ErrNotFound, tok, kind(parent))
+	})
+}
+
+// remove returns doc without the value at path, and the value.
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: can't remove the whole document", ErrInvalidOp)
+	}
+	var removed interface{}
+	doc, err := modify(doc, path, func(parent interface{}, tok string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrNotFound, tok)
+			}
+			removed = v
+			delete(c, tok)
+			return c, nil
+		case []interface{}:
+			i, err := index(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %q in a %s", ErrNotFound, tok, kind(parent))
+	})
+	return doc, removed, err
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modify(doc, path, func(parent interface{}, tok string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := c[tok]; !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrNotFound, tok)
+			}
+			c[tok] = value
+			return c, nil
+		case []interface{}:
+			i, err := index(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("%w: %q in a %s", ErrNotFound, tok, kind(parent))
+	})
+}
+
+// Equal reports whether two decoded JSON values are equal. Numbers are equal when their values are, and
+// objects when they have the same members, in any order.
+func Equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !Equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = deepCopy(e)
+		}
+		return a
+	}
+	return v
+}
+
+// kind names the JSON type of v for error messages.
+func kind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
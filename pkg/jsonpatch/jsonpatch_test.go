@@ -0,0 +1,189 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func decodeString(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := decode([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	return v
+}
+
+func encode(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		// Examples from RFC 6902, appendix A.
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"foo":1}`, `[{"op":"test","path":"/foo","value":1.0}]`, `{"foo":1}`},
+		{`{"foo":1}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"bar":1,"foo":1}`},
+		{`{"foo":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, tt := range tests {
+		var patch Patch
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatalf("%s: %v", tt.patch, err)
+		}
+		got, err := Apply(decodeString(t, tt.doc), patch)
+		if err != nil {
+			t.Errorf("%s to %s: %v", tt.patch, tt.doc, err)
+		} else if encode(got) != tt.want {
+			t.Errorf("%s to %s: got %s, want %s", tt.patch, tt.doc, encode(got), tt.want)
+		}
+	}
+}
+
+func TestApplyOp(t *testing.T) {
+	doc := decodeString(t, `{"page":1,"fruits":["apple","peach"]}`)
+	value := []interface{}{"fig"}
+	got, err := ApplyOp(doc, Operation{Op: "add", Path: "/nuts", Value: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The document is changed where it is rather than copied...
+	if want := `{"fruits":["apple","peach"],"nuts":["fig"],"page":1}`; encode(doc) != want || encode(got) != want {
+		t.Errorf("got %s with the document now %s, want both %s", encode(got), encode(doc), want)
+	}
+	// ...but the added value is a copy of the operation's.
+	value[0] = "kiwi"
+	if v, _ := Get(doc, "/nuts/0"); v != "fig" {
+		t.Errorf("got /nuts/0 = %v after changing the operation, want fig", v)
+	}
+	if _, err := ApplyOp(doc, Operation{Op: "remove", Path: "/seeds"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		patch string
+		index int
+		err   error
+	}{
+		{`[{"op":"test","path":"/page","value":2}]`, 0, ErrTestFailed},
+		{`[{"op":"test","path":"/fruits","value":["apple"]}]`, 0, ErrTestFailed},
+		{`[{"op":"add","path":"/page","value":5},{"op":"remove","path":"/nuts"}]`, 1, ErrNotFound},
+		{`[{"op":"replace","path":"/fruits/2","value":"fig"}]`, 0, ErrInvalidPath},
+		{`[{"op":"add","path":"/fruits/01","value":"fig"}]`, 0, ErrInvalidPath},
+		{`[{"op":"add","path":"fruits","value":"fig"}]`, 0, ErrInvalidPath},
+		{`[{"op":"remove","path":"/page/x"}]`, 0, ErrNotFound},
+		{`[{"op":"move","from":"/fruits","path":"/fruits/0"}]`, 0, ErrInvalidOp},
+		{`[{"op":"frobnicate","path":"/page"}]`, 0, ErrInvalidOp},
+	}
+	doc := decodeString(t, `{"page":1,"fruits":["apple","peach"]}`)
+	for _, tt := range tests {
+		var patch Patch
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatalf("%s: %v", tt.patch, err)
+		}
+		_, err := Apply(doc, patch)
+		var opErr *OpError
+		if !errors.As(err, &opErr) || opErr.Index != tt.index || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v from operation %d", tt.patch, err, tt.err, tt.index)
+		}
+	}
+	// A failed patch leaves the document as it was, even when earlier operations succeeded.
+	if got := encode(doc); got != `{"fruits":["apple","peach"],"page":1}` {
+		t.Errorf("document changed to %s", got)
+	}
+
+	for _, bad := range []string{`{"op":"add","path":"/a"}`, `{"op":"remove"}`, `{"op":"move","path":"/a"}`} {
+		var op Operation
+		if err := json.Unmarshal([]byte(bad), &op); !errors.Is(err, ErrInvalidOp) {
+			t.Errorf("%s: got %v, want ErrInvalidOp", bad, err)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{`{"page":1,"fruits":["apple"]}`, `{"page":1,"fruits":["apple"]}`, `null`},
+		{`{"page":1}`, `{"page":2}`, `[{"op":"replace","path":"/page","value":2}]`},
+		{`{"page":1,"old":true}`, `{"page":1,"new":null}`, `[{"op":"remove","path":"/old"},{"op":"add","path":"/new","value":null}]`},
+		{`{"a/b":{"c~d":1}}`, `{"a/b":{"c~d":2}}`, `[{"op":"replace","path":"/a~1b/c~0d","value":2}]`},
+		{`["a","b","c","d"]`, `["a","c","d"]`, `[{"op":"remove","path":"/1"}]`},
+		{`["a","c"]`, `["a","b","c","x"]`, `[{"op":"add","path":"/1","value":"b"},{"op":"add","path":"/3","value":"x"}]`},
+		{`["a","b","c"]`, `["a","x","c"]`, `[{"op":"replace","path":"/1","value":"x"}]`},
+		{`["apple","peach","pear"]`, `["apple","pear","plum"]`, `[{"op":"remove","path":"/1"},{"op":"add","path":"/2","value":"plum"}]`},
+		{`["a","b","c","d"]`, `["b","c","e"]`, `[{"op":"remove","path":"/0"},{"op":"replace","path":"/2","value":"e"}]`},
+		{`[{"qty":1},{"qty":2}]`, `[{"qty":1},{"qty":3}]`, `[{"op":"replace","path":"/1/qty","value":3}]`},
+		{`{"a":[1]}`, `{"a":{"0":1}}`, `[{"op":"replace","path":"/a","value":{"0":1}}]`},
+		{`1`, `"one"`, `[{"op":"replace","path":"","value":"one"}]`},
+	}
+	for _, tt := range tests {
+		a, b := decodeString(t, tt.a), decodeString(t, tt.b)
+		patch := Diff(a, b)
+		if got := encode(patch); got != tt.want {
+			t.Errorf("%s to %s: got %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+		got, err := Apply(a, patch)
+		if err != nil || !Equal(got, b) {
+			t.Errorf("%s to %s: applying the diff gave %s, %v", tt.a, tt.b, encode(got), err)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A.
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		doc := decodeString(t, tt.doc)
+		if got := encode(MergePatch(doc, decodeString(t, tt.patch))); got != tt.want {
+			t.Errorf("%s to %s: got %s, want %s", tt.patch, tt.doc, got, tt.want)
+		}
+	}
+
+	a := decodeString(t, `{"page":1,"fruits":["apple","peach"],"meta":{"owner":"ann","tags":["x"]}}`)
+	b := decodeString(t, `{"page":2,"fruits":["apple"],"meta":{"owner":"ann"}}`)
+	patch := CreateMergePatch(a, b)
+	if got, want := encode(patch), `{"fruits":["apple"],"meta":{"tags":null},"page":2}`; got != want {
+		t.Errorf("got merge patch %s, want %s", got, want)
+	}
+	if got := MergePatch(a, patch); !Equal(got, b) {
+		t.Errorf("applying the merge patch gave %s", encode(got))
+	}
+}
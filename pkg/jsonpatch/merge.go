@@ -0,0 +1,48 @@
+package jsonpatch
+
+// MergePatch returns doc with an RFC 7396 merge patch applied. A patch that is an object changes only the
+// members it names: null removes a member, an object is merged into the member recursively, and any other
+// value replaces it. A patch that isn't an object replaces the whole document. doc is not modified.
+func MergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+	target, ok := doc.(map[string]interface{})
+	if ok {
+		target = deepCopy(target).(map[string]interface{})
+	} else {
+		target = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(target, k)
+		} else {
+			target[k] = MergePatch(target[k], v)
+		}
+	}
+	return target
+}
+
+// CreateMergePatch returns a merge patch that turns a into b. Merge patches can't set a member to null, since
+// null means removal, or change part of an array, so a null in b is left out and a changed array is replaced
+// whole. Use Diff where that matters.
+func CreateMergePatch(a, b interface{}) interface{} {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		return deepCopy(b)
+	}
+	patch := map[string]interface{}{}
+	for k := range am {
+		if _, ok := bm[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, v := range bm {
+		if old, ok := am[k]; v != nil && (!ok || !Equal(old, v)) {
+			patch[k] = CreateMergePatch(old, v)
+		}
+	}
+	return patch
+}
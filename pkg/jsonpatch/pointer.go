@@ -0,0 +1,54 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	unescaper = strings.NewReplacer("~1", "/", "~0", "~")
+	escaper   = strings.NewReplacer("~", "~0", "/", "~1")
+)
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens. The empty pointer is the
+// whole document.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("%w: %q doesn't start with /", ErrInvalidPath, p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, fmt.Errorf("%w: bad escape in %q", ErrInvalidPath, p)
+			}
+		}
+		tokens[i] = unescaper.Replace(tok)
+	}
+	return tokens, nil
+}
+
+// appendPointer returns the pointer to the member or element tok of the value at p.
+func appendPointer(p, tok string) string {
+	return p + "/" + escaper.Replace(tok)
+}
+
+// index parses an array index token for an array of length n. With end, the index may also be n, written
+// as a number or as "-", to add a new last element.
+func index(tok string, n int, end bool) (int, error) {
+	if tok == "-" && end {
+		return n, nil
+	}
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') || strings.TrimLeft(tok, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPath, tok)
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i > n || (i == n && !end) {
+		return 0, fmt.Errorf("%w: index %s out of range for %d elements", ErrInvalidPath, tok, n)
+	}
+	return i, nil
+}
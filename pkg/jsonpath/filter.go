@@ -0,0 +1,185 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// expr is a filter expression.
+type expr interface {
+	test(current, root interface{}) (bool, error)
+}
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) test(current, root interface{}) (bool, error) {
+	ok, err := e.left.test(current, root)
+	if err != nil || ok {
+		return ok, err
+	}
+	return e.right.test(current, root)
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) test(current, root interface{}) (bool, error) {
+	ok, err := e.left.test(current, root)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return e.right.test(current, root)
+}
+
+type notExpr struct{ expr expr }
+
+func (e notExpr) test(current, root interface{}) (bool, error) {
+	ok, err := e.expr.test(current, root)
+	return !ok, err
+}
+
+// existsExpr is true when its query matches anything, even a null.
+type existsExpr struct{ query query }
+
+func (e existsExpr) test(current, root interface{}) (bool, error) {
+	nodes, err := e.query.eval(current, root)
+	return len(nodes) > 0, err
+}
+
+// operand is one side of a comparison. value reports false when there is nothing to compare: a query that
+// matches no values, or more than one.
+type operand interface {
+	value(current, root interface{}) (interface{}, bool, error)
+}
+
+type literal struct{ v interface{} }
+
+func (l literal) value(current, root interface{}) (interface{}, bool, error) {
+	return l.v, true, nil
+}
+
+// query is a path inside a filter, starting at the value being tested (@) or at the root ($).
+type query struct {
+	relative bool
+	segments []segment
+}
+
+func (q query) eval(current, root interface{}) ([]interface{}, error) {
+	if q.relative {
+		return eval(q.segments, current, root)
+	}
+	return eval(q.segments, root, root)
+}
+
+func (q query) value(current, root interface{}) (interface{}, bool, error) {
+	nodes, err := q.eval(current, root)
+	if err != nil || len(nodes) != 1 {
+		return nil, false, err
+	}
+	return nodes[0], true, nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e compareExpr) test(current, root interface{}) (bool, error) {
+	l, lok, err := e.left.value(current, root)
+	if err != nil {
+		return false, err
+	}
+	r, rok, err := e.right.value(current, root)
+	if err != nil {
+		return false, err
+	}
+	// A query can match a value of any type, and equal would panic comparing two that aren't comparable.
+	for _, v := range []interface{}{l, r} {
+		if err := check(v); err != nil {
+			return false, err
+		}
+	}
+	// Nothing equals only nothing, and is neither less nor greater than anything.
+	if !lok || !rok {
+		switch e.op {
+		case "==", "<=", ">=":
+			return !lok && !rok, nil
+		case "!=":
+			return lok != rok, nil
+		}
+		return false, nil
+	}
+	switch e.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<":
+		return less(l, r), nil
+	case "<=":
+		return less(l, r) || equal(l, r), nil
+	case ">":
+		return less(r, l), nil
+	case ">=":
+		return less(r, l) || equal(l, r), nil
+	}
+	return false, nil
+}
+
+// number returns v as a float64 if it is a JSON number.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// equal compares JSON values, with numbers equal when their values are, however they were decoded.
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && a == b
+}
+
+// less orders two numbers or two strings. Any other values are unordered.
+func less(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x < y
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		return ok && x < y
+	}
+	return false
+}
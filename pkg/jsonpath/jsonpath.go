@@ -0,0 +1,279 @@
+// Package jsonpath queries decoded JSON with JSONPath expressions, so code like the JSON example can pull
+// values out of a map[string]interface{} without a chain of type assertions that panics as soon as the
+// document has an unexpected shape. A query that doesn't fit the document simply matches nothing.
+//
+// The syntax is the core of RFC 9535:
+//
+//	$                     the root value, which may be left out before . or ..
+//	.name  ['name']       an object member
+//	.*  [*]               every member of an object or element of an array
+//	[0]  [-1]             an array element, counting from the end if negative
+//	[1:3]  [::2]          a slice of an array, as start:end:step
+//	[0,'a']               several selectors at once
+//	..name  ..*  ..[0]    the same selectors applied to a value and everything nested in it
+//	[?(@.qty > 2)]        members or elements for which a filter expression is true
+//
+// In a filter, @ is the member or element being tested and $ is the root. Queries can be compared with
+// ==, !=, <, <=, > and >= against each other or against numbers, strings, true, false and null, and
+// combined with &&, || and !. A query on its own tests whether it matches anything, so [?(@.price)] keeps
+// what has a price. A query compared with something must match exactly one value to be equal to it.
+//
+// Object members are visited in the order of their sorted keys, since Go maps have no order of their own.
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SyntaxError reports an expression that couldn't be parsed.
+type SyntaxError struct {
+	Expr string
+	// Offset is the byte offset in Expr where the problem was found.
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("jsonpath: %s at offset %d in %q", e.Msg, e.Offset, e.Expr)
+}
+
+// TypeError reports a value in the queried document that isn't one encoding/json decodes into an
+// interface{}, such as a struct.
+type TypeError struct {
+	Value interface{}
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("jsonpath: can't query a value of type %T", e.Value)
+}
+
+// Path is a compiled JSONPath expression. It is safe for concurrent use.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Compile parses a JSONPath expression. The error is a *SyntaxError.
+func Compile(expr string) (*Path, error) {
+	p := &parser{expr: expr}
+	segments, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Path{expr: expr, segments: segments}, nil
+}
+
+// Query compiles expr and evaluates it against doc.
+func Query(expr string, doc interface{}) ([]interface{}, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Eval(doc)
+}
+
+// String returns the expression the Path was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Eval returns the values in doc that the path selects, in document order, or an empty slice if it selects
+// none. doc holds what json.Unmarshal decodes into an interface{}: maps, slices, strings, float64 or
+// json.Number, bools and nil. Values of any other type make Eval return a *TypeError.
+func (p *Path) Eval(doc interface{}) ([]interface{}, error) {
+	return eval(p.segments, doc, doc)
+}
+
+// segment is one step of a path. A descendant segment applies its selectors to the value and to everything
+// nested in it; otherwise they apply to the value alone.
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+// selector picks values out of one value and appends them to out.
+type selector interface {
+	apply(v, root interface{}, out []interface{}) ([]interface{}, error)
+}
+
+func eval(segments []segment, v, root interface{}) ([]interface{}, error) {
+	nodes := []interface{}{v}
+	for _, seg := range segments {
+		var next []interface{}
+		for _, n := range nodes {
+			var err error
+			if next, err = seg.apply(n, root, next); err != nil {
+				return nil, err
+			}
+		}
+		nodes = next
+	}
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return nodes, nil
+}
+
+func (s segment) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	var err error
+	for _, sel := range s.selectors {
+		if out, err = sel.apply(v, root, out); err != nil {
+			return nil, err
+		}
+	}
+	if !s.descendant {
+		return out, nil
+	}
+	children, err := children(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		if out, err = s.apply(c, root, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// children returns the members of an object, in key order, or the elements of an array.
+func children(v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var out []interface{}
+		for _, k := range sortedKeys(v) {
+			out = append(out, v[k])
+		}
+		return out, nil
+	case []interface{}:
+		return v, nil
+	}
+	return nil, check(v)
+}
+
+// check returns a *TypeError unless v is a JSON value.
+func check(v interface{}) error {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}, string, float64, json.Number, bool, nil:
+		return nil
+	}
+	return &TypeError{Value: v}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type nameSelector string
+
+func (s nameSelector) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		if c, ok := m[string(s)]; ok {
+			return append(out, c), nil
+		}
+		return out, nil
+	}
+	return out, check(v)
+}
+
+type wildcardSelector struct{}
+
+func (wildcardSelector) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	c, err := children(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, c...), nil
+}
+
+type indexSelector int
+
+func (s indexSelector) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return out, check(v)
+	}
+	i := int(s)
+	if i < 0 {
+		i += len(a)
+	}
+	if i < 0 || i >= len(a) {
+		return out, nil
+	}
+	return append(out, a[i]), nil
+}
+
+// sliceSelector selects array elements from start up to but not including end, step elements apart. Missing
+// bounds default to the whole array in the direction of step.
+type sliceSelector struct {
+	start, end *int
+	step       int
+}
+
+func (s sliceSelector) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return out, check(v)
+	}
+	n := len(a)
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		return i
+	}
+	if s.step > 0 {
+		start, end := clamp(bound(s.start, 0), 0, n), clamp(bound(s.end, n), 0, n)
+		for i := start; i < end; i += s.step {
+			out = append(out, a[i])
+		}
+	} else if s.step < 0 {
+		start, end := clamp(bound(s.start, n-1), -1, n-1), clamp(bound(s.end, -n-1), -1, n-1)
+		for i := start; i > end; i += s.step {
+			out = append(out, a[i])
+		}
+	}
+	return out, nil
+}
+
+func clamp(i, lo, hi int) int {
+	if i < lo {
+		return lo
+	} else if i > hi {
+		return hi
+	}
+	return i
+}
+
+// filterSelector selects the members or elements for which expr is true.
+type filterSelector struct {
+	expr expr
+}
+
+func (s filterSelector) apply(v, root interface{}, out []interface{}) ([]interface{}, error) {
+	c, err := children(v)
+	if err != nil || c == nil {
+		return out, err
+	}
+	for _, child := range c {
+		ok, err := s.expr.test(child, root)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, child)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,146 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const store = `{
+	"name": "corner shop",
+	"items": [
+		{"name": "apple", "qty": 5, "price": 0.5, "tags": ["fruit"]},
+		{"name": "bread", "qty": 1, "price": 2.25},
+		{"name": "cheese", "qty": 3, "price": 7, "tags": ["dairy", "deli"]},
+		{"name": "pear", "qty": 0}
+	],
+	"delivery": {"price": 4, "free over": 20}
+}`
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEval(t *testing.T) {
+	doc := decode(t, store)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`$.delivery`, `[{"free over":20,"price":4}]`},
+		{`$.name`, `["corner shop"]`},
+		{`$['name']`, `["corner shop"]`},
+		{`$.items[*].name`, `["apple","bread","cheese","pear"]`},
+		{`$.items[0].name`, `["apple"]`},
+		{`$.items[-1].name`, `["pear"]`},
+		{`$.items[9].name`, `[]`},
+		{`$.items[1:3].name`, `["bread","cheese"]`},
+		{`$.items[::-2].name`, `["pear","bread"]`},
+		{`$.items[:-3].name`, `["apple"]`},
+		{`$.items[0,2]['name', "qty"]`, `["apple",5,"cheese",3]`},
+		{`$.delivery['free over']`, `[20]`},
+		{`$.delivery.*`, `[20,4]`},
+		{`$..price`, `[4,0.5,2.25,7]`},
+		{`$..tags[0]`, `["fruit","dairy"]`},
+		{`$..[?(@.qty > 2)].name`, `["apple","cheese"]`},
+		{`$.items[?(@.qty > 2)].name`, `["apple","cheese"]`},
+		{`$.items[?@.qty>2 && @.price<1].name`, `["apple"]`},
+		{`$.items[?(@.qty == 0 || @.name == 'bread')].name`, `["bread","pear"]`},
+		{`$.items[?(@.price)].name`, `["apple","bread","cheese"]`},
+		{`$.items[?(!@.price)].name`, `["pear"]`},
+		{`$.items[?(@.price >= $.delivery.price)].name`, `["cheese"]`},
+		{`$.items[?(@.tags[0] == "dairy")].name`, `["cheese"]`},
+		{`$.items[?(@.tags == null)].name`, `[]`},
+		{`$.items[?(@.missing == @.alsoMissing)].name`, `["apple","bread","cheese","pear"]`},
+		{`$.items[?(@.name < "c")].name`, `["apple","bread"]`},
+		{`$.items[?(@.name > 1)].name`, `[]`},
+		{`$.items[?(@..deli)]`, `[]`},
+		{`$.name.first`, `[]`},
+		{`$.name[0]`, `[]`},
+		{`$.items.name`, `[]`},
+		{`..price`, `[4,0.5,2.25,7]`},
+		{`.name`, `["corner shop"]`},
+	}
+	for _, tt := range tests {
+		got, err := Query(tt.expr, doc)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		b, _ := json.Marshal(got)
+		if string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.expr, b, tt.want)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`[{"id": 12345678901234567890, "n": 2}, {"id": 1, "n": 2.0}]`))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Query(`$[?(@.n == 2 && @.id > 100)].id`, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != json.Number("12345678901234567890") {
+		t.Errorf("got %v, want the large id as it was", got)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		offset int
+		msg    string
+	}{
+		{`items`, 0, "expected $ or . at the start of the path"},
+		{`$.`, 2, "expected a member name or *"},
+		{`$.items[`, 8, "expected a selector"},
+		{`$.items[0`, 9, "expected , or ]"},
+		{`$.items[1:2:3:4]`, 13, "expected , or ]"},
+		{`$['name`, 7, "unterminated string"},
+		{`$['\x']`, 3, "invalid escape"},
+		{`$.items[?(@.qty > )]`, 18, "expected @, $ or a literal"},
+		{`$.items[?(@.qty > 2]`, 19, "expected )"},
+		{`$.items[?(2)]`, 10, "expected a comparison after a literal"},
+		{`$.items]`, 7, `unexpected "]"`},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("%s: got %v, want a *SyntaxError", tt.expr, err)
+			continue
+		}
+		if serr.Offset != tt.offset || serr.Msg != tt.msg {
+			t.Errorf("%s: got %q at %d, want %q at %d", tt.expr, serr.Msg, serr.Offset, tt.msg, tt.offset)
+		}
+	}
+}
+
+func TestTypeError(t *testing.T) {
+	doc := map[string]interface{}{"items": []interface{}{struct{ Name string }{"apple"}}}
+	_, err := Query(`$..name`, doc)
+	var terr *TypeError
+	if !errors.As(err, &terr) {
+		t.Errorf("got %v, want a *TypeError", err)
+	}
+	// Values that aren't comparable, compared in a filter, are an error too rather than a panic.
+	list := []interface{}{map[string]interface{}{"a": []string{"x"}}}
+	if _, err := Query(`$[?(@.a == @.a)]`, list); !errors.As(err, &terr) {
+		t.Errorf("comparing []string values: got %v, want a *TypeError", err)
+	}
+	// A value of the wrong type that the path never reaches is not an error.
+	if got, err := Query(`$.items.length`, doc); err != nil || len(got) != 0 {
+		t.Errorf("got %v, %v, want no values", got, err)
+	}
+}
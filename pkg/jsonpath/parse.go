@@ -0,0 +1,380 @@
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// parser is a recursive descent parser over the expression's bytes.
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) errorf(msg string) error {
+	return &SyntaxError{Expr: p.expr, Offset: p.pos, Msg: msg}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.expr) {
+		return p.expr[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.expr) && strings.IndexByte(" \t\r\n", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// consume skips s if the expression continues with it.
+func (p *parser) consume(s string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *parser) parse() ([]segment, error) {
+	p.skipSpace()
+	// A path starting with . or .. is taken to start at the root, as jq users tend to write it.
+	if !p.consume("$") && p.peek() != '.' {
+		return nil, p.errorf("expected $ or . at the start of the path")
+	}
+	segments, err := p.segments()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return nil, p.errorf("unexpected " + strconv.Quote(string(p.expr[p.pos])))
+	}
+	return segments, nil
+}
+
+// segments parses the segments following $ or @ until something that can't start one.
+func (p *parser) segments() ([]segment, error) {
+	var segments []segment
+	for {
+		var seg segment
+		switch {
+		case p.consume(".."):
+			seg.descendant = true
+			if p.peek() == '[' {
+				break
+			}
+			sel, err := p.dotSelector()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = []selector{sel}
+		case p.consume("."):
+			sel, err := p.dotSelector()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = []selector{sel}
+		case p.peek() == '[':
+		default:
+			return segments, nil
+		}
+		if seg.selectors == nil {
+			p.pos++
+			sels, err := p.bracketSelectors()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = sels
+		}
+		segments = append(segments, seg)
+	}
+}
+
+// dotSelector parses the * or member name after a dot.
+func (p *parser) dotSelector() (selector, error) {
+	if p.consume("*") {
+		return wildcardSelector{}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.expr) {
+		r, size := utf8.DecodeRuneInString(p.expr[p.pos:])
+		if !(r == '_' || r >= 0x80 || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || p.pos > start && '0' <= r && r <= '9') {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a member name or *")
+	}
+	return nameSelector(p.expr[start:p.pos]), nil
+}
+
+// bracketSelectors parses the comma-separated selectors after a '[', and the closing ']'.
+func (p *parser) bracketSelectors() ([]selector, error) {
+	var sels []selector
+	for {
+		p.skipSpace()
+		sel, err := p.bracketSelector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		p.skipSpace()
+		if p.consume("]") {
+			return sels, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *parser) bracketSelector() (selector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		s, err := p.stringLiteral()
+		return nameSelector(s), err
+	case c == '*':
+		p.pos++
+		return wildcardSelector{}, nil
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		e, err := p.or()
+		return filterSelector{expr: e}, err
+	case c == ':' || c == '-' || '0' <= c && c <= '9':
+		return p.indexOrSlice()
+	}
+	return nil, p.errorf("expected a selector")
+}
+
+// indexOrSlice parses an index, or a slice start:end:step in which each part is optional.
+func (p *parser) indexOrSlice() (selector, error) {
+	var parts [3]*int
+	n := 0
+	for {
+		p.skipSpace()
+		if c := p.peek(); c == '-' || '0' <= c && c <= '9' {
+			i, err := p.integer()
+			if err != nil {
+				return nil, err
+			}
+			parts[n] = &i
+		}
+		p.skipSpace()
+		if n == 2 || !p.consume(":") {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		if parts[0] == nil {
+			return nil, p.errorf("expected an index")
+		}
+		return indexSelector(*parts[0]), nil
+	}
+	step := 1
+	if parts[2] != nil {
+		step = *parts[2]
+	}
+	return sliceSelector{start: parts[0], end: parts[1], step: step}, nil
+}
+
+func (p *parser) integer() (int, error) {
+	start := p.pos
+	p.consume("-")
+	for c := p.peek(); '0' <= c && c <= '9'; c = p.peek() {
+		p.pos++
+	}
+	i, err := strconv.Atoi(p.expr[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("invalid integer")
+	}
+	return i, nil
+}
+
+// stringLiteral parses a single- or double-quoted string with JSON's escapes, plus \' in single quotes.
+func (p *parser) stringLiteral() (string, error) {
+	quote := p.expr[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.expr) {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.expr[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c < 0x20:
+			return "", p.errorf("control character in string")
+		case c != '\\':
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		p.pos++
+		esc := p.peek()
+		p.pos++
+		switch esc {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '/', '\\', quote:
+			b.WriteByte(esc)
+		case 'u':
+			r, err := p.hex4()
+			if err != nil {
+				return "", err
+			}
+			if utf16.IsSurrogate(r) && p.consume(`\u`) {
+				r2, err := p.hex4()
+				if err != nil {
+					return "", err
+				}
+				r = utf16.DecodeRune(r, r2)
+			}
+			b.WriteRune(r)
+		default:
+			p.pos -= 2
+			return "", p.errorf("invalid escape")
+		}
+	}
+}
+
+func (p *parser) hex4() (rune, error) {
+	if p.pos+4 > len(p.expr) {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	n, err := strconv.ParseUint(p.expr[p.pos:p.pos+4], 16, 16)
+	if err != nil {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	p.pos += 4
+	return rune(n), nil
+}
+
+// or parses a filter expression, the lowest precedence level.
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	p.skipSpace()
+	if p.peek() == '!' && !strings.HasPrefix(p.expr[p.pos:], "!=") {
+		p.pos++
+		e, err := p.unary()
+		return notExpr{e}, err
+	}
+	if p.consume("(") {
+		p.skipSpace()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return e, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses a comparison or, if no operator follows the first operand, an existence test.
+func (p *parser) comparison() (expr, error) {
+	start := p.pos
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			p.skipSpace()
+			right, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return compareExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	q, ok := left.(query)
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("expected a comparison after a literal")
+	}
+	return existsExpr{q}, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		segments, err := p.segments()
+		return query{relative: c == '@', segments: segments}, err
+	case c == '\'' || c == '"':
+		s, err := p.stringLiteral()
+		return literal{s}, err
+	case c == '-' || '0' <= c && c <= '9':
+		return p.numberLiteral()
+	}
+	for word, v := range map[string]interface{}{"true": true, "false": false, "null": nil} {
+		if p.consume(word) {
+			return literal{v}, nil
+		}
+	}
+	return nil, p.errorf("expected @, $ or a literal")
+}
+
+func (p *parser) numberLiteral() (operand, error) {
+	start := p.pos
+	for p.pos < len(p.expr) && strings.IndexByte("+-.0123456789eE", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	f, err := strconv.ParseFloat(p.expr[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number")
+	}
+	return literal{f}, nil
+}
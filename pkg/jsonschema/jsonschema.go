@@ -0,0 +1,145 @@
+// Package jsonschema validates JSON documents against a JSON Schema before they are decoded. json.Unmarshal
+// quietly leaves a missing field at its zero value and ignores one it doesn't know, so a document with a typo
+// in a key decodes without complaint; checking it against a schema first turns that into a precise error.
+//
+// The supported keywords are a practical subset of draft 2020-12: type, enum, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, items, minItems, maxItems, properties,
+// required, additionalProperties, $defs and $ref to a JSON Pointer within the same schema, such as
+// "#/$defs/item". Other keywords are ignored, as the specification asks of unknown ones. Patterns use Go's
+// regexp syntax, which covers the common subset of the ECMAScript syntax the specification names.
+//
+// Reflect builds a schema from a Go type's json struct tags, so a type like the JSON example's response2 can
+// describe the documents it decodes.
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Draft is the $schema URI of the draft this package implements.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Types is the value of the type keyword: one type name or several. It is written as a plain string when
+// there is just one.
+type Types []string
+
+// MarshalJSON implements json.Marshaler.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// Schema is a JSON Schema. Nil pointers and empty values mean the keyword is absent. The boolean schemas
+// true and false, which accept everything and nothing, are made by Bool.
+type Schema struct {
+	Schema string             `json:"$schema,omitempty"`
+	Ref    string             `json:"$ref,omitempty"`
+	Defs   map[string]*Schema `json:"$defs,omitempty"`
+
+	Type Types         `json:"type,omitempty"`
+	Enum []interface{} `json:"enum,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// boolean is set for the schemas true and false.
+	boolean *bool
+}
+
+// Bool returns the schema true, which every value is valid against, or false, which none is.
+func Bool(b bool) *Schema {
+	return &Schema{boolean: &b}
+}
+
+// Parse decodes a schema from JSON.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("jsonschema: %w", err)
+	}
+	return &s, nil
+}
+
+// schemaFields has Schema's fields without its methods, so they can be encoded and decoded the usual way.
+type schemaFields Schema
+
+// MarshalJSON implements json.Marshaler.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.boolean != nil {
+		return json.Marshal(*s.boolean)
+	}
+	return json.Marshal((*schemaFields)(s))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{boolean: &b}
+		return nil
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		return errors.New("jsonschema: a schema must be an object or a boolean")
+	}
+	return json.Unmarshal(data, (*schemaFields)(s))
+}
+
+// Error is one way in which a value doesn't match a schema.
+type Error struct {
+	// InstanceLocation is a JSON Pointer to the value that is invalid, "" for the whole document.
+	InstanceLocation string
+	// KeywordLocation is a JSON Pointer to the keyword in the schema that the value fails, such as
+	// /properties/page/minimum.
+	KeywordLocation string
+	Message         string
+}
+
+func (e *Error) Error() string {
+	loc := e.InstanceLocation
+	if loc == "" {
+		loc = "(root)"
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Message)
+}
+
+// ValidationError lists every way in which a value doesn't match a schema.
+type ValidationError struct {
+	Errors []*Error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "jsonschema: " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,285 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) *Schema {
+	t.Helper()
+	schema, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatalf("parsing %s: %v", s, err)
+	}
+	return schema
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`true`, `true`},
+		{`false`, `false`},
+		{`{}`, `{}`},
+		{`{"type":"string","minLength":1}`, `{"type":"string","minLength":1}`},
+		{`{"type":["integer","null"]}`, `{"type":["integer","null"]}`},
+		{`{"items":false,"properties":{"a":true}}`, `{"items":false,"properties":{"a":true}}`},
+		{`{"title":"ignored","type":"object"}`, `{"type":"object"}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(mustParse(t, tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+		} else if string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, b, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`1`, `"string"`, `{"type":1}`, `{"items":[]}`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%s: got no error", bad)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const schema = `{
+		"$defs": {
+			"fruit": {"type": "string", "enum": ["apple", "peach", "pear"]}
+		},
+		"type": "object",
+		"properties": {
+			"page": {"type": "integer", "minimum": 1, "maximum": 100},
+			"ratio": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+			"code": {"type": "string", "minLength": 2, "maxLength": 3, "pattern": "^[a-z]+$"},
+			"fruits": {"type": "array", "items": {"$ref": "#/$defs/fruit"}, "minItems": 1, "maxItems": 2},
+			"a/b": {"type": "null"},
+			"tags": {"type": "object", "additionalProperties": {"type": "boolean"}}
+		},
+		"required": ["page", "fruits"],
+		"additionalProperties": false
+	}`
+	s := mustParse(t, schema)
+	tests := []struct {
+		doc  string
+		want []Error
+	}{
+		{`{"page":1,"fruits":["apple"]}`, nil},
+		{`{"page":1.0,"fruits":["apple","pear"],"ratio":0.5,"code":"ab","a/b":null,"tags":{"x":true}}`, nil},
+		{`[]`, []Error{{"", "/type", "got array, want object"}}},
+		{`{"fruits":["apple"]}`, []Error{{"", "/required", `missing required property "page"`}}},
+		{`{"page":"1","fruits":["apple"]}`, []Error{{"/page", "/properties/page/type", "got string, want integer"}}},
+		{`{"page":1.5,"fruits":["apple"]}`, []Error{{"/page", "/properties/page/type", "got number, want integer"}}},
+		{`{"page":0,"fruits":["apple"]}`, []Error{{"/page", "/properties/page/minimum", "0 is less than 1"}}},
+		{`{"page":101,"fruits":["apple"]}`, []Error{{"/page", "/properties/page/maximum", "101 is greater than 100"}}},
+		{`{"page":1,"fruits":["apple"],"ratio":0}`, []Error{{"/ratio", "/properties/ratio/exclusiveMinimum", "0 is not greater than 0"}}},
+		{`{"page":1,"fruits":["apple"],"ratio":1}`, []Error{{"/ratio", "/properties/ratio/exclusiveMaximum", "1 is not less than 1"}}},
+		{`{"page":1,"fruits":["apple"],"code":"é"}`, []Error{
+			{"/code", "/properties/code/minLength", "length 1 is less than 2"},
+			{"/code", "/properties/code/pattern", `"é" doesn't match ^[a-z]+$`},
+		}},
+		{`{"page":1,"fruits":["apple"],"code":"abcd"}`, []Error{{"/code", "/properties/code/maxLength", "length 4 is greater than 3"}}},
+		{`{"page":1,"fruits":[]}`, []Error{{"/fruits", "/properties/fruits/minItems", "0 items, want at least 1"}}},
+		{`{"page":1,"fruits":["apple","pear","peach"]}`, []Error{{"/fruits", "/properties/fruits/maxItems", "3 items, want at most 2"}}},
+		{`{"page":1,"fruits":["apple","plum"]}`, []Error{
+			{"/fruits/1", "/properties/fruits/items/$ref/enum", `must be one of ["apple","peach","pear"]`},
+		}},
+		{`{"page":1,"fruits":["apple"],"a/b":0}`, []Error{{"/a~1b", "/properties/a~1b/type", "got number, want null"}}},
+		{`{"page":1,"fruits":["apple"],"tags":{"x":1}}`, []Error{
+			{"/tags/x", "/properties/tags/additionalProperties/type", "got number, want boolean"},
+		}},
+		{`{"page":1,"fruits":["apple"],"pages":2}`, []Error{{"/pages", "/additionalProperties", `property "pages" is not allowed`}}},
+		{`{"page":-1,"fruit":["apple"]}`, []Error{
+			{"", "/required", `missing required property "fruits"`},
+			{"/fruit", "/additionalProperties", `property "fruit" is not allowed`},
+			{"/page", "/properties/page/minimum", "-1 is less than 1"},
+		}},
+	}
+	for _, tt := range tests {
+		err := s.ValidateJSON([]byte(tt.doc))
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.doc, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: got %v, want a *ValidationError", tt.doc, err)
+			continue
+		}
+		if len(verr.Errors) != len(tt.want) {
+			t.Errorf("%s: got %v, want %d errors", tt.doc, err, len(tt.want))
+			continue
+		}
+		for i, got := range verr.Errors {
+			if *got != tt.want[i] {
+				t.Errorf("%s: got %+v, want %+v", tt.doc, *got, tt.want[i])
+			}
+		}
+	}
+
+	if err := s.ValidateJSON([]byte(`{"page":1,"fruits":["apple"]} {}`)); err == nil || !strings.Contains(err.Error(), "after the document") {
+		t.Errorf("trailing data: got %v", err)
+	}
+	var verr *ValidationError
+	if err := s.ValidateJSON([]byte(`{"page":`)); err == nil || errors.As(err, &verr) {
+		t.Errorf("truncated document: got %v, want a decoding error", err)
+	}
+	if err := s.ValidateJSON([]byte(`[1]`)); err == nil || err.Error() != "jsonschema: (root): got array, want object" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	tree := mustParse(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"children": {"type": "array", "items": {"$ref": "#"}}
+		},
+		"required": ["name"]
+	}`)
+	if err := tree.ValidateJSON([]byte(`{"name":"a","children":[{"name":"b","children":[{"name":"c"}]}]}`)); err != nil {
+		t.Errorf("tree: %v", err)
+	}
+	err := tree.ValidateJSON([]byte(`{"name":"a","children":[{"children":[{"name":1}]}]}`))
+	want := `jsonschema: /children/0: missing required property "name"; ` +
+		`/children/0/children/0/name: got number, want string`
+	if err == nil || err.Error() != want {
+		t.Errorf("tree: got %v, want %s", err, want)
+	}
+
+	// Each level of the document follows one $ref, so the limit on $refs in a row doesn't limit its depth.
+	list := mustParse(t, `{
+		"$ref": "#/$defs/node",
+		"$defs": {"node": {"type": "object", "properties": {"child": {"$ref": "#/$defs/node"}}}}
+	}`)
+	deep := strings.Repeat(`{"child":`, 200) + `{}` + strings.Repeat(`}`, 200)
+	if err := list.ValidateJSON([]byte(deep)); err != nil {
+		t.Errorf("200 levels deep: %v", err)
+	}
+	deepTree := node{Value: 1}
+	for i := 0; i < 200; i++ {
+		child := deepTree
+		deepTree = node{Value: i, Children: []*node{&child}}
+	}
+	b, _ := json.Marshal(deepTree)
+	if err := Reflect(deepTree).ValidateJSON(b); err != nil {
+		t.Errorf("reflected tree 200 levels deep: %v", err)
+	}
+
+	tests := []struct {
+		schema, want string
+	}{
+		{`{"$ref":"#"}`, "too many nested $refs"},
+		{`{"$ref":"#/$defs/missing"}`, `$ref "#/$defs/missing" doesn't point to a schema`},
+		{`{"$ref":"other.json"}`, "unsupported $ref"},
+		{`{"$ref":"#/$defs/no","$defs":{"no":false}}`, "no value is allowed here"},
+	}
+	for _, tt := range tests {
+		err := mustParse(t, tt.schema).Validate(nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.schema, err, tt.want)
+		}
+	}
+}
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city,omitempty"`
+}
+
+type Base struct {
+	ID      int64  `json:"id"`
+	Comment string `json:"comment"`
+}
+
+type node struct {
+	Value    int     `json:"value"`
+	Children []*node `json:"children,omitempty"`
+}
+
+type order struct {
+	Base
+	Comment  *string           `json:"comment"`
+	Page     uint              `json:"page"`
+	Fruits   []string          `json:"fruits"`
+	Price    float64           `json:"price,string"`
+	Home     address           `json:"home"`
+	Work     *address          `json:"work,omitempty"`
+	Counts   map[string]int    `json:"counts,omitempty"`
+	RGB      [3]uint8          `json:"rgb"`
+	Data     []byte            `json:"data,omitempty"`
+	When     time.Time         `json:"when"`
+	Extra    json.RawMessage   `json:"extra,omitempty"`
+	Any      interface{}       `json:"any,omitempty"`
+	Tree     node              `json:"tree,omitempty"`
+	Labels   map[string]string `json:"-"`
+	Untagged bool
+	secret   string
+}
+
+func TestReflect(t *testing.T) {
+	got, err := json.Marshal(Reflect(order{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema",` +
+		`"$defs":{` +
+		`"address":{"type":"object","properties":{"city":{"type":"string"},"street":{"type":"string"}},"required":["street"],"additionalProperties":false},` +
+		`"node":{"type":"object","properties":{"children":{"type":["array","null"],"items":{"$ref":"#/$defs/node"}},"value":{"type":"integer"}},"required":["value"],"additionalProperties":false}},` +
+		`"type":"object",` +
+		`"properties":{` +
+		`"Untagged":{"type":"boolean"},` +
+		`"any":{},` +
+		`"comment":{"type":["string","null"]},` +
+		`"counts":{"type":["object","null"],"additionalProperties":{"type":"integer"}},` +
+		`"data":{"type":["string","null"]},` +
+		`"extra":{},` +
+		`"fruits":{"type":["array","null"],"items":{"type":"string"}},` +
+		`"home":{"$ref":"#/$defs/address"},` +
+		`"id":{"type":"integer"},` +
+		`"page":{"type":"integer","minimum":0},` +
+		`"price":{"type":"string"},` +
+		`"rgb":{"type":"array","items":{"type":"integer","minimum":0},"minItems":3,"maxItems":3},` +
+		`"tree":{"$ref":"#/$defs/node"},` +
+		`"when":{"type":"string"},` +
+		`"work":{"$ref":"#/$defs/address"}},` +
+		`"required":["id","comment","page","fruits","price","home","rgb","when","Untagged"],` +
+		`"additionalProperties":false}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	s := Reflect(&order{})
+	tests := []struct {
+		doc   string
+		valid bool
+	}{
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":"1.5","home":{"street":"Main"},"rgb":[1,2,3],"when":"2024-01-01T00:00:00Z","Untagged":false}`, true},
+		{`{"id":1,"comment":"hi","page":2,"fruits":["a"],"price":"1.5","home":{"street":"Main","city":"X"},"work":{"street":"Side"},"rgb":[1,2,3],"when":"","Untagged":true,"tree":{"value":1,"children":[{"value":2}]},"any":[1],"extra":{"a":1}}`, true},
+		{`{"id":1,"comment":null,"page":-2,"fruits":null,"price":"1.5","home":{"street":"Main"},"rgb":[1,2,3],"when":"","Untagged":false}`, false},
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":1.5,"home":{"street":"Main"},"rgb":[1,2,3],"when":"","Untagged":false}`, false},
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":"1.5","home":{"street":"Main"},"rgb":[1,2],"when":"","Untagged":false}`, false},
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":"1.5","home":{"Street":"Main"},"rgb":[1,2,3],"when":"","Untagged":false}`, false},
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":"1.5","home":{"street":"Main"},"rgb":[1,2,3],"when":"","Untagged":false,"tree":{"value":1,"children":[{"value":"2"}]}}`, false},
+		{`{"id":1,"comment":null,"page":2,"fruits":null,"price":"1.5","home":{"street":"Main"},"rgb":[1,2,3],"when":"","Untagged":false,"secret":"x"}`, false},
+	}
+	for _, tt := range tests {
+		if err := s.ValidateJSON([]byte(tt.doc)); (err == nil) != tt.valid {
+			t.Errorf("%s: got %v, want valid %v", tt.doc, err, tt.valid)
+		}
+	}
+
+	loose := Reflect(address{}, AllowAdditionalProperties())
+	if err := loose.ValidateJSON([]byte(`{"street":"Main","zip":"123"}`)); err != nil {
+		t.Errorf("AllowAdditionalProperties: %v", err)
+	}
+	if b, _ := json.Marshal(Reflect([]int{})); string(b) != `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":["array","null"],"items":{"type":"integer"}}` {
+		t.Errorf("[]int: got %s", b)
+	}
+}
@@ -0,0 +1,262 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Option configures Reflect.
+type Option func(*config)
+
+type config struct {
+	additionalProperties bool
+}
+
+// AllowAdditionalProperties lets objects have members that match no struct field, which json.Unmarshal
+// ignores. By default they are invalid, which catches misspelled keys.
+func AllowAdditionalProperties() Option {
+	return func(c *config) {
+		c.additionalProperties = true
+	}
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Reflect returns a schema for the JSON that encoding/json decodes into a value of v's type. Struct fields
+// are named and skipped as their json tags say, and a field is required unless its tag has omitempty, since
+// json.Unmarshal would otherwise quietly leave it at its zero value. Slices, maps and pointers to anything
+// but a struct may also be null. A pointer to a struct must be an object when present, so give the field
+// omitempty if it may be nil. Types that marshal themselves accept any value, or any string for
+// encoding.TextMarshalers.
+//
+// Named structs other than v's own type are described once under $defs and referred to with $ref, so
+// recursive types such as trees work.
+func Reflect(v interface{}, opts ...Option) *Schema {
+	r := &reflector{refs: map[reflect.Type]string{}}
+	for _, opt := range opts {
+		opt(&r.cfg)
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var s *Schema
+	switch {
+	case t == nil:
+		s = &Schema{}
+	case t.Kind() == reflect.Struct && !marshalsItself(t):
+		r.refs[t] = "#"
+		s = r.structSchema(t)
+	default:
+		s = r.schema(t)
+	}
+	s.Schema = Draft
+	s.Defs = r.defs
+	return s
+}
+
+type reflector struct {
+	cfg  config
+	defs map[string]*Schema
+	// refs maps each named struct type seen to the $ref that refers to it.
+	refs map[reflect.Type]string
+}
+
+func marshalsItself(t reflect.Type) bool {
+	return implements(t, jsonMarshaler) || implements(t, textMarshaler)
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func (r *reflector) schema(t reflect.Type) *Schema {
+	// A type that is both, such as time.Time, usually writes the same string either way.
+	if implements(t, textMarshaler) {
+		return &Schema{Type: Types{"string"}}
+	}
+	if implements(t, jsonMarshaler) {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &Schema{Type: Types{"integer"}, Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice:
+		// encoding/json writes a []byte as a base64 string, and any nil slice as null.
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string", "null"}}
+		}
+		return &Schema{Type: Types{"array", "null"}, Items: r.schema(t.Elem())}
+	case reflect.Array:
+		n := t.Len()
+		return &Schema{Type: Types{"array"}, Items: r.schema(t.Elem()), MinItems: &n, MaxItems: &n}
+	case reflect.Map:
+		// Keys are always strings in JSON; encoding/json writes integer keys in decimal.
+		return &Schema{Type: Types{"object", "null"}, AdditionalProperties: r.schema(t.Elem())}
+	case reflect.Ptr:
+		s := r.schema(t.Elem())
+		// A $ref's types can't be widened without anyOf, which this package doesn't support, and a schema
+		// without types already allows null.
+		if len(s.Type) > 0 && s.Ref == "" && !s.Type.has("null") {
+			s.Type = append(s.Type, "null")
+		}
+		return s
+	case reflect.Struct:
+		return r.structRef(t)
+	}
+	// interface{}, and types such as channels that encoding/json can't handle.
+	return &Schema{}
+}
+
+func (t Types) has(name string) bool {
+	for _, n := range t {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// structRef returns a $ref to a named struct's schema, adding the schema to $defs the first time the type is
+// seen. The $ref is recorded before the fields are described, so a field of the same type refers back to it.
+func (r *reflector) structRef(t reflect.Type) *Schema {
+	if ref, ok := r.refs[t]; ok {
+		return &Schema{Ref: ref}
+	}
+	if t.Name() == "" {
+		return r.structSchema(t)
+	}
+	name := t.Name()
+	for i := 2; r.defs[name] != nil; i++ {
+		// Types from different packages can share a name.
+		name = t.Name() + strconv.Itoa(i)
+	}
+	if r.defs == nil {
+		r.defs = map[string]*Schema{}
+	}
+	r.refs[t] = "#/$defs/" + pointerEscaper.Replace(name)
+	r.defs[name] = &Schema{}
+	*r.defs[name] = *r.structSchema(t)
+	return &Schema{Ref: r.refs[t]}
+}
+
+// field is a struct field as encoding/json sees it.
+type field struct {
+	name     string
+	typ      reflect.Type
+	depth    int
+	optional bool
+	quoted   bool
+}
+
+func (r *reflector) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	if !r.cfg.additionalProperties {
+		s.AdditionalProperties = Bool(false)
+	}
+	for _, f := range fields(t, 0, false) {
+		var prop *Schema
+		if f.quoted {
+			prop = &Schema{Type: Types{"string"}}
+		} else {
+			prop = r.schema(f.typ)
+		}
+		s.Properties[f.name] = prop
+		if !f.optional {
+			s.Required = append(s.Required, f.name)
+		}
+	}
+	return s
+}
+
+// fields lists t's fields in order, with the fields of embedded structs that have no json name of their own
+// promoted into it. As in encoding/json, a field nested less deeply hides another of the same name.
+func fields(t reflect.Type, depth int, optional bool) []field {
+	var list []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			et := ft
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && !marshalsItself(et) {
+				// The fields of a nil embedded pointer are left out.
+				list = merge(list, fields(et, depth+1, optional || ft.Kind() == reflect.Ptr))
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := field{name: name, typ: ft, depth: depth, optional: optional}
+		for opts != "" {
+			var opt string
+			opt, opts, _ = strings.Cut(opts, ",")
+			switch opt {
+			case "omitempty":
+				f.optional = true
+			case "string":
+				f.quoted = quotable(ft)
+			}
+		}
+		list = merge(list, []field{f})
+	}
+	return list
+}
+
+// merge adds fields to list, keeping whichever of two fields with the same name is nested less deeply.
+func merge(list, fields []field) []field {
+next:
+	for _, f := range fields {
+		for i, g := range list {
+			if g.name == f.name {
+				if f.depth < g.depth {
+					list[i] = f
+				}
+				continue next
+			}
+		}
+		list = append(list, f)
+	}
+	return list
+}
+
+// quotable reports whether the ",string" option applies to a field of type t: it does to booleans, numbers
+// and strings, and to pointers to them.
+func quotable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
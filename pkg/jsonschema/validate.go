@@ -0,0 +1,291 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/keithwegner/go-by-example/pkg/jsonpatch"
+)
+
+// maxRefDepth bounds how many $refs may be followed in a row while validating one value, so a schema that
+// refers to itself without ever reaching into the value, such as {"$ref": "#"}, fails instead of recursing
+// forever. The count starts again at each item or member, so a recursive schema still validates a document
+// of any depth.
+const maxRefDepth = 64
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// ValidateJSON decodes a JSON document and validates it. Use it before json.Unmarshal to reject documents
+// that would decode into something other than what was meant. A document that isn't JSON at all is reported
+// as a plain error; one that doesn't match the schema as a *ValidationError.
+func (s *Schema) ValidateJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("jsonschema: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("jsonschema: invalid data after the document at offset %d", dec.InputOffset())
+	}
+	return s.Validate(v)
+}
+
+// Validate checks a decoded JSON value: what json.Unmarshal produces for an interface{}, with numbers as
+// float64 or json.Number. It returns nil if the value is valid, and otherwise a *ValidationError listing
+// every problem found.
+func (s *Schema) Validate(v interface{}) error {
+	val := &validator{root: s, patterns: map[string]*regexp.Regexp{}}
+	val.validate(s, v, "", "", 0)
+	if len(val.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: val.errs}
+}
+
+type validator struct {
+	root     *Schema
+	patterns map[string]*regexp.Regexp
+	errs     []*Error
+}
+
+func (val *validator) fail(instance, keyword, format string, args ...interface{}) {
+	val.errs = append(val.errs, &Error{InstanceLocation: instance, KeywordLocation: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate checks v, found at the pointer instance, against s, found at the pointer keyword.
+func (val *validator) validate(s *Schema, v interface{}, instance, keyword string, refs int) {
+	if s.boolean != nil {
+		if !*s.boolean {
+			val.fail(instance, keyword, "no value is allowed here")
+		}
+		return
+	}
+
+	if s.Ref != "" {
+		target, err := val.resolve(s.Ref)
+		switch {
+		case err != nil:
+			val.fail(instance, keyword+"/$ref", "%v", err)
+		case refs >= maxRefDepth:
+			val.fail(instance, keyword+"/$ref", "too many nested $refs")
+		default:
+			val.validate(target, v, instance, keyword+"/$ref", refs+1)
+		}
+	}
+
+	if len(s.Type) > 0 && !hasType(v, s.Type) {
+		val.fail(instance, keyword+"/type", "got %s, want %s", typeName(v), strings.Join(s.Type, " or "))
+		// The other keywords would only report the same problem in other words.
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		b, _ := json.Marshal(s.Enum)
+		val.fail(instance, keyword+"/enum", "must be one of %s", b)
+	}
+
+	switch v := v.(type) {
+	case string:
+		val.validateString(s, v, instance, keyword)
+	case []interface{}:
+		val.validateArray(s, v, instance, keyword)
+	case map[string]interface{}:
+		val.validateObject(s, v, instance, keyword)
+	default:
+		if n, ok := number(v); ok {
+			val.validateNumber(s, n, instance, keyword)
+		}
+	}
+}
+
+func (val *validator) validateNumber(s *Schema, n float64, instance, keyword string) {
+	if s.Minimum != nil && n < *s.Minimum {
+		val.fail(instance, keyword+"/minimum", "%v is less than %v", n, *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		val.fail(instance, keyword+"/maximum", "%v is greater than %v", n, *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		val.fail(instance, keyword+"/exclusiveMinimum", "%v is not greater than %v", n, *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		val.fail(instance, keyword+"/exclusiveMaximum", "%v is not less than %v", n, *s.ExclusiveMaximum)
+	}
+}
+
+func (val *validator) validateString(s *Schema, str, instance, keyword string) {
+	// Lengths count characters, not bytes.
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		val.fail(instance, keyword+"/minLength", "length %d is less than %d", n, *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		val.fail(instance, keyword+"/maxLength", "length %d is greater than %d", n, *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, ok := val.patterns[s.Pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(s.Pattern); err != nil {
+				val.fail(instance, keyword+"/pattern", "invalid pattern: %v", err)
+				return
+			}
+			val.patterns[s.Pattern] = re
+		}
+		if !re.MatchString(str) {
+			val.fail(instance, keyword+"/pattern", "%q doesn't match %s", str, s.Pattern)
+		}
+	}
+}
+
+func (val *validator) validateArray(s *Schema, a []interface{}, instance, keyword string) {
+	if s.MinItems != nil && len(a) < *s.MinItems {
+		val.fail(instance, keyword+"/minItems", "%d items, want at least %d", len(a), *s.MinItems)
+	}
+	if s.MaxItems != nil && len(a) > *s.MaxItems {
+		val.fail(instance, keyword+"/maxItems", "%d items, want at most %d", len(a), *s.MaxItems)
+	}
+	if s.Items != nil {
+		for i, item := range a {
+			val.validate(s.Items, item, instance+"/"+strconv.Itoa(i), keyword+"/items", 0)
+		}
+	}
+}
+
+func (val *validator) validateObject(s *Schema, m map[string]interface{}, instance, keyword string) {
+	for _, name := range s.Required {
+		if _, ok := m[name]; !ok {
+			val.fail(instance, keyword+"/required", "missing required property %q", name)
+		}
+	}
+	// Members are checked in key order so the errors come out in the same order every time.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		loc := instance + "/" + pointerEscaper.Replace(k)
+		if prop, ok := s.Properties[k]; ok {
+			val.validate(prop, m[k], loc, keyword+"/properties/"+pointerEscaper.Replace(k), 0)
+		} else if s.AdditionalProperties != nil {
+			if ap := s.AdditionalProperties; ap.boolean != nil && !*ap.boolean {
+				// A clearer message than "no value is allowed here" for the usual case.
+				val.fail(loc, keyword+"/additionalProperties", "property %q is not allowed", k)
+			} else {
+				val.validate(ap, m[k], loc, keyword+"/additionalProperties", 0)
+			}
+		}
+	}
+}
+
+// resolve finds the schema a $ref points to. Only references within the schema are supported: "#" and
+// JSON Pointers such as "#/$defs/item" or "#/properties/items/items".
+func (val *validator) resolve(ref string) (*Schema, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within the schema are supported", ref)
+	}
+	s := val.root
+	ptr := ref[1:]
+	if ptr == "" {
+		return s, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("unsupported $ref %q: anchors are not supported", ref)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i := 0; i < len(tokens) && s != nil; i++ {
+		tok := unescape.Replace(tokens[i])
+		var next string
+		if i+1 < len(tokens) {
+			next = unescape.Replace(tokens[i+1])
+		}
+		switch tok {
+		case "$defs":
+			s, i = s.Defs[next], i+1
+		case "properties":
+			s, i = s.Properties[next], i+1
+		case "items":
+			s = s.Items
+		case "additionalProperties":
+			s = s.AdditionalProperties
+		default:
+			s = nil
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("$ref %q doesn't point to a schema", ref)
+	}
+	return s, nil
+}
+
+func hasType(v interface{}, types Types) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, ok := number(v); ok && n == math.Trunc(n) && !math.IsInf(n, 0) {
+				return true
+			}
+		case "number":
+			if _, ok := number(v); ok {
+				return true
+			}
+		default:
+			if typeName(v) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of v, other than integer.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// inEnum reports whether v equals one of enum's values. Equality is jsonpatch's, so 1 and 1.0 are the same
+// value here just as they are in a patch's test operation.
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if jsonpatch.Equal(v, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,419 @@
+// Package jsonstream reads and writes streams of JSON values one record at a time, for documents far too
+// large for the json.Marshal and json.Unmarshal calls in the JSON example. A stream is either one top-level
+// JSON array, whose elements are the records, or NDJSON (newline-delimited JSON), with one record per line.
+//
+// A Reader walks an array with json.Decoder.Token and decodes each element into a typed value as it reaches
+// it, so memory use depends on the size of the largest record rather than of the whole document. A record
+// that can't be decoded is reported with its index and byte offset in the input, and where the stream's
+// structure allows it, reading carries on with the next record.
+package jsonstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotArray is returned by a Reader in Array format when the input doesn't start with a JSON array.
+var ErrNotArray = errors.New("jsonstream: input is not a JSON array")
+
+// Format is how the records of a stream are laid out.
+type Format int
+
+const (
+	// Auto reads an array when the first thing in the input is '[' and NDJSON otherwise. NDJSON whose
+	// records are themselves arrays must be read with the NDJSON format instead. Writers write NDJSON.
+	Auto Format = iota
+	// Array is a single JSON array with one record per element.
+	Array
+	// NDJSON is one JSON value per line. Blank lines are ignored.
+	NDJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case Auto:
+		return "auto"
+	case Array:
+		return "array"
+	case NDJSON:
+		return "ndjson"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the Format named by s, as printed by Format.String.
+func ParseFormat(s string) (Format, error) {
+	for f := Auto; f <= NDJSON; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("jsonstream: unknown format %q", s)
+}
+
+// RecordError reports a record that couldn't be decoded.
+type RecordError struct {
+	// Index counts records from 0, including ones that failed to decode.
+	Index int
+	// Offset is the byte offset in the input where the record starts. Offsets within Err, such as a
+	// json.SyntaxError's, are relative to the record.
+	Offset int64
+	// Line is the record's line number, counting from 1, in NDJSON. It is 0 in an array.
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("jsonstream: record %d at offset %d (line %d): %v", e.Index, e.Offset, e.Line, e.Err)
+	}
+	return fmt.Sprintf("jsonstream: record %d at offset %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Option configures a Reader.
+type Option func(*config)
+
+type config struct {
+	format                Format
+	useNumber             bool
+	disallowUnknownFields bool
+}
+
+// WithFormat sets the format of the input. The default is Auto.
+func WithFormat(f Format) Option {
+	return func(c *config) {
+		c.format = f
+	}
+}
+
+// WithUseNumber decodes numbers into interface{} values as json.Number instead of float64, so large integers
+// keep their precision.
+func WithUseNumber() Option {
+	return func(c *config) {
+		c.useNumber = true
+	}
+}
+
+// WithDisallowUnknownFields makes a record with an object key that matches no field of T a RecordError.
+func WithDisallowUnknownFields() Option {
+	return func(c *config) {
+		c.disallowUnknownFields = true
+	}
+}
+
+// Reader reads records of type T from a stream.
+type Reader[T any] struct {
+	cfg    config
+	r      *bufio.Reader
+	format Format
+	in     *countingReader
+	dec    *json.Decoder
+	// base is the offset in the input where dec started reading, and offset the offset of the next NDJSON
+	// line.
+	base, offset int64
+	index, line  int
+	started      bool
+	err          error
+}
+
+// NewReader returns a Reader that reads records from r.
+func NewReader[T any](r io.Reader, opts ...Option) *Reader[T] {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Reader[T]{cfg: cfg, r: bufio.NewReader(r), format: cfg.format}
+}
+
+// Format returns the format being read. With Auto, it is known after the first call to Next.
+func (r *Reader[T]) Format() Format {
+	return r.format
+}
+
+// Next returns the next record, or io.EOF when there are no more. A record that can't be decoded into a T is
+// returned as a *RecordError, and calling Next again moves on to the record after it. Inside an array, though,
+// a record that isn't valid JSON leaves no way to tell where the next one starts: Next then returns the same
+// error from then on, as it does for any other error, and Err reports it.
+func (r *Reader[T]) Next() (T, error) {
+	var v T
+	if r.err != nil {
+		return v, r.err
+	}
+	if !r.started {
+		r.started = true
+		if err := r.start(); err != nil {
+			r.err = err
+			return v, err
+		}
+	}
+	if r.format == Array {
+		return r.nextElement()
+	}
+	return r.nextLine()
+}
+
+// Err returns the error that ended the stream early, or nil if the stream is still going or reached its end.
+func (r *Reader[T]) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// start skips leading white space, picks the format if it is Auto and, for an array, reads the opening '['.
+func (r *Reader[T]) start() error {
+	for {
+		c, err := r.r.ReadByte()
+		if err == io.EOF && r.format != Array {
+			return io.EOF
+		} else if err == io.EOF {
+			return ErrNotArray
+		} else if err != nil {
+			return err
+		}
+		if !isSpace(c) {
+			r.r.UnreadByte()
+			if r.format == Auto && c == '[' {
+				r.format = Array
+			} else if r.format == Auto {
+				r.format = NDJSON
+			}
+			break
+		}
+		r.offset++
+	}
+	if r.format != Array {
+		return nil
+	}
+
+	r.base = r.offset
+	r.in = &countingReader{r: r.r}
+	r.dec = json.NewDecoder(r.in)
+	if r.cfg.useNumber {
+		r.dec.UseNumber()
+	}
+	if r.cfg.disallowUnknownFields {
+		r.dec.DisallowUnknownFields()
+	}
+	if tok, err := r.dec.Token(); err != nil || tok != json.Delim('[') {
+		return ErrNotArray
+	}
+	return nil
+}
+
+func (r *Reader[T]) nextElement() (T, error) {
+	var v T
+	if !r.dec.More() {
+		r.err = r.end()
+		return v, r.err
+	}
+	start, ok := r.elementStart()
+	if !ok {
+		// Some versions of More report true at the end of the input and leave it to Decode to fail.
+		r.err = fmt.Errorf("jsonstream: unterminated array at offset %d: %w", start, io.ErrUnexpectedEOF)
+		return v, r.err
+	}
+	rerr := &RecordError{Index: r.index, Offset: start}
+	r.index++
+	if err := r.dec.Decode(&v); err != nil {
+		rerr.Err = err
+		// Decode reads the whole element before filling in v, so after a type mismatch the decoder is at the
+		// next element. After a syntax error it is lost.
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) && !isUnknownField(err) {
+			r.err = rerr
+		}
+		return v, rerr
+	}
+	return v, nil
+}
+
+// end reads the closing ']' and makes sure nothing but white space follows it.
+func (r *Reader[T]) end() error {
+	off := r.consumed()
+	tok, err := r.dec.Token()
+	if err == io.EOF {
+		return fmt.Errorf("jsonstream: unterminated array at offset %d: %w", off, io.ErrUnexpectedEOF)
+	} else if err != nil {
+		return fmt.Errorf("jsonstream: at offset %d: %w", off, err)
+	} else if tok != json.Delim(']') {
+		return fmt.Errorf("jsonstream: unexpected %v at offset %d", tok, off)
+	}
+	off = r.consumed()
+	if _, err := r.dec.Token(); err != io.EOF {
+		return fmt.Errorf("jsonstream: data after the array at offset %d", off)
+	}
+	return io.EOF
+}
+
+// consumed returns the offset of the first byte the decoder has read but not yet used. InputOffset isn't
+// used because what it counts around commas and white space differs between Go versions.
+func (r *Reader[T]) consumed() int64 {
+	buf := r.dec.Buffered().(*bytes.Reader)
+	return r.base + r.in.n - int64(buf.Len())
+}
+
+// elementStart returns the offset of the element More just found, skipping the comma and white space before
+// it, and false if the input ended instead.
+func (r *Reader[T]) elementStart() (int64, bool) {
+	off := r.consumed()
+	buf := r.dec.Buffered().(*bytes.Reader)
+	for {
+		c, err := buf.ReadByte()
+		if err != nil {
+			return off, !r.in.eof
+		} else if c != ',' && !isSpace(c) {
+			return off, true
+		}
+		off++
+	}
+}
+
+// countingReader counts the bytes the decoder reads and notes when it reaches the end of the input.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	eof bool
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+func (r *Reader[T]) nextLine() (T, error) {
+	var v T
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			r.err = err
+			return v, err
+		}
+		start := r.offset
+		r.offset += int64(len(line))
+		r.line++
+		trimmed := bytes.TrimLeft(line, " \t\r\n")
+		if len(trimmed) == 0 {
+			continue
+		}
+		rerr := &RecordError{
+			Index:  r.index,
+			Offset: start + int64(len(line)-len(trimmed)),
+			Line:   r.line,
+		}
+		r.index++
+		if rerr.Err = r.unmarshal(trimmed, &v); rerr.Err != nil {
+			return v, rerr
+		}
+		return v, nil
+	}
+}
+
+// unmarshal decodes one NDJSON record with the same settings a Decoder would have.
+func (r *Reader[T]) unmarshal(data []byte, v *T) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if r.cfg.useNumber {
+		dec.UseNumber()
+	}
+	if r.cfg.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after the value at offset %d", dec.InputOffset())
+	}
+	return nil
+}
+
+// isUnknownField reports whether err is the error DisallowUnknownFields causes. The json package has no type
+// for it, but like a type mismatch it is only found after the whole value has been read.
+func isUnknownField(err error) bool {
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// Writer writes records of type T as an array or as NDJSON. Writing an array, each element goes on its own
+// line.
+type Writer[T any] struct {
+	w      *bufio.Writer
+	format Format
+	n      int
+	closed bool
+}
+
+// NewWriter returns a Writer that writes records to w in the given format, where Auto means NDJSON. Records
+// are buffered, so Close must be called to finish the stream.
+func NewWriter[T any](w io.Writer, format Format) *Writer[T] {
+	if format == Auto {
+		format = NDJSON
+	}
+	return &Writer[T]{w: bufio.NewWriter(w), format: format}
+}
+
+// Write writes one record. It is always written on a single line, even when T is a json.RawMessage holding
+// indented JSON.
+func (w *Writer[T]) Write(v T) error {
+	if w.closed {
+		return errors.New("jsonstream: write to closed writer")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if w.format == Array {
+		sep := ",\n"
+		if w.n == 0 {
+			sep = "[\n"
+		}
+		w.w.WriteString(sep)
+	}
+	w.n++
+	w.w.Write(data)
+	if w.format == NDJSON {
+		w.w.WriteByte('\n')
+	}
+	// bufio.Writer keeps the first error and returns it from every later call, so one check covers the lot.
+	_, err = w.w.Write(nil)
+	return err
+}
+
+// Flush writes out the records buffered so far without ending an array, for a stream that has to stop early:
+// the output then holds every record written but, as an array, isn't valid JSON.
+func (w *Writer[T]) Flush() error {
+	return w.w.Flush()
+}
+
+// Close ends an array and flushes what is buffered. It doesn't close the underlying writer.
+func (w *Writer[T]) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.format == Array && w.n == 0 {
+		w.w.WriteString("[]\n")
+	} else if w.format == Array {
+		w.w.WriteString("\n]\n")
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,239 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Name string `json:"name"`
+	Qty  int    `json:"qty"`
+}
+
+// result is where a record that failed to decode was.
+type result struct {
+	index  int
+	offset int64
+	line   int
+}
+
+// readAll reads until Next stops making progress, collecting the records and the record errors.
+func readAll(t *testing.T, r *Reader[item]) (items []item, bad []result, err error) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		v, err := r.Next()
+		var rerr *RecordError
+		switch {
+		case err == nil:
+			items = append(items, v)
+		case errors.As(err, &rerr) && r.Err() == nil:
+			bad = append(bad, result{index: rerr.Index, offset: rerr.Offset, line: rerr.Line})
+		default:
+			return items, bad, err
+		}
+	}
+	t.Fatal("Next never stopped")
+	return nil, nil, nil
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format Format
+		want   []item
+		bad    []result
+		err    string
+	}{
+		{name: "empty array", input: " [ ] ", want: nil},
+		{name: "empty input", input: "", want: nil},
+		{name: "empty input as array", input: "", format: Array, err: ErrNotArray.Error()},
+		{
+			name:  "array",
+			input: `[{"name":"fig","qty":3}, {"name":"kiwi","qty":1}]`,
+			want:  []item{{"fig", 3}, {"kiwi", 1}},
+		},
+		{
+			name:  "ndjson",
+			input: "{\"name\":\"fig\",\"qty\":3}\n\n  {\"name\":\"kiwi\",\"qty\":1}",
+			want:  []item{{"fig", 3}, {"kiwi", 1}},
+		},
+		{
+			name:  "ndjson with CRLF",
+			input: "{\"name\":\"fig\"}\r\n{\"name\":\"kiwi\"}\r\n",
+			want:  []item{{"fig", 0}, {"kiwi", 0}},
+		},
+		{
+			// A type mismatch is found only after the whole element has been read, so the next one can be.
+			name:  "array with a type mismatch",
+			input: `[{"name":"fig"},  {"name":7}, {"name":"kiwi"}]`,
+			want:  []item{{"fig", 0}, {"kiwi", 0}},
+			bad:   []result{{index: 1, offset: 18}},
+		},
+		{
+			name:  "array with a syntax error",
+			input: `[{"name":"fig"}, {"name":}, {"name":"kiwi"}]`,
+			want:  []item{{"fig", 0}},
+			err:   "jsonstream: record 1 at offset 17: invalid character '}'",
+		},
+		{
+			name:  "array with a missing comma",
+			input: `[{"name":"fig"} {"name":"kiwi"}]`,
+			want:  []item{{"fig", 0}},
+			err:   "jsonstream: record 1 at offset 16: invalid character '{'",
+		},
+		{
+			name:  "ndjson with bad lines",
+			input: "{\"name\":\"fig\"}\n{\"name\":}\n{\"name\":7}\n{} {}\n{\"name\":\"kiwi\"}\n",
+			want:  []item{{"fig", 0}, {"kiwi", 0}},
+			bad:   []result{{index: 1, offset: 15, line: 2}, {index: 2, offset: 25, line: 3}, {index: 3, offset: 36, line: 4}},
+		},
+		{name: "not an array", input: `{"name":"fig"}`, format: Array, err: ErrNotArray.Error()},
+		{
+			name:  "unterminated array",
+			input: `[{"name":"fig"}`,
+			want:  []item{{"fig", 0}},
+			err:   "jsonstream: unterminated array at offset 15: unexpected EOF",
+		},
+		{
+			name:  "data after the array",
+			input: `[{"name":"fig"}] {}`,
+			want:  []item{{"fig", 0}},
+			err:   "jsonstream: data after the array at offset 16",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, bad, err := readAll(t, NewReader[item](strings.NewReader(tt.input), WithFormat(tt.format)))
+			if fmt.Sprint(items) != fmt.Sprint(tt.want) {
+				t.Errorf("got records %v, want %v", items, tt.want)
+			}
+			if fmt.Sprint(bad) != fmt.Sprint(tt.bad) {
+				t.Errorf("got bad records %+v, want %+v", bad, tt.bad)
+			}
+			if tt.err == "" && err != io.EOF {
+				t.Errorf("got %v, want io.EOF", err)
+			} else if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+				t.Errorf("got %v, want %s...", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReaderOptions(t *testing.T) {
+	r := NewReader[map[string]interface{}](strings.NewReader(`[{"id":9007199254740993}]`), WithUseNumber())
+	v, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v["id"]; got != json.Number("9007199254740993") {
+		t.Errorf("got %v, want the number unrounded", got)
+	}
+
+	strict := NewReader[item](strings.NewReader(`[{"name":"fig","colour":"purple"},{"name":"kiwi"}]`), WithDisallowUnknownFields())
+	if _, err := strict.Next(); err == nil {
+		t.Error("got no error for an unknown field")
+	}
+	if v, err := strict.Next(); err != nil || v.Name != "kiwi" {
+		t.Errorf("got %v, %v, want the record after the unknown field", v, err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	records := []json.RawMessage{json.RawMessage("{\n  \"name\": \"fig\"\n}"), json.RawMessage(`[1, 2]`)}
+	tests := []struct {
+		format Format
+		n      int
+		want   string
+	}{
+		{NDJSON, 2, "{\"name\":\"fig\"}\n[1,2]\n"},
+		{Array, 2, "[\n{\"name\":\"fig\"},\n[1,2]\n]\n"},
+		{Array, 0, "[]\n"},
+		{NDJSON, 0, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := NewWriter[json.RawMessage](&buf, tt.format)
+		for _, rec := range records[:tt.n] {
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%v with %d records: got %q, want %q", tt.format, tt.n, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter[int](&buf, Array)
+	w.Write(1)
+	w.Write(2)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[\n1,\n2"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	w.Write(3)
+	w.Close()
+	if want := "[\n1,\n2,\n3\n]\n"; buf.String() != want {
+		t.Errorf("after Close: got %q, want %q", buf.String(), want)
+	}
+}
+
+// TestRoundTrip converts a large array to NDJSON and back through pipes, so the records are never all in memory
+// at once.
+func TestRoundTrip(t *testing.T) {
+	const n = 20000
+	arrayIn, arrayOut := io.Pipe()
+	go func() {
+		w := NewWriter[item](arrayOut, Array)
+		for i := 0; i < n; i++ {
+			w.Write(item{Name: fmt.Sprintf("item-%d", i), Qty: i})
+		}
+		arrayOut.CloseWithError(w.Close())
+	}()
+
+	ndjsonIn, ndjsonOut := io.Pipe()
+	go func() {
+		r := NewReader[json.RawMessage](arrayIn)
+		w := NewWriter[json.RawMessage](ndjsonOut, NDJSON)
+		for {
+			v, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				ndjsonOut.CloseWithError(err)
+				return
+			}
+			w.Write(v)
+		}
+		ndjsonOut.CloseWithError(w.Close())
+	}()
+
+	r := NewReader[item](ndjsonIn)
+	for i := 0; ; i++ {
+		v, err := r.Next()
+		if err == io.EOF {
+			if i != n {
+				t.Errorf("got %d records, want %d", i, n)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if v.Qty != i || r.Format() != NDJSON {
+			t.Fatalf("got record %v in %v, want %d in ndjson", v, r.Format(), i)
+		}
+	}
+}
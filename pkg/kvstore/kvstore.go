@@ -0,0 +1,321 @@
+// Package kvstore generalizes the Stateful Goroutines example into a typed key/value store. As in the
+// example, the map is owned by a single Goroutine and every operation is a message sent to it with a channel
+// for the reply, so no locks are needed. On top of get and set the store supports delete, compare-and-swap,
+// per-key expiry, ordered range scans and point-in-time snapshots, and it can be stopped.
+package kvstore
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// ErrStopped is returned by every operation on a store that has been stopped.
+var ErrStopped = errors.New("kvstore: store stopped")
+
+// Ordered is satisfied by the key types that support the < operator, which range scans rely on.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Entry is a key and its value as seen by Range and Snapshot. Expires is zero for keys without a TTL.
+type Entry[K Ordered, V comparable] struct {
+	Key     K
+	Value   V
+	Expires time.Time
+}
+
+// Snapshot is a consistent copy of the whole store taken at At, sorted by key.
+type Snapshot[K Ordered, V comparable] struct {
+	At      time.Time
+	Entries []Entry[K, V]
+}
+
+// Option configures a Store.
+type Option func(*options)
+
+type options struct {
+	clock clock.Clock
+}
+
+// WithClock sets the clock used for expiry. The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// The owning Goroutine receives these ops, each carrying its own reply channel, just like ReadOp and
+// WriteOp in the example. Reply channels are buffered so the owner never blocks on a caller.
+type getOp[K Ordered, V comparable] struct {
+	key  K
+	resp chan getResult[V]
+}
+
+type getResult[V comparable] struct {
+	val V
+	ok  bool
+}
+
+type setOp[K Ordered, V comparable] struct {
+	key  K
+	val  V
+	ttl  time.Duration
+	resp chan struct{}
+}
+
+type deleteOp[K Ordered] struct {
+	key  K
+	resp chan bool
+}
+
+type casOp[K Ordered, V comparable] struct {
+	key      K
+	old, new V
+	resp     chan bool
+}
+
+type rangeOp[K Ordered, V comparable] struct {
+	from, to K
+	all      bool
+	resp     chan Snapshot[K, V]
+}
+
+type item[V comparable] struct {
+	val     V
+	expires time.Time
+}
+
+// Store is a key/value store owned by a single Goroutine. The zero value is not usable; call New.
+type Store[K Ordered, V comparable] struct {
+	clock   clock.Clock
+	gets    chan getOp[K, V]
+	sets    chan setOp[K, V]
+	deletes chan deleteOp[K]
+	cases   chan casOp[K, V]
+	ranges  chan rangeOp[K, V]
+	stop    chan struct{}
+	done    chan struct{}
+
+	stopOnce sync.Once
+}
+
+// New starts the owning Goroutine and returns the store. Call Stop to release it.
+func New[K Ordered, V comparable](opts ...Option) *Store[K, V] {
+	o := options{clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Store[K, V]{
+		clock:   o.clock,
+		gets:    make(chan getOp[K, V]),
+		sets:    make(chan setOp[K, V]),
+		deletes: make(chan deleteOp[K]),
+		cases:   make(chan casOp[K, V]),
+		ranges:  make(chan rangeOp[K, V]),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.own()
+	return s
+}
+
+// own is the Goroutine that owns the state. It selects on every op channel, plus a timer for the next key
+// due to expire and the stop channel.
+func (s *Store[K, V]) own() {
+	defer close(s.done)
+
+	state := make(map[K]item[V])
+	var expiries expiryHeap[K]
+	timer := s.clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	// live returns the item for key if it exists and has not expired.
+	live := func(key K, now time.Time) (item[V], bool) {
+		it, ok := state[key]
+		if ok && !it.expires.IsZero() && !now.Before(it.expires) {
+			delete(state, key)
+			return item[V]{}, false
+		}
+		return it, ok
+	}
+	// rearm points the timer at the earliest expiry, dropping heap entries for keys that have since been
+	// overwritten or deleted.
+	rearm := func(now time.Time) {
+		for expiries.Len() > 0 {
+			next := expiries[0]
+			if it, ok := state[next.key]; !ok || !it.expires.Equal(next.at) {
+				heap.Pop(&expiries)
+				continue
+			}
+			if !now.Before(next.at) {
+				delete(state, next.key)
+				heap.Pop(&expiries)
+				continue
+			}
+			timer.Reset(next.at.Sub(now))
+			return
+		}
+		timer.Stop()
+	}
+
+	for {
+		select {
+		case op := <-s.gets:
+			it, ok := live(op.key, s.clock.Now())
+			op.resp <- getResult[V]{val: it.val, ok: ok}
+		case op := <-s.sets:
+			now := s.clock.Now()
+			it := item[V]{val: op.val}
+			if op.ttl > 0 {
+				it.expires = now.Add(op.ttl)
+				heap.Push(&expiries, expiry[K]{key: op.key, at: it.expires})
+			}
+			state[op.key] = it
+			rearm(now)
+			op.resp <- struct{}{}
+		case op := <-s.deletes:
+			_, ok := live(op.key, s.clock.Now())
+			delete(state, op.key)
+			op.resp <- ok
+		case op := <-s.cases:
+			now := s.clock.Now()
+			it, ok := live(op.key, now)
+			swapped := ok && it.val == op.old
+			if swapped {
+				it.val = op.new
+				state[op.key] = it
+			}
+			op.resp <- swapped
+		case op := <-s.ranges:
+			now := s.clock.Now()
+			snap := Snapshot[K, V]{At: now}
+			for k := range state {
+				if !op.all && (k < op.from || !(k < op.to)) {
+					continue
+				}
+				if it, ok := live(k, now); ok {
+					snap.Entries = append(snap.Entries, Entry[K, V]{Key: k, Value: it.val, Expires: it.expires})
+				}
+			}
+			sort.Slice(snap.Entries, func(i, j int) bool { return snap.Entries[i].Key < snap.Entries[j].Key })
+			op.resp <- snap
+		case <-timer.C():
+			rearm(s.clock.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// send delivers an op to the owner, or reports ErrStopped if the owner has exited.
+func send[T any](done <-chan struct{}, ch chan<- T, op T) error {
+	select {
+	case ch <- op:
+		return nil
+	case <-done:
+		return ErrStopped
+	}
+}
+
+// Get returns the value stored under key and whether it was present.
+func (s *Store[K, V]) Get(key K) (V, bool, error) {
+	op := getOp[K, V]{key: key, resp: make(chan getResult[V], 1)}
+	if err := send(s.done, s.gets, op); err != nil {
+		var zero V
+		return zero, false, err
+	}
+	res := <-op.resp
+	return res.val, res.ok, nil
+}
+
+// Set stores val under key with no expiry.
+func (s *Store[K, V]) Set(key K, val V) error {
+	return s.SetTTL(key, val, 0)
+}
+
+// SetTTL stores val under key. The key expires after ttl; a ttl of 0 or less means it never does.
+func (s *Store[K, V]) SetTTL(key K, val V, ttl time.Duration) error {
+	op := setOp[K, V]{key: key, val: val, ttl: ttl, resp: make(chan struct{}, 1)}
+	if err := send(s.done, s.sets, op); err != nil {
+		return err
+	}
+	<-op.resp
+	return nil
+}
+
+// Delete removes key and reports whether it was present.
+func (s *Store[K, V]) Delete(key K) (bool, error) {
+	op := deleteOp[K]{key: key, resp: make(chan bool, 1)}
+	if err := send(s.done, s.deletes, op); err != nil {
+		return false, err
+	}
+	return <-op.resp, nil
+}
+
+// CompareAndSwap replaces the value under key with new only if key is present and currently holds old. The
+// key's expiry, if any, is kept. It reports whether the swap happened.
+func (s *Store[K, V]) CompareAndSwap(key K, old, new V) (bool, error) {
+	op := casOp[K, V]{key: key, old: old, new: new, resp: make(chan bool, 1)}
+	if err := send(s.done, s.cases, op); err != nil {
+		return false, err
+	}
+	return <-op.resp, nil
+}
+
+// Range returns the entries with from <= key < to, sorted by key.
+func (s *Store[K, V]) Range(from, to K) ([]Entry[K, V], error) {
+	snap, err := s.scan(rangeOp[K, V]{from: from, to: to})
+	return snap.Entries, err
+}
+
+// Snapshot returns a copy of every entry. Because the owner builds it between two ops, it reflects a single
+// point in time.
+func (s *Store[K, V]) Snapshot() (Snapshot[K, V], error) {
+	return s.scan(rangeOp[K, V]{all: true})
+}
+
+func (s *Store[K, V]) scan(op rangeOp[K, V]) (Snapshot[K, V], error) {
+	op.resp = make(chan Snapshot[K, V], 1)
+	if err := send(s.done, s.ranges, op); err != nil {
+		return Snapshot[K, V]{}, err
+	}
+	return <-op.resp, nil
+}
+
+// Stop shuts down the owning Goroutine and waits for it to exit. Calling Stop more than once is safe.
+func (s *Store[K, V]) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+// Done returns a channel that is closed once the store has stopped.
+func (s *Store[K, V]) Done() <-chan struct{} {
+	return s.done
+}
+
+type expiry[K Ordered] struct {
+	key K
+	at  time.Time
+}
+
+// expiryHeap orders pending expiries so the owner only ever needs a timer for the earliest one.
+type expiryHeap[K Ordered] []expiry[K]
+
+func (h expiryHeap[K]) Len() int            { return len(h) }
+func (h expiryHeap[K]) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h expiryHeap[K]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap[K]) Push(x interface{}) { *h = append(*h, x.(expiry[K])) }
+func (h *expiryHeap[K]) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
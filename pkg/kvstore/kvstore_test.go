@@ -0,0 +1,130 @@
+package kvstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+func TestGetSetDelete(t *testing.T) {
+	s := New[int, int]()
+	defer s.Stop()
+
+	if err := s.Set(1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := s.Get(1); !ok || v != 10 {
+		t.Errorf("Get(1) = %d, %v, want 10, true", v, ok)
+	}
+	if ok, _ := s.Delete(1); !ok {
+		t.Error("Delete(1) reported the key missing")
+	}
+	if _, ok, _ := s.Get(1); ok {
+		t.Error("key 1 still present after Delete")
+	}
+	if ok, _ := s.Delete(1); ok {
+		t.Error("second Delete(1) reported the key present")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	s := New[string, int]()
+	defer s.Stop()
+
+	var tests = []struct {
+		key      string
+		old, new int
+		want     bool
+	}{
+		{"missing", 0, 1, false},
+		{"a", 1, 2, true},
+		{"a", 1, 3, false},
+		{"a", 2, 3, true},
+	}
+	s.Set("a", 1)
+	for _, tt := range tests {
+		got, err := s.CompareAndSwap(tt.key, tt.old, tt.new)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CompareAndSwap(%q, %d, %d) = %v, want %v", tt.key, tt.old, tt.new, got, tt.want)
+		}
+	}
+	if v, _, _ := s.Get("a"); v != 3 {
+		t.Errorf("got %d, want 3", v)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := clock.NewFake(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	s := New[string, string](WithClock(c))
+	defer s.Stop()
+
+	s.SetTTL("short", "x", time.Second)
+	s.SetTTL("long", "y", time.Minute)
+	s.Set("forever", "z")
+
+	c.Advance(2 * time.Second)
+	if _, ok, _ := s.Get("short"); ok {
+		t.Error("short-lived key survived its TTL")
+	}
+	if _, ok, _ := s.Get("long"); !ok {
+		t.Error("long-lived key expired early")
+	}
+
+	// Expired keys are left out of snapshots as well as reads.
+	c.Advance(time.Minute)
+	snap, _ := s.Snapshot()
+	if len(snap.Entries) != 1 || snap.Entries[0].Key != "forever" {
+		t.Errorf("got %v, want only the key without a TTL", snap.Entries)
+	}
+}
+
+func TestRangeAndSnapshot(t *testing.T) {
+	s := New[int, string]()
+	defer s.Stop()
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		s.Set(i, v)
+	}
+
+	got, err := s.Range(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b", "c", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Value != want[i] || got[i].Key != i+1 {
+			t.Errorf("entry %d: got %v, want %d=%s", i, got[i], i+1, want[i])
+		}
+	}
+
+	snap, _ := s.Snapshot()
+	s.Set(9, "z")
+	if len(snap.Entries) != 5 {
+		t.Errorf("snapshot changed after a later Set: got %d entries, want 5", len(snap.Entries))
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := New[int, int]()
+	s.Stop()
+	s.Stop()
+
+	if err := s.Set(1, 1); !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v, want %v", err, ErrStopped)
+	}
+	if _, _, err := s.Get(1); !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v, want %v", err, ErrStopped)
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Error("Done channel not closed after Stop")
+	}
+}
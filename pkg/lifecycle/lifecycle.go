@@ -0,0 +1,297 @@
+// Package lifecycle runs an HTTP server the way the Signals example suggests a server should behave. Instead
+// of http.ListenAndServe followed by a panic, a Server listens on any number of addresses and, on SIGINT or
+// SIGTERM, stops accepting connections and lets in-flight requests finish through http.Server.Shutdown,
+// reporting how many are left while it waits. Requests still running when the shutdown deadline passes are
+// cut off. A second SIGINT or SIGTERM while draining cuts them off at once. SIGHUP calls a reload hook so a
+// server can re-read its configuration without restarting.
+package lifecycle
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrForcedShutdown is returned by Serve when requests were still running at the shutdown deadline, or when
+// a second shutdown signal cut the drain short.
+var ErrForcedShutdown = errors.New("lifecycle: requests cut off during shutdown")
+
+// Option configures a Server.
+type Option func(*config)
+
+type config struct {
+	addrs           []string
+	shutdownTimeout time.Duration
+	reportInterval  time.Duration
+	reload          func() error
+	logger          *log.Logger
+	signals         <-chan os.Signal
+	configure       func(*http.Server)
+	tls             *tls.Config
+}
+
+// WithAddrs sets the addresses to listen on. The default is ":8090", the port the examples use.
+func WithAddrs(addrs ...string) Option {
+	return func(c *config) {
+		c.addrs = addrs
+	}
+}
+
+// WithShutdownTimeout sets how long in-flight requests get to finish after a shutdown signal. The default is
+// 10 seconds.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.shutdownTimeout = d
+	}
+}
+
+// WithReportInterval sets how often the number of in-flight requests is logged while draining. The default
+// is one second.
+func WithReportInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.reportInterval = d
+	}
+}
+
+// WithReload sets the function called on SIGHUP. A reload error is logged and the server keeps running.
+func WithReload(reload func() error) Option {
+	return func(c *config) {
+		c.reload = reload
+	}
+}
+
+// WithLogger sets where lifecycle events are logged. The default is log.Default().
+func WithLogger(l *log.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithSignals makes the server react to signals sent on ch instead of registering with signal.Notify. It is
+// mostly useful in tests.
+func WithSignals(ch <-chan os.Signal) Option {
+	return func(c *config) {
+		c.signals = ch
+	}
+}
+
+// WithHTTPServer lets the caller adjust the underlying http.Server, for example to set its timeouts, before
+// it starts serving. Its Handler and Addr are managed by the Server and should be left alone.
+func WithHTTPServer(configure func(*http.Server)) Option {
+	return func(c *config) {
+		c.configure = configure
+	}
+}
+
+// WithTLS serves HTTPS on every address with the given configuration, which must hold a certificate. HTTP/2 is
+// enabled unless the configuration's NextProtos leaves it out.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *config) {
+		c.tls = cfg
+	}
+}
+
+// Server is an HTTP server with graceful shutdown.
+type Server struct {
+	cfg       config
+	srv       *http.Server
+	listeners []net.Listener
+	inFlight  int64
+}
+
+// New returns a Server that serves h.
+func New(h http.Handler, opts ...Option) *Server {
+	cfg := config{
+		addrs:           []string{":8090"},
+		shutdownTimeout: 10 * time.Second,
+		reportInterval:  time.Second,
+		logger:          log.Default(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &Server{cfg: cfg}
+	s.srv = &http.Server{Handler: s.track(h), ReadHeaderTimeout: 10 * time.Second, TLSConfig: cfg.tls}
+	if cfg.configure != nil {
+		cfg.configure(s.srv)
+	}
+	return s
+}
+
+// track counts the requests h is serving.
+func (s *Server) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of requests currently being served.
+func (s *Server) InFlight() int {
+	return int(atomic.LoadInt64(&s.inFlight))
+}
+
+// Listen opens a listener on every configured address. If any of them fails the others are closed again.
+// Serve calls Listen itself if it hasn't been called; calling it first lets the caller find out which ports
+// were chosen for addresses such as "localhost:0".
+func (s *Server) Listen() error {
+	if s.listeners != nil {
+		return nil
+	}
+	for _, addr := range s.cfg.addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range s.listeners {
+				l.Close()
+			}
+			s.listeners = nil
+			return fmt.Errorf("lifecycle: %w", err)
+		}
+		s.listeners = append(s.listeners, l)
+	}
+	return nil
+}
+
+// Addrs returns the addresses being listened on, or nil before Listen.
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Serve serves requests until ctx is done, a SIGINT or SIGTERM arrives, or a listener fails, and then shuts
+// down gracefully. It returns nil after a clean shutdown, ErrForcedShutdown if requests had to be cut off,
+// or the listener's error.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	sigs := s.cfg.signals
+	if sigs == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(ch)
+		sigs = ch
+	}
+
+	// Every listener shares the one http.Server, so a single Shutdown stops them all.
+	serveErr := make(chan error, len(s.listeners))
+	var wg sync.WaitGroup
+	for _, l := range s.listeners {
+		wg.Add(1)
+		go func(l net.Listener) {
+			defer wg.Done()
+			var err error
+			// ServeTLS takes the certificate from TLSConfig when given no files, and sets up HTTP/2 as
+			// ListenAndServeTLS would.
+			if s.srv.TLSConfig != nil {
+				s.cfg.logger.Printf("lifecycle: listening on %s with TLS", l.Addr())
+				err = s.srv.ServeTLS(l, "", "")
+			} else {
+				s.cfg.logger.Printf("lifecycle: listening on %s", l.Addr())
+				err = s.srv.Serve(l)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}(l)
+	}
+	defer wg.Wait()
+
+	var failed error
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			s.cfg.logger.Printf("lifecycle: %v, shutting down", ctx.Err())
+			break wait
+		case err := <-serveErr:
+			s.cfg.logger.Printf("lifecycle: serve: %v, shutting down", err)
+			failed = fmt.Errorf("lifecycle: %w", err)
+			break wait
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				s.reload()
+				continue
+			}
+			s.cfg.logger.Printf("lifecycle: received %v, shutting down", sig)
+			break wait
+		}
+	}
+
+	if err := s.shutdown(sigs); err != nil {
+		return err
+	}
+	return failed
+}
+
+func (s *Server) reload() {
+	if s.cfg.reload == nil {
+		s.cfg.logger.Printf("lifecycle: received SIGHUP, nothing to reload")
+		return
+	}
+	if err := s.cfg.reload(); err != nil {
+		s.cfg.logger.Printf("lifecycle: reload failed: %v", err)
+		return
+	}
+	s.cfg.logger.Printf("lifecycle: configuration reloaded")
+}
+
+// shutdown drains the server, logging progress, until every request is done, the deadline passes or another
+// shutdown signal arrives.
+func (s *Server) shutdown(sigs <-chan os.Signal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.shutdownTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- s.srv.Shutdown(ctx) }()
+
+	ticker := time.NewTicker(s.cfg.reportInterval)
+	defer ticker.Stop()
+	s.cfg.logger.Printf("lifecycle: draining, %d requests in flight", s.InFlight())
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				s.cfg.logger.Printf("lifecycle: shutdown complete")
+				return nil
+			}
+			n := s.InFlight()
+			s.srv.Close()
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				s.cfg.logger.Printf("lifecycle: cut off %d requests", n)
+				return ErrForcedShutdown
+			}
+			return fmt.Errorf("lifecycle: shutdown: %w", err)
+		case <-ticker.C:
+			s.cfg.logger.Printf("lifecycle: draining, %d requests in flight", s.InFlight())
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				continue
+			}
+			s.cfg.logger.Printf("lifecycle: received %v again, cutting off %d requests", sig, s.InFlight())
+			cancel()
+		}
+	}
+}
+
+// ListenAndServe serves h with the given options until a shutdown signal arrives or ctx is done. It is the
+// graceful replacement for http.ListenAndServe.
+func ListenAndServe(ctx context.Context, h http.Handler, opts ...Option) error {
+	return New(h, opts...).Serve(ctx)
+}
@@ -0,0 +1,209 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/tlsutil"
+)
+
+// start listens on a loopback port and serves h in the background. The returned channel delivers Serve's
+// result.
+func start(t *testing.T, ctx context.Context, h http.Handler, opts ...Option) (*Server, chan<- os.Signal, <-chan error) {
+	t.Helper()
+	sigs := make(chan os.Signal, 1)
+	opts = append([]Option{WithAddrs("127.0.0.1:0"), WithSignals(sigs)}, opts...)
+	s := New(h, opts...)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+	return s, sigs, done
+}
+
+// waitInFlight polls until the server is serving n requests.
+func waitInFlight(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.InFlight() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d requests in flight, want %d", s.InFlight(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "done")
+	})
+	var logs bytes.Buffer
+	s, sigs, done := start(t, context.Background(), h,
+		WithLogger(log.New(&logs, "", 0)), WithReportInterval(5*time.Millisecond))
+
+	type response struct {
+		body string
+		err  error
+	}
+	got := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.Addrs()[0].String())
+		if err != nil {
+			got <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		got <- response{string(b), err}
+	}()
+	waitInFlight(t, s, 1)
+
+	sigs <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		t.Fatalf("Serve returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if r := <-got; r.err != nil || r.body != "done" {
+		t.Errorf("got %q, %v, want the in-flight request to complete", r.body, r.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("got %v, want a clean shutdown", err)
+	}
+	if !strings.Contains(logs.String(), "draining, 1 requests in flight") {
+		t.Errorf("got logs %q, want the in-flight count reported", logs.String())
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		again   bool
+	}{
+		{"deadline", 20 * time.Millisecond, false},
+		{"second signal", time.Minute, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			})
+			s, sigs, done := start(t, context.Background(), h,
+				WithLogger(log.New(io.Discard, "", 0)), WithShutdownTimeout(test.timeout))
+
+			go func() {
+				if resp, err := http.Get("http://" + s.Addrs()[0].String()); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			waitInFlight(t, s, 1)
+
+			sigs <- syscall.SIGINT
+			if test.again {
+				sigs <- syscall.SIGINT
+			}
+			select {
+			case err := <-done:
+				if !errors.Is(err, ErrForcedShutdown) {
+					t.Errorf("got %v, want %v", err, ErrForcedShutdown)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Serve did not return")
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	reloads := make(chan struct{}, 2)
+	reload := func() error {
+		reloads <- struct{}{}
+		if len(reloads) == 2 {
+			return errors.New("bad config")
+		}
+		return nil
+	}
+	var logs bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	_, sigs, done := start(t, ctx, http.NotFoundHandler(), WithReload(reload), WithLogger(log.New(&logs, "", 0)))
+
+	sigs <- syscall.SIGHUP
+	sigs <- syscall.SIGHUP
+	for len(reloads) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("got %v, want a clean shutdown", err)
+	}
+	for _, want := range []string{"configuration reloaded", "reload failed: bad config"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("got logs %q, want %q", logs.String(), want)
+		}
+	}
+}
+
+func TestListenFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	s := New(http.NotFoundHandler(), WithAddrs("127.0.0.1:0", busy.Addr().String()))
+	if err := s.Listen(); err == nil {
+		t.Fatal("Listen on a busy address succeeded")
+	}
+	if len(s.Addrs()) != 0 {
+		t.Errorf("got %d open listeners after a failure, want 0", len(s.Addrs()))
+	}
+}
+
+func TestTLS(t *testing.T) {
+	files, err := tlsutil.Generate(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg, err := tlsutil.ServerConfig(files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg, err := tlsutil.ClientConfig(files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, r.Proto) })
+	s, sigs, done := start(t, context.Background(), h, WithTLS(serverCfg), WithLogger(log.New(io.Discard, "", 0)))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg, ForceAttemptHTTP2: true}}
+	resp, err := client.Get("https://" + s.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "HTTP/2.0" {
+		t.Errorf("got %q, want HTTP/2.0", b)
+	}
+
+	sigs <- syscall.SIGTERM
+	if err := <-done; err != nil {
+		t.Errorf("got %v, want a clean shutdown", err)
+	}
+}
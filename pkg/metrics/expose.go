@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the Prometheus text exposition format written by WriteTo.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns an http.Handler that serves the registry in the Prometheus text format, ready to be
+// mounted on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes every family, sorted by name, in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (f *family) write(w *bufio.Writer) {
+	w.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + string(f.kind) + "\n")
+
+	f.mu.RLock()
+	children := make([]*child, 0, len(f.children))
+	for _, c := range f.children {
+		children = append(children, c)
+	}
+	f.mu.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i].values, children[j].values
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	for _, c := range children {
+		labels := formatLabels(f.labels, c.values)
+		switch m := c.metric.(type) {
+		case *Counter:
+			writeSample(w, f.name, labels, "", strconv.FormatUint(m.Value(), 10))
+		case *Gauge:
+			writeSample(w, f.name, labels, "", formatFloat(m.Value()))
+		case *Histogram:
+			// Buckets are exposed cumulatively: each one counts every observation at or below its bound.
+			var cumulative uint64
+			for i, upper := range m.upper {
+				cumulative += atomic.LoadUint64(&m.buckets[i])
+				writeSample(w, f.name+"_bucket", labels, `le="`+formatFloat(upper)+`"`, strconv.FormatUint(cumulative, 10))
+			}
+			// Read last, so it includes every observation the buckets above saw.
+			count := m.Count()
+			writeSample(w, f.name+"_bucket", labels, `le="+Inf"`, strconv.FormatUint(count, 10))
+			writeSample(w, f.name+"_sum", labels, "", formatFloat(m.Sum()))
+			writeSample(w, f.name+"_count", labels, "", strconv.FormatUint(count, 10))
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name, labels, extra, value string) {
+	w.WriteString(name)
+	if labels != "" || extra != "" {
+		w.WriteByte('{')
+		w.WriteString(labels)
+		if labels != "" && extra != "" {
+			w.WriteByte(',')
+		}
+		w.WriteString(extra)
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,291 @@
+// Package metrics grows the Atomic Counters example into a small instrumentation library. Counters, gauges
+// and histograms are updated with sync/atomic, so recording a value never takes a lock, and a Registry
+// serves everything it holds in the Prometheus text exposition format.
+//
+//	reg := metrics.NewRegistry()
+//	requests := reg.CounterVec("http_requests_total", "Requests served.", "path")
+//	requests.With("/hello").Inc()
+//	http.Handle("/metrics", reg.Handler())
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// DefaultBuckets are histogram upper bounds suited to request latencies measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Counter is a value that only goes up, such as the number of requests served.
+type Counter struct {
+	n uint64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.n, n)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+// Gauge is a value that can go up and down, such as the number of requests in flight.
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds v, which may be negative, to the gauge.
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// addFloat atomically adds v to the float64 stored as bits in addr.
+func addFloat(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(addr, old, next) {
+			return
+		}
+	}
+}
+
+// Histogram counts observations, such as request durations, in a fixed set of buckets.
+type Histogram struct {
+	count   uint64
+	sumBits uint64
+	upper   []float64
+	buckets []uint64
+}
+
+func newHistogram(upper []float64) *Histogram {
+	return &Histogram{upper: upper, buckets: make([]uint64, len(upper))}
+}
+
+// Observe records v in the first bucket whose upper bound is at least v. Values above every bound are only
+// reflected in the +Inf bucket, the count and the sum.
+func (h *Histogram) Observe(v float64) {
+	// The count goes up before the bucket, and the exposition reads it after the buckets, so a scrape that
+	// races an observation never shows a bucket bigger than the count.
+	atomic.AddUint64(&h.count, 1)
+	addFloat(&h.sumBits, v)
+	if i := sort.SearchFloat64s(h.upper, v); i < len(h.upper) {
+		atomic.AddUint64(&h.buckets[i], 1)
+	}
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+}
+
+// kind is the Prometheus TYPE of a family.
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// family is every metric sharing one name, each child told apart by its label values.
+type family struct {
+	name, help string
+	kind       kind
+	labels     []string
+	buckets    []float64
+
+	mu       sync.RWMutex
+	children map[string]*child
+}
+
+type child struct {
+	values []string
+	metric interface{}
+}
+
+// with returns the child for values, creating it on first use.
+func (f *family) with(values []string) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	key := childKey(values)
+
+	f.mu.RLock()
+	c, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.children[key]; ok {
+		return c.metric
+	}
+	c = &child{values: append([]string(nil), values...)}
+	switch f.kind {
+	case counterKind:
+		c.metric = &Counter{}
+	case gaugeKind:
+		c.metric = &Gauge{}
+	case histogramKind:
+		c.metric = newHistogram(f.buckets)
+	}
+	f.children[key] = c
+	return c.metric
+}
+
+// childKey joins label values into a map key. Each value is prefixed with its length so that no two
+// different lists of values can produce the same key.
+func childKey(values []string) string {
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteByte(':')
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct{ f *family }
+
+// With returns the counter for the given label values, in the order the labels were declared.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.f.with(values).(*Counter)
+}
+
+// GaugeVec is a family of gauges partitioned by label values.
+type GaugeVec struct{ f *family }
+
+// With returns the gauge for the given label values, in the order the labels were declared.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values).(*Gauge)
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct{ f *family }
+
+// With returns the histogram for the given label values, in the order the labels were declared.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values).(*Histogram)
+}
+
+// Registry holds metric families and writes them out for scraping. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// register adds a family, panicking on invalid or duplicate names since those are programming errors.
+func (r *Registry) register(name, help string, k kind, buckets []float64, labels []string) *family {
+	if !metricNameRE.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labels {
+		if !labelNameRE.MatchString(l) || strings.HasPrefix(l, "__") || (k == histogramKind && l == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q for %s", l, name))
+		}
+	}
+	f := &family{
+		name:     name,
+		help:     help,
+		kind:     k,
+		labels:   append([]string(nil), labels...),
+		buckets:  buckets,
+		children: make(map[string]*child),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.families[name]; dup {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.families[name] = f
+	return f
+}
+
+// Counter registers and returns a counter without labels.
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+// CounterVec registers a counter family with the given label names.
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, counterKind, nil, labels)}
+}
+
+// Gauge registers and returns a gauge without labels.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+// GaugeVec registers a gauge family with the given label names.
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, gaugeKind, nil, labels)}
+}
+
+// Histogram registers and returns a histogram without labels. A nil buckets uses DefaultBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+// HistogramVec registers a histogram family with the given bucket upper bounds and label names. A nil
+// buckets uses DefaultBuckets.
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	return &HistogramVec{r.register(name, help, histogramKind, upper, labels)}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentCounter(t *testing.T) {
+	// The same workload as the Atomic Counters example: 50 Goroutines each counting to 1000.
+	reg := NewRegistry()
+	ops := reg.Counter("ops_total", "Operations performed.")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := 0; c < 1000; c++ {
+				ops.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := ops.Value(); got != 50000 {
+		t.Errorf("got %d, want 50000", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.CounterVec("http_requests_total", "Requests served.", "path", "code")
+	requests.With("/hello", "200").Add(3)
+	requests.With("/headers", "200").Inc()
+	requests.With(`/quote"d`, "404").Inc()
+
+	inFlight := reg.Gauge("http_in_flight", "Requests being served.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	latency := reg.Histogram("http_request_seconds", "Request latency.\nIn seconds.", []float64{0.5, 0.1})
+	latency.Observe(0.05)
+	latency.Observe(0.3)
+	latency.Observe(2)
+
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != ContentType {
+		t.Errorf("got Content-Type %q, want %q", ct, ContentType)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP http_in_flight Requests being served.
+# TYPE http_in_flight gauge
+http_in_flight 1
+# HELP http_request_seconds Request latency.\nIn seconds.
+# TYPE http_request_seconds histogram
+http_request_seconds_bucket{le="0.1"} 1
+http_request_seconds_bucket{le="0.5"} 2
+http_request_seconds_bucket{le="+Inf"} 3
+http_request_seconds_sum 2.35
+http_request_seconds_count 3
+# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{path="/headers",code="200"} 1
+http_requests_total{path="/hello",code="200"} 3
+http_requests_total{path="/quote\"d",code="404"} 1
+`
+	if string(body) != want {
+		t.Errorf("got\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	var tests = []struct {
+		name     string
+		register func(r *Registry)
+	}{
+		{"bad metric name", func(r *Registry) { r.Counter("1bad", "") }},
+		{"bad label name", func(r *Registry) { r.CounterVec("ok", "", "bad-label") }},
+		{"reserved le label", func(r *Registry) { r.HistogramVec("ok", "", nil, "le") }},
+		{"duplicate", func(r *Registry) { r.Counter("dup", ""); r.Gauge("dup", "") }},
+		{"wrong label count", func(r *Registry) { r.CounterVec("ok", "", "a").With("x", "y") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.register(NewRegistry())
+		})
+	}
+}
+
+func TestHistogramLabels(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.HistogramVec("size_bytes", "Sizes.", []float64{10}, "kind")
+	h.With("a").Observe(5)
+	h.With("a").Observe(50)
+
+	var b strings.Builder
+	reg.WriteTo(&b)
+	for _, line := range []string{
+		`size_bytes_bucket{kind="a",le="10"} 1`,
+		`size_bytes_bucket{kind="a",le="+Inf"} 2`,
+		`size_bytes_count{kind="a"} 2`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing line %q in\n%s", line, b.String())
+		}
+	}
+}
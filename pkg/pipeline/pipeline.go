@@ -0,0 +1,286 @@
+// Package pipeline builds concurrent pipelines out of the channel examples. Each stage is a function that
+// takes a receive-only channel, starts a Goroutine and returns a receive-only channel for the next stage, so
+// stages compose like ordinary function calls:
+//
+//	squares := pipeline.Map(ctx, pipeline.Generate(ctx, 1, 2, 3), 4, square)
+//	for batch := range pipeline.Batch(ctx, squares, 100, time.Second) { ... }
+//
+// Every stage follows the same rules. A stage closes its output once its input is closed and everything
+// has been passed on, and it gives up as soon as ctx is done, closing its output without waiting for the
+// consumer. Cancelling ctx therefore tears down a whole pipeline without leaking Goroutines, even if nobody
+// reads the final output.
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// send delivers v on out, returning false if ctx is done first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Generate emits values in order and then closes its output.
+func Generate[T any](ctx context.Context, values ...T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for _, v := range values {
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// GenerateFunc emits the values returned by next until it reports false.
+func GenerateFunc[T any](ctx context.Context, next func() (T, bool)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := next()
+			if !ok || !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Map applies fn to every input on workers Goroutines. Results are emitted as they finish, so their order
+// is not preserved when workers is more than 1. Values below 1 are treated as 1.
+func Map[In, Out any](ctx context.Context, in <-chan In, workers int, fn func(context.Context, In) Out) <-chan Out {
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan Out)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case v, ok := <-in:
+					if !ok || !send(ctx, out, fn(ctx, v)) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// Only the last worker to finish may close out, since the others could still be sending.
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// Filter passes on the inputs for which keep returns true.
+func Filter[T any](ctx context.Context, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if keep(v) && !send(ctx, out, v) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FanIn merges several channels into one. The output is closed once every input has been closed.
+func FanIn[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func(in <-chan T) {
+			defer wg.Done()
+			for {
+				select {
+				case v, ok := <-in:
+					if !ok || !send(ctx, out, v) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(in)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// Tee copies every input to n outputs. A value is delivered on every output before the next one is read, so
+// the outputs move in lockstep and must be consumed concurrently.
+func Tee[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T)
+		result[i] = outs[i]
+	}
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				// Send to whichever outputs are ready first, so one slow reader does not hold the
+				// others back within a single value.
+				pending := make([]chan T, n)
+				copy(pending, outs)
+				for left := n; left > 0; left-- {
+					if !sendAny(ctx, pending, v) {
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// sendAny sends v on the first ready channel in pending and sets that entry to nil, so each call reaches a
+// different output. A select statement needs a fixed set of cases, so reflect.Select builds one for the
+// outputs still waiting plus ctx.Done().
+func sendAny[T any](ctx context.Context, pending []chan T, v T) bool {
+	// Going through a pointer keeps the static type of v, which matters when T is an interface holding nil.
+	val := reflect.ValueOf(&v).Elem()
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	index := []int{-1}
+	for i, out := range pending {
+		if out != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: val})
+			index = append(index, i)
+		}
+	}
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == 0 {
+		return false
+	}
+	pending[index[chosen]] = nil
+	return true
+}
+
+// Batch groups inputs into slices of up to size values. A partial batch is emitted once maxWait has passed
+// since its first value arrived, or when the input is closed; a maxWait of 0 disables the time limit.
+func Batch[T any](ctx context.Context, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	if size < 1 {
+		size = 1
+	}
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var batch []T
+		var timer *time.Timer
+		var expired <-chan time.Time
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, expired = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					expired = timer.C
+				}
+				if len(batch) >= size && !flush() {
+					return
+				}
+			case <-expired:
+				timer, expired = nil, nil
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Drain reads and discards in until it is closed or ctx is done, and returns how many values it read.
+func Drain[T any](ctx context.Context, in <-chan T) int {
+	n := 0
+	for {
+		select {
+		case _, ok := <-in:
+			if !ok {
+				return n
+			}
+			n++
+		case <-ctx.Done():
+			return n
+		}
+	}
+}
+
+// Collect reads in until it is closed or ctx is done and returns the values in the order received.
+func Collect[T any](ctx context.Context, in <-chan T) []T {
+	var values []T
+	for {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return values
+			}
+			values = append(values, v)
+		case <-ctx.Done():
+			return values
+		}
+	}
+}
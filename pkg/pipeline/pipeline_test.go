@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkLeaks fails the test if the number of Goroutines has not returned to its level at the start of the
+// test by the time the test finishes. Stages exit asynchronously after cancellation, so it polls briefly.
+func checkLeaks(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			after := runtime.NumGoroutine()
+			if after <= before {
+				return
+			}
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				n := runtime.Stack(buf, true)
+				t.Errorf("%d Goroutines leaked:\n%s", after-before, buf[:n])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func square(ctx context.Context, n int) int { return n * n }
+
+func isEven(n int) bool { return n%2 == 0 }
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMapFilter(t *testing.T) {
+	checkLeaks(t)
+	ctx := context.Background()
+
+	got := Collect(ctx, Filter(ctx, Map(ctx, Generate(ctx, 1, 2, 3, 4, 5, 6), 3, square), isEven))
+	sort.Ints(got)
+	if want := []int{4, 16, 36}; !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFanIn(t *testing.T) {
+	checkLeaks(t)
+	ctx := context.Background()
+
+	got := Collect(ctx, FanIn(ctx, Generate(ctx, 1, 2), Generate(ctx, 3), Generate[int](ctx)))
+	sort.Ints(got)
+	if want := []int{1, 2, 3}; !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTee(t *testing.T) {
+	checkLeaks(t)
+	ctx := context.Background()
+
+	outs := Tee(ctx, Generate(ctx, 1, 2, 3), 2)
+	results := make([][]int, len(outs))
+	var wg sync.WaitGroup
+	for i, out := range outs {
+		wg.Add(1)
+		go func(i int, out <-chan int) {
+			defer wg.Done()
+			results[i] = Collect(ctx, out)
+		}(i, out)
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		if want := []int{1, 2, 3}; !equal(got, want) {
+			t.Errorf("output %d: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	checkLeaks(t)
+	ctx := context.Background()
+
+	var sizes []int
+	for b := range Batch(ctx, Generate(ctx, 1, 2, 3, 4, 5, 6, 7), 3, 0) {
+		sizes = append(sizes, len(b))
+	}
+	if want := []int{3, 3, 1}; !equal(sizes, want) {
+		t.Errorf("got batch sizes %v, want %v", sizes, want)
+	}
+
+	// An input that stays open must still produce its partial batch once maxWait passes.
+	in := make(chan int)
+	out := Batch(ctx, in, 10, 20*time.Millisecond)
+	in <- 1
+	in <- 2
+	select {
+	case b := <-out:
+		if !equal(b, []int{1, 2}) {
+			t.Errorf("got %v, want [1 2]", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not flushed after maxWait")
+	}
+	close(in)
+	if _, ok := <-out; ok {
+		t.Error("output not closed after input closed")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	checkLeaks(t)
+	ctx := context.Background()
+
+	if n := Drain(ctx, Generate(ctx, "a", "b", "c")); n != 3 {
+		t.Errorf("got %d, want 3", n)
+	}
+}
+
+func TestCancelDoesNotLeak(t *testing.T) {
+	checkLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// An endless source feeding every kind of stage. Nobody reads most of the outputs, so without
+	// cancellation each stage would block forever on its first send.
+	n := 0
+	source := GenerateFunc(ctx, func() (int, bool) { n++; return n, true })
+	tee := Tee(ctx, source, 2)
+	mapped := Map(ctx, tee[0], 4, square)
+	filtered := Filter(ctx, tee[1], isEven)
+	merged := FanIn(ctx, mapped, filtered)
+	batches := Batch(ctx, merged, 5, time.Hour)
+
+	<-batches
+	cancel()
+}
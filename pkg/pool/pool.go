@@ -0,0 +1,198 @@
+// Package pool is a reusable version of the Worker Pools example. A Pool runs a typed job function on a fixed
+// number of Goroutines, hands each job the caller's context so work can be cancelled, and reports a per-job
+// error alongside every result. Results can be delivered as soon as they finish or in the order the jobs
+// were submitted.
+package pool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Func is the work performed for a single job. It should return promptly once ctx is done.
+type Func[J, R any] func(ctx context.Context, job J) (R, error)
+
+// Result is the outcome of one job. Index is the position of the job in the input, counting from 0.
+type Result[J, R any] struct {
+	Index int
+	Job   J
+	Value R
+	Err   error
+}
+
+// Option configures a Pool.
+type Option func(*config)
+
+type config struct {
+	workers int
+	ordered bool
+}
+
+// WithWorkers sets the number of concurrent workers. Values below 1 are treated as 1. The default is
+// runtime.GOMAXPROCS(0).
+func WithWorkers(n int) Option {
+	return func(c *config) {
+		if n < 1 {
+			n = 1
+		}
+		c.workers = n
+	}
+}
+
+// WithOrdered makes the pool deliver results in the same order the jobs were received. Finished results are
+// held back until every earlier job has been delivered.
+func WithOrdered(ordered bool) Option {
+	return func(c *config) {
+		c.ordered = ordered
+	}
+}
+
+// Pool runs a Func over a stream of jobs. A Pool holds no per-run state, so it is safe to call Run from
+// several Goroutines at once.
+type Pool[J, R any] struct {
+	fn  Func[J, R]
+	cfg config
+}
+
+// New returns a Pool that runs fn. By default results are delivered unordered.
+func New[J, R any](fn Func[J, R], opts ...Option) *Pool[J, R] {
+	cfg := config{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Pool[J, R]{fn: fn, cfg: cfg}
+}
+
+type task[J any] struct {
+	index int
+	job   J
+}
+
+// Run starts the workers and returns a channel of results. The workers read from jobs until it is closed or
+// ctx is done, and the returned channel is closed once every started job has been accounted for.
+//
+// The caller must either read the returned channel until it is closed or cancel ctx; once ctx is done Run
+// stops sending results and releases all of its Goroutines.
+func (p *Pool[J, R]) Run(ctx context.Context, jobs <-chan J) <-chan Result[J, R] {
+	tasks := make(chan task[J])
+	done := make(chan Result[J, R])
+	out := make(chan Result[J, R])
+
+	// The dispatcher numbers each job so the collector can restore the input order if asked to.
+	go func() {
+		defer close(tasks)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case job, ok := <-jobs:
+				if !ok {
+					return
+				}
+				select {
+				case tasks <- task[J]{index: i, job: job}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.cfg.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				res := Result[J, R]{Index: t.index, Job: t.job}
+				if err := ctx.Err(); err != nil {
+					res.Err = err
+				} else {
+					res.Value, res.Err = p.fn(ctx, t.job)
+				}
+				done <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// The collector always drains done, so workers never block on it. Only the send to the caller can be
+	// abandoned, and it is abandoned as soon as ctx is done.
+	go func() {
+		defer close(out)
+		next := 0
+		pending := make(map[int]Result[J, R])
+		cancelled := false
+		send := func(res Result[J, R]) {
+			if cancelled {
+				return
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				cancelled = true
+			}
+		}
+		for res := range done {
+			if !p.cfg.ordered {
+				send(res)
+				continue
+			}
+			pending[res.Index] = res
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				send(r)
+			}
+		}
+	}()
+
+	return out
+}
+
+// Map runs every job in jobs and returns the values in input order. If a job fails, the remaining jobs are
+// cancelled and the first error encountered is returned.
+func (p *Pool[J, R]) Map(ctx context.Context, jobs []J) ([]R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	in := make(chan J)
+	go func() {
+		defer close(in)
+		for _, job := range jobs {
+			select {
+			case in <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	values := make([]R, len(jobs))
+	var firstErr error
+	for res := range p.Run(ctx, in) {
+		if res.Err != nil {
+			if firstErr == nil {
+				firstErr = res.Err
+				cancel()
+			}
+			continue
+		}
+		values[res.Index] = res.Value
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
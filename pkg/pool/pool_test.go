@@ -0,0 +1,159 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+func double(ctx context.Context, j int) (int, error) {
+	return j * 2, nil
+}
+
+func feed(jobs ...int) <-chan int {
+	ch := make(chan int, len(jobs))
+	for _, j := range jobs {
+		ch <- j
+	}
+	close(ch)
+	return ch
+}
+
+func TestRunUnordered(t *testing.T) {
+	p := New(double, WithWorkers(3))
+
+	var got []int
+	for res := range p.Run(context.Background(), feed(1, 2, 3, 4, 5)) {
+		if res.Err != nil {
+			t.Fatalf("job %d: unexpected error %v", res.Job, res.Err)
+		}
+		if res.Value != res.Job*2 {
+			t.Errorf("job %d: got %d, want %d", res.Job, res.Value, res.Job*2)
+		}
+		got = append(got, res.Value)
+	}
+	sort.Ints(got)
+	want := []int{2, 4, 6, 8, 10}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestRunOrdered(t *testing.T) {
+	// Later jobs finish first, so only reordering can put the results back in input order.
+	slowFirst := func(ctx context.Context, j int) (int, error) {
+		time.Sleep(time.Duration(10-j) * time.Millisecond)
+		return j, nil
+	}
+	p := New(slowFirst, WithWorkers(10), WithOrdered(true))
+
+	next := 0
+	for res := range p.Run(context.Background(), feed(0, 1, 2, 3, 4, 5, 6, 7, 8, 9)) {
+		if res.Index != next || res.Value != next {
+			t.Fatalf("got index %d value %d, want %d", res.Index, res.Value, next)
+		}
+		next++
+	}
+	if next != 10 {
+		t.Errorf("got %d results, want 10", next)
+	}
+}
+
+func TestRunPerJobErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+	p := New(func(ctx context.Context, j int) (int, error) {
+		if j%2 == 1 {
+			return 0, errOdd
+		}
+		return j, nil
+	}, WithWorkers(2))
+
+	failed := 0
+	for res := range p.Run(context.Background(), feed(1, 2, 3, 4)) {
+		if res.Job%2 == 1 {
+			if !errors.Is(res.Err, errOdd) {
+				t.Errorf("job %d: got error %v, want %v", res.Job, res.Err, errOdd)
+			}
+			failed++
+		} else if res.Err != nil {
+			t.Errorf("job %d: unexpected error %v", res.Job, res.Err)
+		}
+	}
+	if failed != 2 {
+		t.Errorf("got %d failures, want 2", failed)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	block := func(ctx context.Context, j int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	p := New(block, WithWorkers(2))
+
+	// An unclosed, unbounded job stream: only cancellation can end the run.
+	jobs := make(chan int)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	out := p.Run(ctx, jobs)
+	cancel()
+
+	select {
+	case <-drain(out):
+	case <-time.After(time.Second):
+		t.Fatal("results channel was not closed after cancel")
+	}
+}
+
+func drain[T any](ch <-chan T) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
+
+func TestMap(t *testing.T) {
+	p := New(double, WithWorkers(4))
+	got, err := p.Map(context.Background(), []int{3, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{6, 2, 4}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+
+	errBoom := errors.New("boom")
+	p = New(func(ctx context.Context, j int) (int, error) {
+		if j == 2 {
+			return 0, errBoom
+		}
+		return j, nil
+	})
+	if _, err := p.Map(context.Background(), []int{1, 2, 3}); !errors.Is(err, errBoom) {
+		t.Errorf("got error %v, want %v", err, errBoom)
+	}
+}
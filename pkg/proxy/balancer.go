@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer chooses the backend for a request. Pick is given every backend of the Proxy, in the order they
+// were configured, and must return a healthy one, or nil if there is none. A Balancer may keep state about the
+// backends it has seen, so each Proxy needs its own.
+type Balancer interface {
+	Pick(r *http.Request, backends []*Backend) *Backend
+}
+
+// RoundRobin returns a Balancer that sends requests to each healthy backend in turn.
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (rr *roundRobin) Pick(r *http.Request, backends []*Backend) *Backend {
+	n := uint64(len(backends))
+	start := atomic.AddUint64(&rr.next, 1) - 1
+	for i := uint64(0); i < n; i++ {
+		if b := backends[(start+i)%n]; b.Healthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+// LeastConnections returns a Balancer that sends each request to the healthy backend with the fewest
+// requests in flight, which suits backends whose requests take very different amounts of time. Ties are
+// broken in turn, so an idle pool is still shared out evenly.
+func LeastConnections() Balancer {
+	return &leastConnections{}
+}
+
+type leastConnections struct {
+	next uint64
+}
+
+func (lc *leastConnections) Pick(r *http.Request, backends []*Backend) *Backend {
+	n := uint64(len(backends))
+	start := atomic.AddUint64(&lc.next, 1) - 1
+	var best *Backend
+	for i := uint64(0); i < n; i++ {
+		b := backends[(start+i)%n]
+		if b.Healthy() && (best == nil || b.Active() < best.Active()) {
+			best = b
+		}
+	}
+	return best
+}
+
+// ConsistentHash returns a Balancer that sends all requests with the same key to the same backend, which
+// keeps a client's requests on a backend that may have cached its data. Backends are placed at many points on
+// a hash ring and a key goes to the first healthy backend at or after its own hash, so when a backend goes
+// down only its own keys move, and they move back when it recovers. A nil key function uses ClientIP.
+func ConsistentHash(key func(*http.Request) string) Balancer {
+	if key == nil {
+		key = ClientIP
+	}
+	return &consistentHash{key: key}
+}
+
+// ringReplicas is how many points each backend has on the ring; more points spread keys more evenly.
+const ringReplicas = 100
+
+type ringPoint struct {
+	hash    uint64
+	backend *Backend
+}
+
+type consistentHash struct {
+	key  func(*http.Request) string
+	once sync.Once
+	ring []ringPoint
+}
+
+func (ch *consistentHash) Pick(r *http.Request, backends []*Backend) *Backend {
+	// The backends of a Proxy never change, only their health, so the ring is built once.
+	ch.once.Do(func() {
+		for _, b := range backends {
+			for i := 0; i < ringReplicas; i++ {
+				ch.ring = append(ch.ring, ringPoint{hashString(b.URL.String() + "#" + strconv.Itoa(i)), b})
+			}
+		}
+		sort.Slice(ch.ring, func(i, j int) bool { return ch.ring[i].hash < ch.ring[j].hash })
+	})
+	if len(ch.ring) == 0 {
+		return nil
+	}
+
+	h := hashString(ch.key(r))
+	start := sort.Search(len(ch.ring), func(i int) bool { return ch.ring[i].hash >= h })
+	for i := 0; i < len(ch.ring); i++ {
+		if p := ch.ring[(start+i)%len(ch.ring)]; p.backend.Healthy() {
+			return p.backend
+		}
+	}
+	return nil
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// ClientIP returns the IP address the request came from, without its port. It doesn't look at
+// X-Forwarded-For, which any client can set.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,321 @@
+// Package proxy is a reverse proxy and load balancer built on the HTTP Server example's handler model. A Proxy
+// is an http.Handler that forwards each request to one of a pool of upstream servers, chosen by a Balancer:
+// round-robin, least connections or a consistent hash of the client.
+//
+// Active health checks request a path on every backend at an interval. A backend that fails a few checks in a
+// row is taken out of the pool and put back once it passes a few again, so a crashed or restarting server
+// stops receiving traffic without anyone having to reconfigure the proxy. Forwarded requests carry
+// X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers, and each upstream has a timeout after which
+// the client gets 504 Gateway Timeout instead of waiting forever.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoBackends is returned by New when no upstreams are given.
+var ErrNoBackends = errors.New("proxy: no upstreams")
+
+// Upstream configures one backend server.
+type Upstream struct {
+	// URL is the backend's base URL, such as "http://10.0.0.7:8090". A path is prefixed to every request's.
+	URL string
+	// Timeout limits each request to this backend, from sending the request to reading the last byte of the
+	// response. Zero uses the Proxy's default.
+	Timeout time.Duration
+}
+
+// Option configures a Proxy.
+type Option func(*config)
+
+type config struct {
+	balancer       Balancer
+	timeout        time.Duration
+	transport      http.RoundTripper
+	healthPath     string
+	healthInterval time.Duration
+	healthTimeout  time.Duration
+	fall, rise     int
+	logger         *log.Logger
+}
+
+// WithBalancer sets how backends are chosen. The default is RoundRobin.
+func WithBalancer(b Balancer) Option {
+	return func(c *config) {
+		c.balancer = b
+	}
+}
+
+// WithTimeout sets the timeout of upstreams that don't set their own. The default is 30 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithTransport sets the transport used for proxied requests and health checks. The default is
+// http.DefaultTransport.
+func WithTransport(t http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = t
+	}
+}
+
+// WithHealthCheck sets the path HealthCheck requests on each backend, how often, and how long a check may
+// take. A check passes if the backend answers with a 2xx status. The defaults are "/healthz", 5 seconds and
+// 2 seconds.
+func WithHealthCheck(path string, interval, timeout time.Duration) Option {
+	return func(c *config) {
+		c.healthPath = path
+		c.healthInterval = interval
+		c.healthTimeout = timeout
+	}
+}
+
+// WithThresholds sets how many checks in a row a backend must fail to be taken out of the pool, and how many
+// it must then pass to be put back. The defaults are 2 and 2.
+func WithThresholds(fall, rise int) Option {
+	return func(c *config) {
+		c.fall = fall
+		c.rise = rise
+	}
+}
+
+// WithLogger sets where backend state changes and proxy errors are logged. The default is log.Default().
+func WithLogger(l *log.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// Backend is one upstream server of a Proxy, with its health and load.
+type Backend struct {
+	URL     *url.URL
+	Timeout time.Duration
+
+	proxy *httputil.ReverseProxy
+	// down is 1 while the backend is out of the pool. active counts requests in flight and served those
+	// completed. passes and fails count consecutive health check results and are only touched by the checker.
+	down           int32
+	active, served int64
+	passes, fails  int
+}
+
+// Healthy reports whether the backend is in the pool.
+func (b *Backend) Healthy() bool {
+	return atomic.LoadInt32(&b.down) == 0
+}
+
+// Active returns the number of requests the backend is serving.
+func (b *Backend) Active() int64 {
+	return atomic.LoadInt64(&b.active)
+}
+
+// Served returns the number of requests the backend has finished serving.
+func (b *Backend) Served() int64 {
+	return atomic.LoadInt64(&b.served)
+}
+
+// Proxy is an http.Handler that balances requests across backends. It is safe for concurrent use.
+type Proxy struct {
+	cfg      config
+	backends []*Backend
+}
+
+// New returns a Proxy for upstreams. Every backend starts out healthy.
+func New(upstreams []Upstream, opts ...Option) (*Proxy, error) {
+	if len(upstreams) == 0 {
+		return nil, ErrNoBackends
+	}
+	cfg := config{
+		timeout:        30 * time.Second,
+		transport:      http.DefaultTransport,
+		healthPath:     "/healthz",
+		healthInterval: 5 * time.Second,
+		healthTimeout:  2 * time.Second,
+		fall:           2,
+		rise:           2,
+		logger:         log.Default(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.balancer == nil {
+		cfg.balancer = RoundRobin()
+	}
+
+	p := &Proxy{cfg: cfg}
+	for _, u := range upstreams {
+		target, err := url.Parse(u.URL)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: upstream %q: %w", u.URL, err)
+		}
+		if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+			return nil, fmt.Errorf("proxy: upstream %q is not an http or https URL", u.URL)
+		}
+		b := &Backend{URL: target, Timeout: u.Timeout}
+		if b.Timeout == 0 {
+			b.Timeout = cfg.timeout
+		}
+		b.proxy = p.reverseProxy(b)
+		p.backends = append(p.backends, b)
+	}
+	return p, nil
+}
+
+// Backends returns the proxy's backends in the order they were configured.
+func (p *Proxy) Backends() []*Backend {
+	return p.backends
+}
+
+// reverseProxy returns the httputil.ReverseProxy that forwards requests to b.
+func (p *Proxy) reverseProxy(b *Backend) *httputil.ReverseProxy {
+	target := b.URL
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			// ReverseProxy appends the client's address to X-Forwarded-For itself. The host and scheme the client
+			// asked for are replaced rather than trusted, since a client could have sent any values.
+			proto := "http"
+			if r.TLS != nil {
+				proto = "https"
+			}
+			r.Header.Set("X-Forwarded-Host", r.Host)
+			r.Header.Set("X-Forwarded-Proto", proto)
+
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.URL.Path = singleJoiningSlash(target.Path, r.URL.Path)
+			r.URL.RawPath = ""
+			r.Host = target.Host
+		},
+		Transport: p.cfg.transport,
+		ErrorLog:  p.cfg.logger,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			status := http.StatusBadGateway
+			switch r.Context().Err() {
+			case context.Canceled:
+				// A client that went away doesn't need an answer, or a log line.
+				return
+			case context.DeadlineExceeded:
+				status = http.StatusGatewayTimeout
+			}
+			p.cfg.logger.Printf("proxy: %s %s via %s: %v", r.Method, r.URL.Path, target.Host, err)
+			w.WriteHeader(status)
+		},
+	}
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case a == "" || a == "/":
+		return b
+	case a[len(a)-1] == '/' && b != "" && b[0] == '/':
+		return a + b[1:]
+	case a[len(a)-1] != '/' && (b == "" || b[0] != '/'):
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// ServeHTTP forwards r to the backend the balancer picks, or answers 503 Service Unavailable if every backend
+// is down.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := p.cfg.balancer.Pick(r, p.backends)
+	if b == nil {
+		http.Error(w, "no healthy upstream", http.StatusServiceUnavailable)
+		return
+	}
+	atomic.AddInt64(&b.active, 1)
+	defer func() {
+		atomic.AddInt64(&b.active, -1)
+		atomic.AddInt64(&b.served, 1)
+	}()
+
+	ctx, cancel := context.WithTimeout(r.Context(), b.Timeout)
+	defer cancel()
+	b.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// HealthCheck checks every backend at the configured interval until ctx is done, taking backends out of the
+// pool and putting them back as their checks fail and pass. The first round runs straight away.
+func (p *Proxy) HealthCheck(ctx context.Context) {
+	t := time.NewTicker(p.cfg.healthInterval)
+	defer t.Stop()
+	for {
+		p.checkAll(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkAll runs one round of health checks, checking all backends at once.
+func (p *Proxy) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+			err := p.probe(ctx, b)
+			if ctx.Err() != nil {
+				// A check cut short by shutdown says nothing about the backend.
+				return
+			}
+			p.record(b, err)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// probe requests the health check path from b.
+func (p *Proxy) probe(ctx context.Context, b *Backend) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.healthTimeout)
+	defer cancel()
+	u := *b.URL
+	u.Path = singleJoiningSlash(b.URL.Path, p.cfg.healthPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.cfg.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// record counts a health check result for b and moves it in or out of the pool once a threshold is reached.
+func (p *Proxy) record(b *Backend, err error) {
+	if err != nil {
+		b.passes = 0
+		b.fails++
+		if b.Healthy() && b.fails >= p.cfg.fall {
+			atomic.StoreInt32(&b.down, 1)
+			p.cfg.logger.Printf("proxy: %s is down after %d failed checks: %v", b.URL.Host, b.fails, err)
+		}
+		return
+	}
+	b.fails = 0
+	b.passes++
+	if !b.Healthy() && b.passes >= p.cfg.rise {
+		atomic.StoreInt32(&b.down, 0)
+		p.cfg.logger.Printf("proxy: %s is back up after %d passed checks", b.URL.Host, b.passes)
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var quiet = WithLogger(log.New(io.Discard, "", 0))
+
+// backend starts a server that answers with its name and the forwarding headers it received, and whose
+// health check fails while sick is set.
+type backend struct {
+	*httptest.Server
+	sick int32
+}
+
+func newBackend(t *testing.T, name string) *backend {
+	b := &backend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if atomic.LoadInt32(&b.sick) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/slow":
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		default:
+			fmt.Fprintf(w, "%s %s for=%s host=%s proto=%s", name, r.URL.Path, r.Header.Get("X-Forwarded-For"),
+				r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"))
+		}
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// get sends a request through p and returns the status and the name of the backend that answered.
+func get(p *Proxy, path string) (int, string) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	p.ServeHTTP(w, req)
+	name, _, _ := strings.Cut(w.Body.String(), " ")
+	return w.Code, name
+}
+
+func TestRoundRobinAndHealthChecks(t *testing.T) {
+	a, b, c := newBackend(t, "a"), newBackend(t, "b"), newBackend(t, "c")
+	p, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}, {URL: c.URL}}, quiet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(n int) []string {
+		var got []string
+		for i := 0; i < n; i++ {
+			_, name := get(p, "/")
+			got = append(got, name)
+		}
+		return got
+	}
+	if got, want := names(6), []string{"a", "b", "c", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// One failed check isn't enough to take b out; the second is.
+	atomic.StoreInt32(&b.sick, 1)
+	p.checkAll(context.Background())
+	if !p.Backends()[1].Healthy() {
+		t.Fatal("b taken out after a single failed check")
+	}
+	p.checkAll(context.Background())
+	if p.Backends()[1].Healthy() {
+		t.Fatal("b still in the pool after two failed checks")
+	}
+	for _, name := range names(6) {
+		if name == "b" {
+			t.Fatal("request sent to b while it was down")
+		}
+	}
+
+	atomic.StoreInt32(&b.sick, 0)
+	p.checkAll(context.Background())
+	p.checkAll(context.Background())
+	if !p.Backends()[1].Healthy() {
+		t.Fatal("b not back after two passed checks")
+	}
+
+	// A backend that stops answering at all fails its checks too, and with every backend down the proxy
+	// answers 503 itself.
+	a.Close()
+	atomic.StoreInt32(&b.sick, 1)
+	atomic.StoreInt32(&c.sick, 1)
+	p.checkAll(context.Background())
+	p.checkAll(context.Background())
+	if code, _ := get(p, "/"); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d with every backend down, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	a := newBackend(t, "a")
+	p, err := New([]Upstream{{URL: a.URL + "/api/"}}, quiet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Host = "example.com"
+	req.Header.Set("X-Forwarded-Host", "spoofed.example")
+	p.ServeHTTP(w, req)
+	// httptest.NewRequest comes from 192.0.2.1, which ReverseProxy appends to X-Forwarded-For.
+	if got, want := w.Body.String(), "a /api/users for=192.0.2.1 host=example.com proto=http"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	p, err := New([]Upstream{{URL: a.URL, Timeout: 50 * time.Millisecond}, {URL: b.URL}},
+		WithTimeout(time.Second), quiet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if code, _ := get(p, "/slow"); code != http.StatusGatewayTimeout {
+		t.Errorf("got status %d from a, want %d", code, http.StatusGatewayTimeout)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("a's 50ms timeout took %v", d)
+	}
+	if code, _ := get(p, "/slow"); code != http.StatusGatewayTimeout {
+		t.Errorf("got status %d from b, want %d", code, http.StatusGatewayTimeout)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("b timed out after %v, before the 1s default", d)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(nil); err != ErrNoBackends {
+		t.Errorf("got %v, want ErrNoBackends", err)
+	}
+	for _, u := range []string{"localhost:8090", "ftp://example.com", "http://"} {
+		if _, err := New([]Upstream{{URL: u}}); err == nil {
+			t.Errorf("%q: got no error", u)
+		}
+	}
+}
+
+// pool returns n backends that aren't connected to anything, for testing balancers directly.
+func pool(n int) []*Backend {
+	var backends []*Backend
+	for i := 0; i < n; i++ {
+		backends = append(backends, &Backend{URL: &url.URL{Scheme: "http", Host: fmt.Sprintf("10.0.0.%d:80", i)}})
+	}
+	return backends
+}
+
+func TestLeastConnections(t *testing.T) {
+	backends := pool(3)
+	backends[0].active, backends[1].active, backends[2].active = 2, 0, 1
+	lc := LeastConnections()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := lc.Pick(req, backends); got != backends[1] {
+		t.Errorf("got %s, want the idle backend", got.URL.Host)
+	}
+	backends[1].down = 1
+	if got := lc.Pick(req, backends); got != backends[2] {
+		t.Errorf("got %s, want the least busy healthy backend", got.URL.Host)
+	}
+
+	// Equally busy backends take turns.
+	backends[1].down, backends[0].active, backends[1].active, backends[2].active = 0, 0, 0, 0
+	seen := map[*Backend]bool{}
+	for i := 0; i < 3; i++ {
+		seen[lc.Pick(req, backends)] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("got %d backends for 3 requests to an idle pool, want 3", len(seen))
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	backends := pool(3)
+	ch := ConsistentHash(func(r *http.Request) string { return r.Header.Get("X-User") })
+	pick := func(user string) *Backend {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", user)
+		return ch.Pick(req, backends)
+	}
+
+	before := map[string]*Backend{}
+	counts := map[*Backend]int{}
+	for i := 0; i < 3000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		before[user] = pick(user)
+		counts[before[user]]++
+		if pick(user) != before[user] {
+			t.Fatalf("%s moved between two requests", user)
+		}
+	}
+	for _, b := range backends {
+		if counts[b] < 600 {
+			t.Errorf("%s got %d of 3000 keys", b.URL.Host, counts[b])
+		}
+	}
+
+	// Taking a backend down moves only its own keys, and bringing it back moves them home.
+	backends[1].down = 1
+	for user, b := range before {
+		got := pick(user)
+		if b != backends[1] && got != b || got == backends[1] {
+			t.Fatalf("%s moved from %s to %s", user, b.URL.Host, got.URL.Host)
+		}
+	}
+	backends[1].down = 0
+	for user, b := range before {
+		if pick(user) != b {
+			t.Fatalf("%s did not return to %s", user, b.URL.Host)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// Package pubsub is an in-process publish/subscribe broker built on the non-blocking channel operations
+// example. Every subscriber gets its own buffered channel, and a publisher hands a message to each one with
+// a select that has a default case, so one slow subscriber never holds up the publisher or the other
+// subscribers. What happens when a subscriber's buffer is full is decided by its overflow Policy.
+//
+// Topics are dot-separated words such as "orders.eu.created". A subscription pattern may use * to match
+// exactly one word and, as its last word, # to match any number of remaining words, including none.
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Subscribe once the broker has been closed.
+var ErrClosed = errors.New("pubsub: broker closed")
+
+// Policy decides what happens to a message published to a subscriber whose buffer is full.
+type Policy int
+
+const (
+	// DropNewest discards the message being published and keeps the queue as it is.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest queued message to make room for the new one.
+	DropOldest
+	// Block waits for room for up to the subscriber's block timeout, then discards the message.
+	Block
+	// Disconnect unsubscribes the subscriber and closes its channel.
+	Disconnect
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case Disconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// Message is a payload published on a topic.
+type Message[T any] struct {
+	Topic   string
+	Payload T
+}
+
+// Stats describes how well a subscriber is keeping up.
+type Stats struct {
+	ID      int
+	Pattern string
+	Policy  Policy
+	// Delivered counts messages placed in the subscriber's queue, and Dropped those discarded by its policy,
+	// including queued messages pushed out under DropOldest.
+	Delivered, Dropped uint64
+	// Queued is the number of messages waiting to be received, Capacity the size of the queue and
+	// HighWater the largest Queued seen after a delivery.
+	Queued, Capacity, HighWater int
+	// Disconnected reports whether the subscriber was cut off by the Disconnect policy.
+	Disconnected bool
+}
+
+// SubOption configures a subscription.
+type SubOption func(*options)
+
+type options struct {
+	buffer  int
+	policy  Policy
+	timeout time.Duration
+}
+
+// WithBuffer sets the length of the subscriber's queue. The default is 16.
+func WithBuffer(n int) SubOption {
+	return func(o *options) {
+		o.buffer = n
+	}
+}
+
+// WithPolicy sets the overflow policy. The default is DropNewest.
+func WithPolicy(p Policy) SubOption {
+	return func(o *options) {
+		o.policy = p
+	}
+}
+
+// WithBlockTimeout sets how long the Block policy waits for room. The default is 100ms.
+func WithBlockTimeout(d time.Duration) SubOption {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// Broker routes published messages to matching subscribers. It is safe for concurrent use.
+type Broker[T any] struct {
+	mu     sync.RWMutex
+	subs   map[int]*Subscription[T]
+	nextID int
+	closed bool
+}
+
+// NewBroker returns a broker with no subscribers.
+func NewBroker[T any]() *Broker[T] {
+	return &Broker[T]{subs: make(map[int]*Subscription[T])}
+}
+
+// Subscribe registers interest in topics matching pattern.
+func (b *Broker[T]) Subscribe(pattern string, opts ...SubOption) (*Subscription[T], error) {
+	words, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	o := options{buffer: 16, policy: DropNewest, timeout: 100 * time.Millisecond}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.nextID++
+	s := &Subscription[T]{
+		broker:  b,
+		id:      b.nextID,
+		pattern: pattern,
+		words:   words,
+		opts:    o,
+		ch:      make(chan Message[T], o.buffer),
+		done:    make(chan struct{}),
+	}
+	b.subs[s.id] = s
+	return s, nil
+}
+
+// Publish offers a message to every matching subscriber and reports how many accepted it. It only blocks
+// for subscribers using the Block policy whose queues are full.
+func (b *Broker[T]) Publish(topic string, payload T) int {
+	words := strings.Split(topic, ".")
+	b.mu.RLock()
+	var targets []*Subscription[T]
+	for _, s := range b.subs {
+		if match(s.words, words) {
+			targets = append(targets, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	msg := Message[T]{Topic: topic, Payload: payload}
+	delivered := 0
+	for _, s := range targets {
+		if s.deliver(msg) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// Stats returns the statistics of every current subscriber, ordered by ID.
+func (b *Broker[T]) Stats() []Stats {
+	b.mu.RLock()
+	subs := make([]*Subscription[T], 0, len(b.subs))
+	for _, s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	stats := make([]Stats, len(subs))
+	for i, s := range subs {
+		stats[i] = s.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// Close unsubscribes everyone, closing their channels, and refuses new subscriptions.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = make(map[int]*Subscription[T])
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.shut(false)
+	}
+}
+
+func (b *Broker[T]) remove(id int) {
+	b.mu.Lock()
+	delete(b.subs, id)
+	b.mu.Unlock()
+}
+
+// Subscription is one subscriber's queue of messages.
+type Subscription[T any] struct {
+	broker  *Broker[T]
+	id      int
+	pattern string
+	words   []string
+	opts    options
+
+	// sendMu serializes deliveries and the closing of ch, so nothing is ever sent on a closed channel. It is
+	// held while the Block policy waits for room, so everything else is guarded by mu instead, and done wakes
+	// the wait when the subscription ends.
+	sendMu             sync.Mutex
+	ch                 chan Message[T]
+	done               chan struct{}
+	mu                 sync.Mutex
+	closed             bool
+	disconnected       bool
+	delivered, dropped uint64
+	highWater          int
+}
+
+// C returns the channel messages arrive on. It is closed when the subscription ends.
+func (s *Subscription[T]) C() <-chan Message[T] {
+	return s.ch
+}
+
+// Unsubscribe ends the subscription and closes its channel. Messages still queued can be received.
+func (s *Subscription[T]) Unsubscribe() {
+	s.broker.remove(s.id)
+	s.shut(false)
+}
+
+// Stats returns the subscriber's delivery statistics.
+func (s *Subscription[T]) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		ID:           s.id,
+		Pattern:      s.pattern,
+		Policy:       s.opts.policy,
+		Delivered:    s.delivered,
+		Dropped:      s.dropped,
+		Queued:       len(s.ch),
+		Capacity:     cap(s.ch),
+		HighWater:    s.highWater,
+		Disconnected: s.disconnected,
+	}
+}
+
+func (s *Subscription[T]) shut(disconnected bool) {
+	if s.markClosed(disconnected) {
+		// A delivery waiting for room gives up as soon as done is closed, so this doesn't wait long.
+		s.sendMu.Lock()
+		close(s.ch)
+		s.sendMu.Unlock()
+	}
+}
+
+// markClosed records that the subscription has ended and wakes any delivery waiting for room. It reports
+// whether this call ended it, in which case the caller must close ch while holding sendMu.
+func (s *Subscription[T]) markClosed(disconnected bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	s.disconnected = disconnected
+	close(s.done)
+	return true
+}
+
+// deliver offers msg to the subscriber, applying its overflow policy if the queue is full.
+func (s *Subscription[T]) deliver(msg Message[T]) bool {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return false
+	}
+
+	// The fast path is the non-blocking send from the example.
+	select {
+	case s.ch <- msg:
+		s.accepted()
+		return true
+	default:
+	}
+
+	switch s.opts.policy {
+	case DropOldest:
+		// Receiving with a default case cannot block either; the consumer may have emptied the queue in
+		// the meantime, in which case there is nothing to drop.
+		select {
+		case <-s.ch:
+			s.drop()
+		default:
+		}
+		select {
+		case s.ch <- msg:
+			s.accepted()
+			return true
+		default:
+		}
+	case Block:
+		t := time.NewTimer(s.opts.timeout)
+		defer t.Stop()
+		select {
+		case s.ch <- msg:
+			s.accepted()
+			return true
+		case <-s.done:
+			return false
+		case <-t.C:
+		}
+	case Disconnect:
+		s.drop()
+		if s.markClosed(true) {
+			close(s.ch)
+		}
+		s.broker.remove(s.id)
+		return false
+	}
+	s.drop()
+	return false
+}
+
+func (s *Subscription[T]) accepted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered++
+	if n := len(s.ch); n > s.highWater {
+		s.highWater = n
+	}
+}
+
+func (s *Subscription[T]) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+// parsePattern splits a subscription pattern into words and checks that # only appears at the end.
+func parsePattern(pattern string) ([]string, error) {
+	words := strings.Split(pattern, ".")
+	for i, w := range words {
+		if w == "" {
+			return nil, fmt.Errorf("pubsub: empty word in pattern %q", pattern)
+		}
+		if w == "#" && i != len(words)-1 {
+			return nil, fmt.Errorf("pubsub: # must be the last word in pattern %q", pattern)
+		}
+	}
+	return words, nil
+}
+
+// match reports whether a topic, split into words, matches a parsed pattern.
+func match(pattern, topic []string) bool {
+	for i, p := range pattern {
+		if p == "#" {
+			return true
+		}
+		if i >= len(topic) || (p != "*" && p != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
@@ -0,0 +1,199 @@
+package pubsub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.deleted", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.#", "orders", true},
+		{"orders.#", "orders.eu.created", true},
+		{"#", "anything.at.all", true},
+		{"orders", "orders.created", false},
+	}
+
+	for _, tt := range tests {
+		words, err := parsePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(words, strings.Split(tt.topic, ".")); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "a..b", "a.#.b"} {
+		if _, err := parsePattern(bad); err == nil {
+			t.Errorf("parsePattern(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := NewBroker[string]()
+	all, _ := b.Subscribe("orders.#")
+	eu, _ := b.Subscribe("orders.eu.*")
+
+	if n := b.Publish("orders.eu.created", "a"); n != 2 {
+		t.Errorf("delivered to %d subscribers, want 2", n)
+	}
+	if n := b.Publish("orders.us.created", "b"); n != 1 {
+		t.Errorf("delivered to %d subscribers, want 1", n)
+	}
+
+	if m := <-eu.C(); m.Payload != "a" || m.Topic != "orders.eu.created" {
+		t.Errorf("got %+v", m)
+	}
+	if got := (<-all.C()).Payload + (<-all.C()).Payload; got != "ab" {
+		t.Errorf("got %q, want %q", got, "ab")
+	}
+
+	eu.Unsubscribe()
+	if _, ok := <-eu.C(); ok {
+		t.Error("channel still open after Unsubscribe")
+	}
+	if n := b.Publish("orders.eu.created", "c"); n != 1 {
+		t.Errorf("delivered to %d subscribers after Unsubscribe, want 1", n)
+	}
+}
+
+// fill publishes n messages numbered from 1 and returns what the subscriber then has queued.
+func fill(t *testing.T, policy Policy, n int) ([]int, Stats) {
+	t.Helper()
+	b := NewBroker[int]()
+	s, _ := b.Subscribe("t", WithBuffer(2), WithPolicy(policy), WithBlockTimeout(time.Millisecond))
+	for i := 1; i <= n; i++ {
+		b.Publish("t", i)
+	}
+	stats := s.Stats()
+	var got []int
+	for {
+		select {
+		case m, ok := <-s.C():
+			if !ok {
+				return got, stats
+			}
+			got = append(got, m.Payload)
+		default:
+			return got, stats
+		}
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	var tests = []struct {
+		policy       Policy
+		want         []int
+		dropped      uint64
+		disconnected bool
+	}{
+		{DropNewest, []int{1, 2}, 3, false},
+		{DropOldest, []int{4, 5}, 3, false},
+		{Block, []int{1, 2}, 3, false},
+		{Disconnect, []int{1, 2}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			got, stats := fill(t, tt.policy, 5)
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("got queue %v, want %v", got, tt.want)
+			}
+			if stats.Dropped != tt.dropped {
+				t.Errorf("got %d dropped, want %d", stats.Dropped, tt.dropped)
+			}
+			if stats.Disconnected != tt.disconnected {
+				t.Errorf("got disconnected %v, want %v", stats.Disconnected, tt.disconnected)
+			}
+			if stats.HighWater != 2 || stats.Capacity != 2 {
+				t.Errorf("got high water %d of %d, want 2 of 2", stats.HighWater, stats.Capacity)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	b := NewBroker[int]()
+	s, _ := b.Subscribe("t", WithBuffer(1), WithPolicy(Block), WithBlockTimeout(time.Second))
+	b.Publish("t", 1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-s.C()
+	}()
+	if n := b.Publish("t", 2); n != 1 {
+		t.Error("blocked publish was dropped although the subscriber made room in time")
+	}
+}
+
+func TestBlockDoesNotHoldUpOthers(t *testing.T) {
+	b := NewBroker[int]()
+	s, _ := b.Subscribe("t", WithBuffer(1), WithPolicy(Block), WithBlockTimeout(time.Minute))
+	b.Publish("t", 1)
+
+	published := make(chan int)
+	go func() { published <- b.Publish("t", 2) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// The publisher is waiting for room, but the subscriber's stats and unsubscribing don't wait with it.
+	done := make(chan struct{})
+	go func() {
+		if st := s.Stats(); st.Queued != 1 {
+			t.Errorf("got %d queued, want 1", st.Queued)
+		}
+		s.Unsubscribe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stats and Unsubscribe waited for the blocked publish")
+	}
+	select {
+	case n := <-published:
+		if n != 0 {
+			t.Errorf("got %d deliveries to an unsubscribed subscriber, want 0", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the blocked publish didn't give up when the subscriber left")
+	}
+	if m, ok := <-s.C(); !ok || m.Payload != 1 {
+		t.Errorf("got %v, %v, want the queued message 1", m, ok)
+	}
+}
+
+func TestBrokerStatsAndClose(t *testing.T) {
+	b := NewBroker[int]()
+	fast, _ := b.Subscribe("t")
+	b.Subscribe("t", WithBuffer(1))
+	for i := 0; i < 3; i++ {
+		b.Publish("t", i)
+		<-fast.C()
+	}
+
+	stats := b.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("got %d subscribers, want 2", len(stats))
+	}
+	if stats[0].Dropped != 0 || stats[1].Dropped != 2 {
+		t.Errorf("got dropped %d and %d, want 0 and 2", stats[0].Dropped, stats[1].Dropped)
+	}
+
+	b.Close()
+	if _, ok := <-fast.C(); ok {
+		t.Error("subscriber channel still open after Close")
+	}
+	if _, err := b.Subscribe("t"); err != ErrClosed {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+}
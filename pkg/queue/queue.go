@@ -0,0 +1,286 @@
+// Package queue provides a bounded FIFO queue with the backpressure choices a buffered channel leaves to
+// the caller. Like make(chan T, n) from the Channel Buffering example it holds at most n items, but a
+// producer can choose to block, give up immediately or give up after a timeout when it is full, items can be
+// put in priority lanes, and the queue reports its depth and high-water mark.
+//
+// Closing a Queue differs from closing a channel in the ways that usually go wrong: putting to a closed
+// queue returns ErrClosed instead of panicking, producers blocked in Put are released, and consumers keep
+// receiving the remaining items until the queue is empty, after which Get returns ErrClosed.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when putting to a closed queue, or getting from one that is closed and empty.
+	ErrClosed = errors.New("queue: closed")
+	// ErrTimeout is returned by PutWithTimeout and GetWithTimeout when no room or item appeared in time.
+	ErrTimeout = errors.New("queue: timed out")
+)
+
+// Stats is a snapshot of a queue's counters.
+type Stats struct {
+	// Depth is the number of items queued and Capacity the most it can hold.
+	Depth, Capacity int
+	// HighWater is the greatest Depth reached so far.
+	HighWater int
+	// Puts and Gets count items added and removed. Rejected counts puts refused because the queue was
+	// full, whether by TryPut or a timeout.
+	Puts, Gets, Rejected uint64
+	Closed               bool
+}
+
+// Option configures a Queue.
+type Option func(*config)
+
+type config struct {
+	priorities int
+}
+
+// WithPriorities sets the number of priority levels, numbered 0 to n-1. Get always returns an item from
+// the highest non-empty level first. The default is a single level.
+func WithPriorities(n int) Option {
+	return func(c *config) {
+		if n < 1 {
+			n = 1
+		}
+		c.priorities = n
+	}
+}
+
+// Queue is a bounded, optionally prioritized FIFO queue. It is safe for concurrent use.
+type Queue[T any] struct {
+	mu       sync.Mutex
+	lanes    [][]T
+	size     int
+	capacity int
+	closed   bool
+
+	highWater            int
+	puts, gets, rejected uint64
+
+	// changed is closed and replaced whenever items are added or removed or the queue is closed, waking
+	// every blocked producer and consumer to re-check their condition.
+	changed chan struct{}
+}
+
+// New returns an empty queue holding at most capacity items. It panics if capacity is less than 1.
+func New[T any](capacity int, opts ...Option) *Queue[T] {
+	if capacity < 1 {
+		panic(fmt.Sprintf("queue: capacity %d must be at least 1", capacity))
+	}
+	c := config{priorities: 1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &Queue[T]{
+		lanes:    make([][]T, c.priorities),
+		capacity: capacity,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Put adds v at priority 0, blocking while the queue is full. It returns ctx.Err() if ctx is done first and
+// ErrClosed if the queue is closed.
+func (q *Queue[T]) Put(ctx context.Context, v T) error {
+	return q.put(ctx, nil, v, 0)
+}
+
+// PutPriority is like Put but adds v at the given priority.
+func (q *Queue[T]) PutPriority(ctx context.Context, v T, priority int) error {
+	return q.put(ctx, nil, v, priority)
+}
+
+// PutWithTimeout is like Put but gives up with ErrTimeout after d.
+func (q *Queue[T]) PutWithTimeout(v T, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	return q.put(context.Background(), t.C, v, 0)
+}
+
+// TryPut adds v at priority 0 if there is room and reports whether it did. It never blocks.
+func (q *Queue[T]) TryPut(v T) bool {
+	return q.TryPutPriority(v, 0)
+}
+
+// TryPutPriority is like TryPut but adds v at the given priority.
+func (q *Queue[T]) TryPutPriority(v T, priority int) bool {
+	q.checkPriority(priority)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if q.size >= q.capacity {
+		q.rejected++
+		return false
+	}
+	q.enqueue(v, priority)
+	return true
+}
+
+func (q *Queue[T]) put(ctx context.Context, timeout <-chan time.Time, v T, priority int) error {
+	q.checkPriority(priority)
+	q.mu.Lock()
+	for {
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		if q.size < q.capacity {
+			q.enqueue(v, priority)
+			q.mu.Unlock()
+			return nil
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			q.mu.Lock()
+			q.rejected++
+			q.mu.Unlock()
+			return ErrTimeout
+		}
+		q.mu.Lock()
+	}
+}
+
+// enqueue adds v and wakes waiters. It is called with q.mu held and room available.
+func (q *Queue[T]) enqueue(v T, priority int) {
+	q.lanes[priority] = append(q.lanes[priority], v)
+	q.size++
+	q.puts++
+	if q.size > q.highWater {
+		q.highWater = q.size
+	}
+	q.notify()
+}
+
+func (q *Queue[T]) checkPriority(priority int) {
+	if priority < 0 || priority >= len(q.lanes) {
+		panic(fmt.Sprintf("queue: priority %d out of range 0-%d", priority, len(q.lanes)-1))
+	}
+}
+
+// Get removes and returns the oldest item of the highest priority, blocking while the queue is empty. Once
+// the queue is closed, Get keeps returning the remaining items and then ErrClosed.
+func (q *Queue[T]) Get(ctx context.Context) (T, error) {
+	return q.get(ctx, nil)
+}
+
+// GetWithTimeout is like Get but gives up with ErrTimeout after d.
+func (q *Queue[T]) GetWithTimeout(d time.Duration) (T, error) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	return q.get(context.Background(), t.C)
+}
+
+// TryGet removes and returns an item if one is available. It never blocks.
+func (q *Queue[T]) TryGet() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.dequeue(), true
+}
+
+func (q *Queue[T]) get(ctx context.Context, timeout <-chan time.Time) (T, error) {
+	var zero T
+	q.mu.Lock()
+	for {
+		if q.size > 0 {
+			v := q.dequeue()
+			q.mu.Unlock()
+			return v, nil
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return zero, ErrClosed
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-timeout:
+			return zero, ErrTimeout
+		}
+		q.mu.Lock()
+	}
+}
+
+// dequeue removes the next item and wakes waiters. It is called with q.mu held and at least one item queued.
+func (q *Queue[T]) dequeue() T {
+	for p := len(q.lanes) - 1; p >= 0; p-- {
+		lane := q.lanes[p]
+		if len(lane) == 0 {
+			continue
+		}
+		v := lane[0]
+		// Clear the slot so the queue does not keep the item reachable after handing it out.
+		var zero T
+		lane[0] = zero
+		q.lanes[p] = lane[1:]
+		q.size--
+		q.gets++
+		q.notify()
+		return v
+	}
+	panic("queue: dequeue from empty queue")
+}
+
+func (q *Queue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Close stops the queue from accepting items and releases blocked producers with ErrClosed. Items already
+// queued can still be taken. Calling Close more than once is safe.
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.notify()
+	}
+}
+
+// Len returns the number of items queued.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Cap returns the capacity of the queue.
+func (q *Queue[T]) Cap() int {
+	return q.capacity
+}
+
+// Stats returns a snapshot of the queue's counters.
+func (q *Queue[T]) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Stats{
+		Depth:     q.size,
+		Capacity:  q.capacity,
+		HighWater: q.highWater,
+		Puts:      q.puts,
+		Gets:      q.gets,
+		Rejected:  q.rejected,
+		Closed:    q.closed,
+	}
+}
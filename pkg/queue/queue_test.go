@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFIFO(t *testing.T) {
+	q := New[string](2)
+	ctx := context.Background()
+
+	q.Put(ctx, "buffered")
+	q.Put(ctx, "channel")
+	for _, want := range []string{"buffered", "channel"} {
+		got, err := q.Get(ctx)
+		if err != nil || got != want {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestTryPutAndTimeout(t *testing.T) {
+	q := New[int](1)
+	if !q.TryPut(1) {
+		t.Fatal("TryPut into an empty queue failed")
+	}
+	if q.TryPut(2) {
+		t.Error("TryPut into a full queue succeeded")
+	}
+	if err := q.PutWithTimeout(3, 10*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want %v", err, ErrTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Put(ctx, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+
+	if s := q.Stats(); s.Rejected != 2 || s.Puts != 1 {
+		t.Errorf("got %d rejected, %d puts, want 2 and 1", s.Rejected, s.Puts)
+	}
+	if _, ok := q.TryGet(); !ok {
+		t.Error("TryGet from a non-empty queue failed")
+	}
+	if _, err := q.GetWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestPutBlocksUntilRoom(t *testing.T) {
+	q := New[int](1)
+	ctx := context.Background()
+	q.Put(ctx, 1)
+
+	done := make(chan error)
+	go func() { done <- q.Put(ctx, 2) }()
+	select {
+	case <-done:
+		t.Fatal("Put returned while the queue was full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	q.Get(ctx)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v, _ := q.Get(ctx); v != 2 {
+		t.Errorf("got %d, want 2", v)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	q := New[string](10, WithPriorities(3))
+	ctx := context.Background()
+	q.PutPriority(ctx, "low-1", 0)
+	q.PutPriority(ctx, "high", 2)
+	q.PutPriority(ctx, "low-2", 0)
+	q.PutPriority(ctx, "mid", 1)
+
+	for _, want := range []string{"high", "mid", "low-1", "low-2"} {
+		if got, _ := q.Get(ctx); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	q := New[int](2)
+	ctx := context.Background()
+	q.Put(ctx, 1)
+	q.Put(ctx, 2)
+
+	// A producer blocked on a full queue is released by Close.
+	blocked := make(chan error)
+	go func() { blocked <- q.Put(ctx, 3) }()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	q.Close()
+	if err := <-blocked; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Put returned %v, want %v", err, ErrClosed)
+	}
+	if q.TryPut(4) {
+		t.Error("TryPut succeeded on a closed queue")
+	}
+
+	for _, want := range []int{1, 2} {
+		if got, err := q.Get(ctx); err != nil || got != want {
+			t.Errorf("got %d, %v, want %d", got, err, want)
+		}
+	}
+	if _, err := q.Get(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestConcurrentHighWater(t *testing.T) {
+	q := New[int](5)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				q.Put(ctx, i)
+			}
+		}()
+	}
+	got := 0
+	consumed := make(chan struct{})
+	go func() {
+		for {
+			if _, err := q.Get(ctx); err != nil {
+				close(consumed)
+				return
+			}
+			got++
+		}
+	}()
+	wg.Wait()
+	q.Close()
+	<-consumed
+
+	s := q.Stats()
+	if got != 400 || s.Gets != 400 || s.Depth != 0 {
+		t.Errorf("got %d items, stats %+v", got, s)
+	}
+	if s.HighWater < 1 || s.HighWater > 5 {
+		t.Errorf("got high water %d, want between 1 and 5", s.HighWater)
+	}
+}
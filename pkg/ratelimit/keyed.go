@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// Keyed keeps a separate Limiter for every key, such as a client address or API token. Limiters are created
+// on first use and dropped after they have been idle for the configured time, so the number of keys does
+// not grow without bound.
+type Keyed struct {
+	mu         sync.Mutex
+	newLimiter func() Limiter
+	clock      clock.Clock
+	idle       time.Duration
+	entries    map[string]*keyedEntry
+	lastSweep  time.Time
+	stopped    bool
+}
+
+type keyedEntry struct {
+	lim  Limiter
+	used time.Time
+	// waiting counts calls to Keyed.Wait blocked on lim. The sweep leaves the entry alone until it is 0.
+	waiting int
+}
+
+// NewKeyed returns a Keyed that calls newLimiter for each new key. Limiters unused for idle are forgotten;
+// idle should be long enough for a limiter to recover its full capacity, or clients can reset their limit
+// by going quiet. An idle of 0 keeps limiters forever.
+func NewKeyed(newLimiter func() Limiter, idle time.Duration, opts ...Option) *Keyed {
+	o := buildOptions(opts)
+	return &Keyed{
+		newLimiter: newLimiter,
+		clock:      o.clock,
+		idle:       idle,
+		entries:    make(map[string]*keyedEntry),
+	}
+}
+
+// Get returns the limiter for key, creating it if needed. The limiter may be stopped once it has been idle
+// for the configured time, so callers that wait on it should use Keyed.Wait instead.
+func (k *Keyed) Get(key string) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.entry(key).lim
+}
+
+// entry returns the entry for key, creating it if needed, and marks it used. It is called with k.mu held.
+func (k *Keyed) entry(key string) *keyedEntry {
+	now := k.clock.Now()
+	k.sweep(now)
+
+	e, ok := k.entries[key]
+	if !ok {
+		e = &keyedEntry{lim: k.newLimiter()}
+		if k.stopped {
+			e.lim.Stop()
+			return e
+		}
+		k.entries[key] = e
+	}
+	e.used = now
+	return e
+}
+
+// Allow calls Allow on the limiter for key.
+func (k *Keyed) Allow(key string) bool {
+	return k.Get(key).Allow()
+}
+
+// Reserve calls Reserve on the limiter for key.
+func (k *Keyed) Reserve(key string) *Reservation {
+	return k.Get(key).Reserve()
+}
+
+// Wait calls Wait on the limiter for key. The limiter is not dropped as idle while the call is waiting on it,
+// and counts as used when the call returns.
+func (k *Keyed) Wait(ctx context.Context, key string) error {
+	k.mu.Lock()
+	e := k.entry(key)
+	e.waiting++
+	k.mu.Unlock()
+
+	defer func() {
+		k.mu.Lock()
+		e.waiting--
+		e.used = k.clock.Now()
+		k.mu.Unlock()
+	}()
+	return e.lim.Wait(ctx)
+}
+
+// Len returns the number of keys currently tracked.
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+// Stop stops every limiter. Limiters handed out afterwards are already stopped.
+func (k *Keyed) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.stopped = true
+	for key, e := range k.entries {
+		e.lim.Stop()
+		delete(k.entries, key)
+	}
+}
+
+// sweep drops idle limiters that nobody is waiting on, at most once per idle period so the cost is spread
+// over many calls.
+func (k *Keyed) sweep(now time.Time) {
+	if k.idle <= 0 || now.Sub(k.lastSweep) < k.idle {
+		return
+	}
+	k.lastSweep = now
+	for key, e := range k.entries {
+		if e.waiting == 0 && now.Sub(e.used) >= k.idle {
+			e.lim.Stop()
+			delete(k.entries, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import "time"
+
+// LeakyBucket is a Limiter that lets events through at an even pace of one per Limit.Per/Limit.Rate, with no
+// bursts. Allow only admits an event if it can go through immediately; Reserve and Wait queue up to
+// Limit.Burst events behind it and refuse the rest.
+type LeakyBucket struct {
+	limiter
+}
+
+// NewLeakyBucket returns an empty LeakyBucket.
+func NewLeakyBucket(l Limit, opts ...Option) *LeakyBucket {
+	l.validate()
+	lb := &LeakyBucket{}
+	lb.limiter = newLimiter(&leakyBucket{lim: l}, opts)
+	return lb
+}
+
+type leakyBucket struct {
+	lim Limit
+	// next is the earliest time the next event may leave the bucket.
+	next time.Time
+}
+
+func (b *leakyBucket) reserve(now time.Time, nowOnly bool) (time.Time, bool) {
+	at := b.next
+	if at.Before(now) {
+		at = now
+	}
+	if at.After(now) {
+		if nowOnly {
+			return time.Time{}, false
+		}
+		interval := b.lim.interval()
+		queued := (at.Sub(now) + interval - 1) / interval
+		if int(queued) > b.lim.Burst {
+			return time.Time{}, false
+		}
+	}
+	b.next = at.Add(b.lim.interval())
+	return at, true
+}
+
+// cancel can only give back the most recent reservation; earlier ones have later events queued behind them.
+func (b *leakyBucket) cancel(at, now time.Time) {
+	if at.Add(b.lim.interval()).Equal(b.next) {
+		b.next = at
+	}
+}
+
+func (b *leakyBucket) setLimit(l Limit, now time.Time) {
+	b.lim = l
+}
+
+func (b *leakyBucket) limit() Limit {
+	return b.lim
+}
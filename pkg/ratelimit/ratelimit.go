@@ -0,0 +1,250 @@
+// Package ratelimit grows the Rate Limiting example into a library. Instead of a time.Tick channel and a
+// buffered burst channel, each limiter computes its state lazily from a Clock, so it needs no background
+// Goroutine, its limit can be changed while it is in use, and Stop releases anyone still waiting.
+//
+// Three algorithms share the Limiter interface: TokenBucket allows bursts up to a fixed size, LeakyBucket
+// spaces events out evenly and queues a bounded number of them, and SlidingWindow admits at most a fixed
+// number of events in any window of time. Keyed keeps one limiter per client.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+var (
+	// ErrStopped is returned by Wait once the limiter has been stopped.
+	ErrStopped = errors.New("ratelimit: limiter stopped")
+	// ErrLimitExceeded is returned by Wait when the limiter cannot admit the event at all, for example
+	// because a LeakyBucket's queue is full.
+	ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+	// ErrDeadline is returned by Wait when the event would be admitted only after the context's deadline.
+	ErrDeadline = errors.New("ratelimit: wait would exceed context deadline")
+)
+
+// Limit describes how many events are admitted. Rate events are allowed per Per. Burst is the bucket size for
+// TokenBucket and the queue length for LeakyBucket; SlidingWindow ignores it.
+type Limit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// Every returns a Limit that admits one event per interval with the given burst, the same shape as the
+// example's time.Tick and burstyLimiter pair.
+func Every(interval time.Duration, burst int) Limit {
+	return Limit{Rate: 1, Per: interval, Burst: burst}
+}
+
+// interval is the time between two events at the steady rate.
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Rate)
+}
+
+func (l Limit) validate() {
+	if l.Rate <= 0 || l.Per <= 0 {
+		panic(fmt.Sprintf("ratelimit: invalid limit %d per %v", l.Rate, l.Per))
+	}
+}
+
+// Limiter is implemented by every algorithm in this package.
+type Limiter interface {
+	// Allow reports whether an event may happen now, and consumes capacity for it if so.
+	Allow() bool
+	// Reserve claims capacity for an event and tells the caller how long to wait before acting on it.
+	Reserve() *Reservation
+	// Wait blocks until an event may happen, ctx is done or the limiter is stopped.
+	Wait(ctx context.Context) error
+	// SetLimit changes the limit. Capacity already handed out is kept.
+	SetLimit(l Limit)
+	// Limit returns the current limit.
+	Limit() Limit
+	// Stop makes the limiter refuse every further event and wakes all blocked Wait calls.
+	Stop()
+}
+
+// Option configures a limiter.
+type Option func(*options)
+
+type options struct {
+	clock clock.Clock
+}
+
+// WithClock sets the clock a limiter reads time from. The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+func buildOptions(opts []Option) options {
+	o := options{clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// algorithm is the state machine behind a limiter. Its methods are always called with the limiter's mutex
+// held.
+type algorithm interface {
+	// reserve returns the time at which one more event may happen, or false if it cannot be admitted.
+	// If the event may only happen now, reservations that would need to wait are refused.
+	reserve(now time.Time, nowOnly bool) (time.Time, bool)
+	// cancel gives back capacity claimed by a reservation for time at that has not yet come due.
+	cancel(at, now time.Time)
+	setLimit(l Limit, now time.Time)
+	limit() Limit
+}
+
+// limiter implements Limiter on top of an algorithm.
+type limiter struct {
+	mu      sync.Mutex
+	clock   clock.Clock
+	alg     algorithm
+	stopped chan struct{}
+	isDone  bool
+}
+
+func newLimiter(alg algorithm, opts []Option) limiter {
+	o := buildOptions(opts)
+	return limiter{clock: o.clock, alg: alg, stopped: make(chan struct{})}
+}
+
+func (l *limiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isDone {
+		return false
+	}
+	_, ok := l.alg.reserve(l.clock.Now(), true)
+	return ok
+}
+
+func (l *limiter) Reserve() *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	r := &Reservation{lim: l}
+	if l.isDone {
+		return r
+	}
+	r.at, r.ok = l.alg.reserve(now, false)
+	return r
+}
+
+func (l *limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := l.Reserve()
+	if !r.ok {
+		if l.isStopped() {
+			return ErrStopped
+		}
+		return ErrLimitExceeded
+	}
+	delay := r.Delay()
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.at) {
+		r.Cancel()
+		return ErrDeadline
+	}
+
+	t := l.clock.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	case <-l.stopped:
+		return ErrStopped
+	}
+}
+
+func (l *limiter) SetLimit(lim Limit) {
+	lim.validate()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.alg.setLimit(lim, l.clock.Now())
+}
+
+func (l *limiter) Limit() Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.alg.limit()
+}
+
+func (l *limiter) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.isDone {
+		l.isDone = true
+		close(l.stopped)
+	}
+}
+
+func (l *limiter) isStopped() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.isDone
+}
+
+// Reservation is capacity claimed for a single event. The holder should wait Delay before acting, or call
+// Cancel if it decides not to act at all.
+type Reservation struct {
+	lim      *limiter
+	ok       bool
+	at       time.Time
+	canceled bool
+}
+
+// OK reports whether the limiter could admit the event. A Reservation that is not OK has no delay and
+// nothing to cancel.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Time returns the time at which the event may happen.
+func (r *Reservation) Time() time.Time {
+	return r.at
+}
+
+// Delay returns how long to wait before the event may happen, measured from the limiter's clock.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	d := r.at.Sub(r.lim.clock.Now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Cancel returns the claimed capacity to the limiter, as far as the algorithm allows, provided the event has
+// not come due yet.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	r.lim.mu.Lock()
+	defer r.lim.mu.Unlock()
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+	now := r.lim.clock.Now()
+	if r.at.After(now) {
+		r.lim.alg.cancel(r.at, now)
+	}
+}
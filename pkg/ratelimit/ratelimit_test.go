@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+var epoch = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// allowed counts how many of n back-to-back Allow calls succeed.
+func allowed(l Limiter, n int) int {
+	got := 0
+	for i := 0; i < n; i++ {
+		if l.Allow() {
+			got++
+		}
+	}
+	return got
+}
+
+func TestAllow(t *testing.T) {
+	var tests = []struct {
+		name string
+		new  func(c clock.Clock) Limiter
+		// first is how many events an idle limiter admits at once, and later is how many it admits
+		// after one further Per has passed.
+		first, later int
+	}{
+		{"token bucket", func(c clock.Clock) Limiter {
+			return NewTokenBucket(Limit{Rate: 2, Per: time.Second, Burst: 3}, WithClock(c))
+		}, 3, 2},
+		{"leaky bucket", func(c clock.Clock) Limiter {
+			return NewLeakyBucket(Limit{Rate: 2, Per: time.Second, Burst: 3}, WithClock(c))
+		}, 1, 1},
+		{"sliding window", func(c clock.Clock) Limiter {
+			return NewSlidingWindow(Limit{Rate: 2, Per: time.Second}, WithClock(c))
+		}, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewFake(epoch)
+			l := tt.new(c)
+			if got := allowed(l, 10); got != tt.first {
+				t.Errorf("first burst: got %d, want %d", got, tt.first)
+			}
+			c.Advance(time.Second)
+			if got := allowed(l, 10); got != tt.later {
+				t.Errorf("after one period: got %d, want %d", got, tt.later)
+			}
+		})
+	}
+}
+
+func TestReserveDelays(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewTokenBucket(Every(200*time.Millisecond, 1), WithClock(c))
+
+	var got []time.Duration
+	for i := 0; i < 3; i++ {
+		got = append(got, l.Reserve().Delay())
+	}
+	want := []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reservation %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReserveCancel(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewSlidingWindow(Limit{Rate: 1, Per: time.Second}, WithClock(c))
+
+	l.Allow()
+	r := l.Reserve()
+	if r.Delay() != time.Second {
+		t.Fatalf("got delay %v, want 1s", r.Delay())
+	}
+	r.Cancel()
+	c.Advance(time.Second)
+	if !l.Allow() {
+		t.Error("cancelled reservation still holds capacity")
+	}
+}
+
+func TestLeakyBucketQueueFull(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewLeakyBucket(Limit{Rate: 1, Per: time.Second, Burst: 2}, WithClock(c))
+
+	// One event goes straight through and two more may queue behind it.
+	for i := 0; i < 3; i++ {
+		if r := l.Reserve(); !r.OK() {
+			t.Fatalf("reservation %d refused", i)
+		}
+	}
+	if l.Reserve().OK() {
+		t.Error("reservation beyond the queue length was admitted")
+	}
+	if err := l.Wait(context.Background()); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("got %v, want %v", err, ErrLimitExceeded)
+	}
+}
+
+func TestWait(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewTokenBucket(Every(time.Second, 1), WithClock(c))
+	l.Allow()
+
+	errc := make(chan error)
+	go func() { errc <- l.Wait(context.Background()) }()
+
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	if err := <-errc; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestWaitCancelAndStop(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewTokenBucket(Every(time.Second, 1), WithClock(c))
+	l.Allow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- l.Wait(ctx) }()
+	c.BlockUntil(1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+
+	// The cancelled wait gave its token back, so a full period later exactly one event is admitted.
+	c.Advance(time.Second)
+	go func() { errc <- l.Wait(context.Background()) }()
+	if err := <-errc; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	go func() { errc <- l.Wait(context.Background()) }()
+	c.BlockUntil(1)
+	l.Stop()
+	if err := <-errc; !errors.Is(err, ErrStopped) {
+		t.Errorf("got %v, want %v", err, ErrStopped)
+	}
+	if l.Allow() {
+		t.Error("stopped limiter allowed an event")
+	}
+}
+
+func TestWaitDeadline(t *testing.T) {
+	l := NewTokenBucket(Every(time.Hour, 1))
+	l.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, ErrDeadline) {
+		t.Errorf("got %v, want %v", err, ErrDeadline)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	c := clock.NewFake(epoch)
+	l := NewTokenBucket(Every(time.Second, 1), WithClock(c))
+	l.Allow()
+
+	l.SetLimit(Limit{Rate: 10, Per: time.Second, Burst: 5})
+	c.Advance(time.Second)
+	if got := allowed(l, 10); got != 5 {
+		t.Errorf("got %d, want 5", got)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	c := clock.NewFake(epoch)
+	k := NewKeyed(func() Limiter {
+		return NewTokenBucket(Every(time.Second, 1), WithClock(c))
+	}, time.Minute, WithClock(c))
+
+	if !k.Allow("a") || !k.Allow("b") {
+		t.Fatal("first event for each key should be allowed")
+	}
+	if k.Allow("a") {
+		t.Error("second event for key a should be limited")
+	}
+	if k.Len() != 2 {
+		t.Errorf("got %d keys, want 2", k.Len())
+	}
+
+	c.Advance(2 * time.Minute)
+	k.Allow("c")
+	if k.Len() != 1 {
+		t.Errorf("got %d keys after idle sweep, want 1", k.Len())
+	}
+
+	k.Stop()
+	if k.Allow("d") {
+		t.Error("stopped Keyed allowed an event")
+	}
+}
+
+func TestKeyedSweepSkipsWaiters(t *testing.T) {
+	c := clock.NewFake(epoch)
+	k := NewKeyed(func() Limiter {
+		return NewTokenBucket(Every(time.Minute, 1), WithClock(c))
+	}, time.Second, WithClock(c))
+
+	k.Allow("a")
+	errc := make(chan error, 1)
+	go func() { errc <- k.Wait(context.Background(), "a") }()
+	c.BlockUntil(1)
+
+	// The waiter's key has been idle long enough, but the sweep another key triggers must leave it alone.
+	c.Advance(2 * time.Second)
+	k.Allow("b")
+	if k.Len() != 2 {
+		t.Errorf("got %d keys after idle sweep, want 2", k.Len())
+	}
+	c.Advance(time.Minute)
+	if err := <-errc; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
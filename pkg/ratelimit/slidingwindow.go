@@ -0,0 +1,68 @@
+package ratelimit
+
+import "time"
+
+// SlidingWindow is a Limiter that admits at most Limit.Rate events in any span of Limit.Per. It keeps a log
+// of the most recent admission times, so unlike a fixed window it never lets twice the rate through across a
+// window boundary. Limit.Burst is ignored.
+type SlidingWindow struct {
+	limiter
+}
+
+// NewSlidingWindow returns a SlidingWindow with an empty log.
+func NewSlidingWindow(l Limit, opts ...Option) *SlidingWindow {
+	l.validate()
+	sw := &SlidingWindow{}
+	sw.limiter = newLimiter(&slidingWindow{lim: l}, opts)
+	return sw
+}
+
+type slidingWindow struct {
+	lim Limit
+	// log holds the last Rate admission times in ascending order. Reserved events may lie in the future.
+	log []time.Time
+}
+
+func (w *slidingWindow) reserve(now time.Time, nowOnly bool) (time.Time, bool) {
+	at := now
+	n := len(w.log)
+	if n >= w.lim.Rate {
+		if t := w.log[n-w.lim.Rate].Add(w.lim.Per); t.After(at) {
+			at = t
+		}
+	}
+	if n > 0 && w.log[n-1].After(at) {
+		at = w.log[n-1]
+	}
+	if nowOnly && at.After(now) {
+		return time.Time{}, false
+	}
+	w.log = append(w.log, at)
+	w.trim()
+	return at, true
+}
+
+func (w *slidingWindow) cancel(at, now time.Time) {
+	for i := len(w.log) - 1; i >= 0; i-- {
+		if w.log[i].Equal(at) {
+			w.log = append(w.log[:i], w.log[i+1:]...)
+			return
+		}
+	}
+}
+
+func (w *slidingWindow) setLimit(l Limit, now time.Time) {
+	w.lim = l
+	w.trim()
+}
+
+func (w *slidingWindow) limit() Limit {
+	return w.lim
+}
+
+// trim drops log entries that can no longer affect a decision.
+func (w *slidingWindow) trim() {
+	if extra := len(w.log) - w.lim.Rate; extra > 0 {
+		w.log = append(w.log[:0], w.log[extra:]...)
+	}
+}
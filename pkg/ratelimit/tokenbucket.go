@@ -0,0 +1,77 @@
+package ratelimit
+
+import "time"
+
+// TokenBucket is a Limiter that refills Limit.Rate tokens every Limit.Per into a bucket holding at most
+// Limit.Burst tokens. Each event takes one token, so after a quiet period up to Burst events are admitted at
+// once. This is the burstyLimiter from the example without the filler Goroutine.
+type TokenBucket struct {
+	limiter
+}
+
+// NewTokenBucket returns a TokenBucket that starts with a full bucket.
+func NewTokenBucket(l Limit, opts ...Option) *TokenBucket {
+	l.validate()
+	tb := &TokenBucket{}
+	tb.limiter = newLimiter(&tokenBucket{lim: l}, opts)
+	return tb
+}
+
+type tokenBucket struct {
+	lim    Limit
+	tokens float64
+	last   time.Time
+}
+
+// advance adds the tokens earned since the last call.
+func (b *tokenBucket) advance(now time.Time) {
+	if b.last.IsZero() {
+		b.last = now
+		b.tokens = float64(b.lim.Burst)
+		return
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * float64(b.lim.Rate) / float64(b.lim.Per)
+		b.last = now
+	}
+	if max := float64(b.lim.Burst); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+func (b *tokenBucket) reserve(now time.Time, nowOnly bool) (time.Time, bool) {
+	b.advance(now)
+	if b.lim.Burst < 1 {
+		return time.Time{}, false
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return now, true
+	}
+	if nowOnly {
+		return time.Time{}, false
+	}
+	wait := time.Duration((1 - b.tokens) * float64(b.lim.Per) / float64(b.lim.Rate))
+	b.tokens--
+	return now.Add(wait), true
+}
+
+func (b *tokenBucket) cancel(at, now time.Time) {
+	b.advance(now)
+	b.tokens++
+	if max := float64(b.lim.Burst); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+func (b *tokenBucket) setLimit(l Limit, now time.Time) {
+	b.advance(now)
+	b.lim = l
+	if max := float64(l.Burst); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+func (b *tokenBucket) limit() Limit {
+	return b.lim
+}
@@ -0,0 +1,324 @@
+// Package router is an http.Handler that dispatches requests by method and path, filling the gaps in
+// http.DefaultServeMux that the HTTP Server example runs into. Patterns are made of path segments, each of
+// which is literal text, a named parameter such as {id} that matches one segment, or, as the final segment
+// only, a wildcard such as {path...} that matches the rest of the path:
+//
+//	r := router.New()
+//	r.Use(router.RequestID(), router.Logger(log.Default()))
+//	r.Get("/users/{id}", showUser)
+//	api := r.Group("/api")
+//	api.Use(requireToken)
+//	api.Post("/files/{path...}", upload)
+//
+// When several patterns match, literal segments win over parameters and parameters over wildcards, among
+// the patterns registered for the request's method. A path that matches patterns registered only for other
+// methods gets a 405 Method Not Allowed response with an Allow header listing the methods that would have
+// matched.
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps a handler with extra behaviour, such as logging or authentication.
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middleware to h so that the first middleware listed is the outermost.
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+type paramsKey struct{}
+
+// Param returns the value of the named path parameter, or "" if the route has no such parameter.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+// Params returns every path parameter of the matched route, keyed by name.
+func Params(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params
+}
+
+// node is one segment of the routing tree.
+type node struct {
+	static   map[string]*node
+	param    *node
+	wildcard *node
+	// name is the parameter or wildcard name for param and wildcard nodes.
+	name     string
+	handlers map[string]http.Handler
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+// Router matches requests against registered routes. Routes and middleware must be registered before the
+// router starts serving.
+type Router struct {
+	root       *node
+	middleware []Middleware
+	handler    http.Handler
+
+	// NotFound handles requests that match no route. It defaults to http.NotFound.
+	NotFound http.Handler
+}
+
+// New returns an empty Router.
+func New() *Router {
+	r := &Router{root: newNode()}
+	r.handler = http.HandlerFunc(r.dispatch)
+	return r
+}
+
+// Use adds middleware that runs for every request, including those that end in a 404 or 405.
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+	r.handler = Chain(http.HandlerFunc(r.dispatch), r.middleware...)
+}
+
+// Handle registers h for method and pattern. It panics if the pattern is malformed or already registered
+// for that method.
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	n := r.root
+	segments := split(pattern)
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}"):
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("router: wildcard %s must be the last segment of %q", seg, pattern))
+			}
+			n = child(&n.wildcard, seg[1:len(seg)-4], pattern)
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			n = child(&n.param, seg[1:len(seg)-1], pattern)
+		case strings.ContainsAny(seg, "{}"):
+			panic(fmt.Sprintf("router: malformed segment %q in %q", seg, pattern))
+		default:
+			next, ok := n.static[seg]
+			if !ok {
+				next = newNode()
+				n.static[seg] = next
+			}
+			n = next
+		}
+	}
+
+	if n.handlers == nil {
+		n.handlers = make(map[string]http.Handler)
+	}
+	if _, dup := n.handlers[method]; dup {
+		panic(fmt.Sprintf("router: %s %s registered twice", method, pattern))
+	}
+	n.handlers[method] = h
+}
+
+// child returns the parameter or wildcard node stored in *slot, creating it if needed. Two patterns may not
+// give the same position different parameter names, since a request could not tell which name to use.
+func child(slot **node, name, pattern string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("router: unnamed parameter in %q", pattern))
+	}
+	if *slot == nil {
+		*slot = newNode()
+		(*slot).name = name
+	}
+	if (*slot).name != name {
+		panic(fmt.Sprintf("router: parameter {%s} in %q conflicts with {%s}", name, pattern, (*slot).name))
+	}
+	return *slot
+}
+
+// HandleFunc registers a handler function for method and pattern.
+func (r *Router) HandleFunc(method, pattern string, h http.HandlerFunc) {
+	r.Handle(method, pattern, h)
+}
+
+// Get registers h for GET requests. HEAD requests are served by the GET handler too unless a HEAD handler
+// is registered.
+func (r *Router) Get(pattern string, h http.HandlerFunc) { r.Handle(http.MethodGet, pattern, h) }
+
+// Post registers h for POST requests.
+func (r *Router) Post(pattern string, h http.HandlerFunc) { r.Handle(http.MethodPost, pattern, h) }
+
+// Put registers h for PUT requests.
+func (r *Router) Put(pattern string, h http.HandlerFunc) { r.Handle(http.MethodPut, pattern, h) }
+
+// Patch registers h for PATCH requests.
+func (r *Router) Patch(pattern string, h http.HandlerFunc) { r.Handle(http.MethodPatch, pattern, h) }
+
+// Delete registers h for DELETE requests.
+func (r *Router) Delete(pattern string, h http.HandlerFunc) { r.Handle(http.MethodDelete, pattern, h) }
+
+// ServeHTTP dispatches the request through the router's middleware to the matching route.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	params := make(map[string]string)
+	allow := make(map[string]bool)
+	h := r.root.match(split(req.URL.Path), req.Method, params, allow)
+	if h == nil && len(allow) == 0 {
+		r.notFound(w, req)
+		return
+	}
+	if h == nil {
+		methods := make([]string, 0, len(allow))
+		for m := range allow {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if len(params) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), paramsKey{}, params))
+	}
+	h.ServeHTTP(w, req)
+}
+
+func (r *Router) notFound(w http.ResponseWriter, req *http.Request) {
+	if r.NotFound != nil {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// match finds the handler for method and the remaining segments, trying literal, then parameter, then
+// wildcard children and backtracking when a branch dead-ends or has no handler for the method. The methods
+// of every node the path reaches are added to allow, so a 405 response can list them all.
+func (n *node) match(segments []string, method string, params map[string]string, allow map[string]bool) http.Handler {
+	if len(segments) == 0 {
+		if h := n.serve(method, allow); h != nil {
+			return h
+		}
+		// A wildcard may match an empty remainder, so /files/{path...} also matches /files/.
+		if n.wildcard != nil {
+			if h := n.wildcard.serve(method, allow); h != nil {
+				params[n.wildcard.name] = ""
+				return h
+			}
+		}
+		return nil
+	}
+
+	seg, rest := segments[0], segments[1:]
+	if next, ok := n.static[seg]; ok {
+		if h := next.match(rest, method, params, allow); h != nil {
+			return h
+		}
+	}
+	if n.param != nil && seg != "" {
+		if h := n.param.match(rest, method, params, allow); h != nil {
+			params[n.param.name] = seg
+			return h
+		}
+	}
+	if n.wildcard != nil {
+		if h := n.wildcard.serve(method, allow); h != nil {
+			params[n.wildcard.name] = strings.Join(segments, "/")
+			return h
+		}
+	}
+	return nil
+}
+
+// serve returns n's handler for method, with GET standing in for HEAD, and adds the methods n has handlers
+// for to allow.
+func (n *node) serve(method string, allow map[string]bool) http.Handler {
+	if n.handlers == nil {
+		return nil
+	}
+	for _, m := range n.allowed() {
+		allow[m] = true
+	}
+	h, ok := n.handlers[method]
+	if !ok && method == http.MethodHead {
+		h = n.handlers[http.MethodGet]
+	}
+	return h
+}
+
+// allowed returns the methods registered on n, sorted, with HEAD implied by GET.
+func (n *node) allowed() []string {
+	methods := make([]string, 0, len(n.handlers)+1)
+	for m := range n.handlers {
+		methods = append(methods, m)
+	}
+	if _, get := n.handlers[http.MethodGet]; get {
+		if _, head := n.handlers[http.MethodHead]; !head {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// split turns a path into its segments. The leading slash is dropped, so "/" is a single empty segment and
+// "/users/" ends with one.
+func split(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// Group registers routes under a common path prefix with their own middleware.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Group returns a route group whose patterns are prefixed with prefix.
+func (r *Router) Group(prefix string) *Group {
+	return &Group{router: r, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// Group returns a nested group that inherits g's prefix and middleware.
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		router:     g.router,
+		prefix:     g.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append([]Middleware(nil), g.middleware...),
+	}
+}
+
+// Use adds middleware to routes registered on g, and groups created from it, from now on.
+func (g *Group) Use(mw ...Middleware) {
+	g.middleware = append(g.middleware, mw...)
+}
+
+// Handle registers h for method and the group's prefix followed by pattern.
+func (g *Group) Handle(method, pattern string, h http.Handler) {
+	g.router.Handle(method, g.prefix+pattern, Chain(h, g.middleware...))
+}
+
+// HandleFunc registers a handler function for method and the group's prefix followed by pattern.
+func (g *Group) HandleFunc(method, pattern string, h http.HandlerFunc) {
+	g.Handle(method, pattern, h)
+}
+
+// Get registers h for GET requests.
+func (g *Group) Get(pattern string, h http.HandlerFunc) { g.Handle(http.MethodGet, pattern, h) }
+
+// Post registers h for POST requests.
+func (g *Group) Post(pattern string, h http.HandlerFunc) { g.Handle(http.MethodPost, pattern, h) }
+
+// Put registers h for PUT requests.
+func (g *Group) Put(pattern string, h http.HandlerFunc) { g.Handle(http.MethodPut, pattern, h) }
+
+// Patch registers h for PATCH requests.
+func (g *Group) Patch(pattern string, h http.HandlerFunc) { g.Handle(http.MethodPatch, pattern, h) }
+
+// Delete registers h for DELETE requests.
+func (g *Group) Delete(pattern string, h http.HandlerFunc) { g.Handle(http.MethodDelete, pattern, h) }
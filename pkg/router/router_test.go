@@ -0,0 +1,281 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echo writes the route name followed by the request's path parameters in a fixed order.
+func echo(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, name)
+		for _, p := range []string{"id", "path", "name"} {
+			if v, ok := Params(r)[p]; ok {
+				fmt.Fprintf(w, " %s=%s", p, v)
+			}
+		}
+	}
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestMatch(t *testing.T) {
+	r := New()
+	r.Get("/", echo("root"))
+	r.Get("/users", echo("users"))
+	r.Get("/users/me", echo("me"))
+	r.Get("/users/{id}", echo("user"))
+	r.Get("/users/{id}/posts", echo("posts"))
+	r.Get("/files/{path...}", echo("files"))
+	r.Get("/files/readme", echo("readme"))
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/", 200, "root"},
+		{"/users", 200, "users"},
+		{"/users/me", 200, "me"},
+		{"/users/42", 200, "user id=42"},
+		{"/users/42/posts", 200, "posts id=42"},
+		{"/users/", 404, ""},
+		{"/users/42/comments", 404, ""},
+		{"/files/readme", 200, "readme"},
+		{"/files/a/b/c.txt", 200, "files path=a/b/c.txt"},
+		{"/files/", 200, "files path="},
+		{"/nope", 404, ""},
+	}
+	for _, test := range tests {
+		w := serve(r, http.MethodGet, test.path)
+		if w.Code != test.code {
+			t.Errorf("%s: got status %d, want %d", test.path, w.Code, test.code)
+			continue
+		}
+		if test.code == 200 && w.Body.String() != test.body {
+			t.Errorf("%s: got %q, want %q", test.path, w.Body.String(), test.body)
+		}
+	}
+}
+
+func TestBacktracking(t *testing.T) {
+	// /a/b/d has to give up on the literal /a/b branch and match through the parameter instead.
+	r := New()
+	r.Get("/a/b/c", echo("literal"))
+	r.Get("/a/{id}/d", echo("param"))
+
+	if w := serve(r, http.MethodGet, "/a/b/d"); w.Body.String() != "param id=b" {
+		t.Errorf("got %q, want %q", w.Body.String(), "param id=b")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Get("/items/{id}", echo("get"))
+	r.Delete("/items/{id}", echo("delete"))
+
+	w := serve(r, http.MethodPost, "/items/1")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got, want := w.Header().Get("Allow"), "DELETE, GET, HEAD"; got != want {
+		t.Errorf("got Allow %q, want %q", got, want)
+	}
+
+	if w := serve(r, http.MethodHead, "/items/1"); w.Code != http.StatusOK {
+		t.Errorf("HEAD: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestMatchByMethod(t *testing.T) {
+	// A literal route for one method mustn't hide a parameter or wildcard route for another.
+	r := New()
+	r.Post("/users/new", echo("create"))
+	r.Get("/users/{id}", echo("user"))
+	r.Put("/users/{id}", echo("update"))
+	r.Delete("/files/readme", echo("delete readme"))
+	r.Get("/files/{path...}", echo("files"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+		allow        string
+	}{
+		{http.MethodPost, "/users/new", 200, "create", ""},
+		{http.MethodGet, "/users/new", 200, "user id=new", ""},
+		{http.MethodHead, "/users/new", 200, "user id=new", ""},
+		{http.MethodPut, "/users/new", 200, "update id=new", ""},
+		{http.MethodPatch, "/users/new", 405, "", "GET, HEAD, POST, PUT"},
+		{http.MethodPost, "/users/42", 405, "", "GET, HEAD, PUT"},
+		{http.MethodGet, "/files/readme", 200, "files path=readme", ""},
+		{http.MethodPost, "/files/readme", 405, "", "DELETE, GET, HEAD"},
+	}
+	for _, test := range tests {
+		w := serve(r, test.method, test.path)
+		if w.Code != test.code {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, w.Code, test.code)
+			continue
+		}
+		if test.code == 200 && w.Body.String() != test.body {
+			t.Errorf("%s %s: got %q, want %q", test.method, test.path, w.Body.String(), test.body)
+		}
+		if got := w.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.path, got, test.allow)
+		}
+	}
+}
+
+func TestRegistrationPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *Router)
+	}{
+		{"duplicate", func(r *Router) { r.Get("/a", echo("")); r.Get("/a", echo("")) }},
+		{"wildcard not last", func(r *Router) { r.Get("/a/{rest...}/b", echo("")) }},
+		{"conflicting names", func(r *Router) { r.Get("/a/{id}", echo("")); r.Get("/a/{name}/b", echo("")) }},
+		{"malformed", func(r *Router) { r.Get("/a/x{id}", echo("")) }},
+		{"unnamed", func(r *Router) { r.Get("/a/{}", echo("")) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: registration did not panic", test.name)
+				}
+			}()
+			test.register(New())
+		}()
+	}
+}
+
+// tag is middleware that appends its name to the X-Trace response header.
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestGroupsAndMiddleware(t *testing.T) {
+	r := New()
+	r.Use(tag("global"))
+	r.Get("/public", echo("public"))
+
+	api := r.Group("/api/")
+	api.Use(tag("api"))
+	api.Get("/users/{id}", echo("user"))
+	admin := api.Group("/admin")
+	admin.Use(tag("admin"))
+	admin.Post("/reset", echo("reset"))
+
+	tests := []struct {
+		method, path string
+		body, trace  string
+	}{
+		{http.MethodGet, "/public", "public", "global"},
+		{http.MethodGet, "/api/users/7", "user id=7", "global,api"},
+		{http.MethodPost, "/api/admin/reset", "reset", "global,api,admin"},
+		{http.MethodGet, "/missing", "404 page not found\n", "global"},
+	}
+	for _, test := range tests {
+		w := serve(r, test.method, test.path)
+		if w.Body.String() != test.body {
+			t.Errorf("%s: got %q, want %q", test.path, w.Body.String(), test.body)
+		}
+		if got := strings.Join(w.Header().Values("X-Trace"), ","); got != test.trace {
+			t.Errorf("%s: got trace %q, want %q", test.path, got, test.trace)
+		}
+	}
+}
+
+func TestRequestIDAndLogger(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.Use(RequestID(), Logger(log.New(&buf, "", 0)))
+	r.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, RequestIDFrom(r.Context()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "abc123" || w.Header().Get(RequestIDHeader) != "abc123" {
+		t.Errorf("got body %q, header %q, want the client's ID", w.Body.String(), w.Header().Get(RequestIDHeader))
+	}
+	if got, want := buf.String(), "GET /hello 200 6B"; !strings.HasPrefix(got, want) || !strings.Contains(got, "id=abc123") {
+		t.Errorf("got log %q, want it to start with %q and carry the ID", got, want)
+	}
+
+	buf.Reset()
+	w = serve(r, http.MethodPost, "/hello")
+	if len(w.Header().Get(RequestIDHeader)) != 16 {
+		t.Errorf("got generated ID %q, want 16 hex digits", w.Header().Get(RequestIDHeader))
+	}
+	if !strings.HasPrefix(buf.String(), "POST /hello 405 ") {
+		t.Errorf("got log %q, want the 405 logged", buf.String())
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.Use(Recoverer(log.New(&buf, "", 0)))
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+
+	w := serve(r, http.MethodGet, "/boom")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(buf.String(), "panic serving GET /boom: boom") {
+		t.Errorf("got log %q, want the panic logged", buf.String())
+	}
+}
+
+func TestLoggerHijack(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.Use(Logger(log.New(&buf, "", 0)))
+	r.Get("/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+	})
+	// The log line is written after the handler returns, which the client can't tell from the response.
+	logged := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer close(logged)
+		r.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	<-logged
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	if !strings.HasPrefix(buf.String(), "GET /upgrade 101 ") {
+		t.Errorf("got log %q, want the upgrade logged as 101", buf.String())
+	}
+}
@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a job runs next.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero Time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule. It accepts the standard five cron fields
+//
+//	minute hour day-of-month month day-of-week
+//
+// where each field is *, a value, a range a-b, a list separated by commas, or any of those followed by a
+// step such as */15 or 1-30/2. Months and weekdays may also be given by three-letter English names, and
+// Sunday is both 0 and 7. As in classic cron, when both day fields are restricted a day matching either
+// one qualifies.
+//
+// Parse also accepts the shorthands @yearly (or @annually), @monthly, @weekly, @daily (or @midnight),
+// @hourly and @every followed by a time.ParseDuration string, such as "@every 30s".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("scheduler: %q: interval must be positive", spec)
+		}
+		return Every(d), nil
+	}
+	if expanded, ok := shorthands[spec]; ok {
+		spec = expanded
+	} else if strings.HasPrefix(spec, "@") {
+		return nil, fmt.Errorf("scheduler: unknown shorthand %q", spec)
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduler: %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var s cronSchedule
+	var err error
+	if s.minute, _, err = parseField(fields[0], minutes); err != nil {
+		return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+	}
+	if s.hour, _, err = parseField(fields[1], hours); err != nil {
+		return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+	}
+	var domStar, dowStar bool
+	if s.dom, domStar, err = parseField(fields[2], daysOfMonth); err != nil {
+		return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+	}
+	if s.month, _, err = parseField(fields[3], months); err != nil {
+		return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+	}
+	if s.dow, dowStar, err = parseField(fields[4], daysOfWeek); err != nil {
+		return nil, fmt.Errorf("scheduler: %q: %w", spec, err)
+	}
+	// Sunday may be written as 7; fold it onto 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.eitherDay = !domStar && !dowStar
+	return &s, nil
+}
+
+// MustParse is like Parse but panics if spec is invalid. It simplifies the initialization of schedules
+// held in package variables.
+func MustParse(spec string) Schedule {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Every returns a Schedule that activates every d, counted from the previous activation.
+func Every(d time.Duration) Schedule {
+	return everySchedule(d)
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// nextAfter returns the first activation of sched after now, counting on from next, an activation that is
+// already due. The schedules of this package get there directly, however many activations were missed: an
+// Every schedule by dividing the time elapsed by its interval, and a cron schedule, which doesn't depend on
+// the previous activation, by searching from now. Other schedules are stepped through.
+func nextAfter(sched Schedule, next, now time.Time) time.Time {
+	switch sched := sched.(type) {
+	case everySchedule:
+		d := time.Duration(sched)
+		return next.Add((now.Sub(next)/d + 1) * d)
+	case *cronSchedule:
+		return sched.Next(now)
+	}
+	for !next.IsZero() && !next.After(now) {
+		next = sched.Next(next)
+	}
+	return next
+}
+
+// bounds describes the legal values of one cron field.
+type bounds struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes     = bounds{name: "minute", min: 0, max: 59}
+	hours       = bounds{name: "hour", min: 0, max: 23}
+	daysOfMonth = bounds{name: "day of month", min: 1, max: 31}
+	months      = bounds{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	daysOfWeek = bounds{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// parseField returns a bit set with bit i set when value i matches, and whether the field started with *.
+func parseField(field string, b bounds) (uint64, bool, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, step := b.min, b.max, 1
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, false, fmt.Errorf("invalid step in %s field %q", b.name, part)
+			}
+			step, rng = n, part[:i]
+		}
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if lo, err = b.value(rng[:i]); err != nil {
+				return 0, false, err
+			}
+			if hi, err = b.value(rng[i+1:]); err != nil {
+				return 0, false, err
+			}
+			if lo > hi {
+				return 0, false, fmt.Errorf("%s range %q runs backwards", b.name, rng)
+			}
+		default:
+			v, err := b.value(rng)
+			if err != nil {
+				return 0, false, err
+			}
+			// A single value with a step, such as 5/15, runs from that value to the end of the range.
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, strings.HasPrefix(field, "*"), nil
+}
+
+// value parses one number or name and checks it is in range.
+func (b bounds) value(s string) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", b.name, s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%s %d out of range %d-%d", b.name, v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// cronSchedule is a parsed five-field expression. Each field is a bit set of the values that match.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	eitherDay                     bool
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	// Walk forward a month, day, hour or minute at a time, always jumping to the start of the unit that
+	// failed to match. Five years is long enough to find any date that can exist, including February 29.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.eitherDay {
+		return dom || dow
+	}
+	return dom && dow
+}
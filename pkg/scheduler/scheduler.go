@@ -0,0 +1,289 @@
+// Package scheduler runs jobs on cron schedules. The Tickers example fires at a fixed period and the Timers
+// example fires once; a Scheduler keeps one timer armed for whichever job is due next, so any mix of
+// schedules costs a single Goroutine while idle.
+//
+// Each job runs in its own Goroutine. A job that is still running when it comes due again is skipped rather
+// than started twice, and an optional jitter spreads out jobs that share a schedule. Cancelling the context
+// passed to Run stops the scheduler, cancels the context handed to running jobs and waits for them to
+// return.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// Job is the work run on a schedule. ctx is cancelled when the scheduler stops.
+type Job func(ctx context.Context)
+
+// EntryID identifies a job added to a Scheduler.
+type EntryID int
+
+// Entry describes a scheduled job as returned by Entries.
+type Entry struct {
+	ID       EntryID
+	Name     string
+	Schedule Schedule
+	// Next is the time the job is due next, or zero if its schedule has no further activations.
+	Next time.Time
+	// Prev is the scheduled time of the job's last run, or zero if it has not run yet.
+	Prev time.Time
+	// Running reports whether the job is in progress.
+	Running bool
+	// Runs counts the times the job started, and Skipped the times it came due while still running.
+	Runs, Skipped int
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithClock sets the clock the scheduler reads time from. The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithRand sets the source of randomness used for jitter, which lets tests make it repeatable.
+func WithRand(r *rand.Rand) Option {
+	return func(s *Scheduler) {
+		s.rand = r
+	}
+}
+
+// JobOption configures a single job.
+type JobOption func(*entry)
+
+// WithJitter delays each run of the job by a random duration in [0, max), so that jobs sharing a schedule do
+// not all start at the same instant.
+func WithJitter(max time.Duration) JobOption {
+	return func(e *entry) {
+		e.jitter = max
+	}
+}
+
+type entry struct {
+	Entry
+	job    Job
+	jitter time.Duration
+}
+
+// Scheduler runs jobs on their schedules. Jobs may be added and removed before or while Run is active.
+type Scheduler struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	entries map[EntryID]*entry
+	nextID  EntryID
+	running bool
+	// wake is signalled when the set of entries changes, so the run loop can re-arm its timer.
+	wake chan struct{}
+}
+
+// New returns a Scheduler with no jobs.
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		clock:   clock.Real{},
+		entries: make(map[EntryID]*entry),
+		wake:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.rand == nil {
+		s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s
+}
+
+// Add parses spec with Parse and schedules job under name.
+func (s *Scheduler) Add(name, spec string, job Job, opts ...JobOption) (EntryID, error) {
+	sched, err := Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	return s.Schedule(name, sched, job, opts...), nil
+}
+
+// Schedule adds job to run on sched and returns its ID.
+func (s *Scheduler) Schedule(name string, sched Schedule, job Job, opts ...JobOption) EntryID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	e := &entry{Entry: Entry{ID: s.nextID, Name: name, Schedule: sched}, job: job}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.Next = sched.Next(s.clock.Now())
+	s.entries[e.ID] = e
+	s.notify()
+	return e.ID
+}
+
+// Remove unschedules a job. A run already in progress is not interrupted.
+func (s *Scheduler) Remove(id EntryID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	s.notify()
+}
+
+// Entries returns a snapshot of every job, ordered by when it is next due.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, e.Entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Next, out[j].Next
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Entry returns the current state of one job.
+func (s *Scheduler) Entry(id EntryID) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return e.Entry, true
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts jobs as they come due until ctx is cancelled. It then waits for running jobs, whose context is
+// cancelled at the same time, and returns ctx.Err(). Run may only be active once at a time.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("scheduler: already running")
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	// Jobs added before Run are picked up by the first pass below, so any wake-up they queued is stale.
+	select {
+	case <-s.wake:
+	default:
+	}
+
+	// The timer is only created once some job is due, and a nil channel blocks forever while it is idle.
+	var timer clock.Timer
+	var fired <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		now := s.clock.Now()
+		next := s.startDue(ctx, now, &wg)
+		switch {
+		case next.IsZero():
+			if timer != nil {
+				timer.Stop()
+			}
+			fired = nil
+		case timer == nil:
+			timer = s.clock.NewTimer(next.Sub(now))
+			fired = timer.C()
+		default:
+			timer.Reset(next.Sub(now))
+			fired = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		case <-fired:
+		}
+	}
+}
+
+// startDue launches every job due at or before now and returns the earliest time any job is due next.
+func (s *Scheduler) startDue(ctx context.Context, now time.Time, wg *sync.WaitGroup) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var earliest time.Time
+	for _, e := range s.entries {
+		// A job due several times over, because the process was busy or the clock jumped, runs once and
+		// then resumes its schedule from now.
+		if !e.Next.IsZero() && !e.Next.After(now) {
+			if e.Running {
+				e.Skipped++
+			} else {
+				s.start(ctx, e, wg)
+			}
+			e.Next = nextAfter(e.Schedule, e.Next, now)
+		}
+		if !e.Next.IsZero() && (earliest.IsZero() || e.Next.Before(earliest)) {
+			earliest = e.Next
+		}
+	}
+	return earliest
+}
+
+// start runs e in a new Goroutine. It is called with s.mu held.
+func (s *Scheduler) start(ctx context.Context, e *entry, wg *sync.WaitGroup) {
+	e.Running = true
+	e.Runs++
+	e.Prev = e.Next
+	var delay time.Duration
+	if e.jitter > 0 {
+		delay = time.Duration(s.rand.Int63n(int64(e.jitter)))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			s.mu.Lock()
+			e.Running = false
+			s.mu.Unlock()
+		}()
+		if delay > 0 {
+			t := s.clock.NewTimer(delay)
+			select {
+			case <-t.C():
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+		e.job(ctx)
+	}()
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/keithwegner/go-by-example/pkg/clock"
+)
+
+// start is a Tuesday.
+var start = time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC)
+
+func TestParseNext(t *testing.T) {
+	var tests = []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, 6, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 6, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC)},
+		{"5,10 0 * * *", time.Date(2021, 6, 2, 0, 5, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 JAN *", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// With both day fields restricted, either may match: the 15th or the next Friday.
+		{"0 0 15 * fri", time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 30s", time.Date(2021, 6, 1, 10, 30, 30, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(start); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every",
+		"@every -1s",
+		"@fortnightly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// stepped hides the type of a Schedule, so nextAfter has to step through it.
+type stepped struct{ Schedule }
+
+func TestNextAfter(t *testing.T) {
+	// A pause of a year is over 30 million missed activations of @every 1s.
+	now := start.AddDate(1, 0, 0).Add(1500 * time.Millisecond)
+	tests := []struct {
+		spec string
+		now  time.Time
+		want time.Time
+	}{
+		{"@every 1s", now, start.AddDate(1, 0, 0).Add(2 * time.Second)},
+		{"@every 1s", start, start.Add(time.Second)},
+		{"@every 7m", start.Add(time.Hour), start.Add(63 * time.Minute)},
+		{"@hourly", now, time.Date(2022, 6, 1, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nextAfter(sched, start, tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s after %v: got %v, want %v", tt.spec, tt.now, got, tt.want)
+		}
+		// Stepping one activation at a time gets to the same place, where that is quick enough to try.
+		if tt.now.Sub(start) < 24*time.Hour {
+			if got := nextAfter(stepped{sched}, start, tt.now); !got.Equal(tt.want) {
+				t.Errorf("%s after %v, stepped: got %v, want %v", tt.spec, tt.now, got, tt.want)
+			}
+		}
+	}
+}
+
+// runScheduler starts s.Run and returns a function that stops it and returns Run's error.
+func runScheduler(s *Scheduler) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+	return func() error {
+		cancel()
+		return <-errc
+	}
+}
+
+func TestSchedulerRuns(t *testing.T) {
+	c := clock.NewFake(start)
+	s := New(WithClock(c))
+
+	ran := make(chan time.Time, 10)
+	id, err := s.Add("tick", "@every 1m", func(ctx context.Context) { ran <- c.Now() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := runScheduler(s)
+
+	for i := 1; i <= 3; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Minute)
+		if got, want := <-ran, start.Add(time.Duration(i)*time.Minute); !got.Equal(want) {
+			t.Errorf("run %d at %v, want %v", i, got, want)
+		}
+	}
+
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned %v, want %v", err, context.Canceled)
+	}
+	e, _ := s.Entry(id)
+	if e.Runs != 3 {
+		t.Errorf("got %d runs, want 3", e.Runs)
+	}
+	if want := start.Add(4 * time.Minute); !e.Next.Equal(want) {
+		t.Errorf("next run %v, want %v", e.Next, want)
+	}
+}
+
+func TestSchedulerSkipsOverlap(t *testing.T) {
+	c := clock.NewFake(start)
+	s := New(WithClock(c))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	id, _ := s.Add("slow", "* * * * *", func(ctx context.Context) {
+		started <- struct{}{}
+		<-release
+	})
+	stop := runScheduler(s)
+	defer stop()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	<-started
+
+	// The job is still running when it comes due again, so this activation is skipped.
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+
+	e, _ := s.Entry(id)
+	if e.Runs != 1 || e.Skipped != 1 || !e.Running {
+		t.Errorf("got runs=%d skipped=%d running=%v, want 1, 1, true", e.Runs, e.Skipped, e.Running)
+	}
+	close(release)
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	c := clock.NewFake(start)
+	s := New(WithClock(c), WithRand(rand.New(rand.NewSource(1))))
+
+	ran := make(chan time.Time, 1)
+	s.Add("jittery", "@every 1m", func(ctx context.Context) { ran <- c.Now() }, WithJitter(10*time.Second))
+	stop := runScheduler(s)
+	defer stop()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+
+	// The run now waits on its own jitter timer as well as the scheduler's timer for the next activation.
+	c.BlockUntil(2)
+	select {
+	case <-ran:
+		t.Fatal("job ran before its jitter elapsed")
+	default:
+	}
+	c.Advance(10 * time.Second)
+	got := <-ran
+	if got.Before(start.Add(time.Minute)) || !got.Before(start.Add(time.Minute+10*time.Second+1)) {
+		t.Errorf("job ran at %v, outside the jitter window", got)
+	}
+}
+
+func TestSchedulerStopWaitsForJobs(t *testing.T) {
+	c := clock.NewFake(start)
+	s := New(WithClock(c))
+
+	started := make(chan struct{})
+	finished := false
+	s.Add("graceful", "@every 1s", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		finished = true
+	})
+	stop := runScheduler(s)
+
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	<-started
+	stop()
+	if !finished {
+		t.Error("Run returned before the running job finished")
+	}
+}
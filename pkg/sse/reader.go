@@ -0,0 +1,148 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader parses an event stream.
+type Reader struct {
+	r      *bufio.Reader
+	lastID string
+	retry  time.Duration
+}
+
+// NewReader returns a Reader that parses events from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// LastEventID returns the ID most recently set by the stream, which is what a reconnecting client sends in
+// its Last-Event-ID header.
+func (r *Reader) LastEventID() string {
+	return r.lastID
+}
+
+// Retry returns the reconnection delay the stream most recently set, or 0 if it hasn't set one. As the spec
+// requires, a retry field takes effect at once, even in a block that dispatches no event.
+func (r *Reader) Retry() time.Duration {
+	return r.retry
+}
+
+// Next returns the next event. Comments, such as heartbeats, and blocks without data are skipped, as are
+// unknown fields. It returns io.EOF when the stream ends between events and io.ErrUnexpectedEOF when it ends
+// in the middle of one.
+func (r *Reader) Next() (Event, error) {
+	var e Event
+	var data []string
+	started := false
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && (started || line != "") {
+				return Event{}, io.ErrUnexpectedEOF
+			}
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// A blank line dispatches the event, if it had any data.
+			if data != nil {
+				e.ID = r.lastID
+				e.Data = strings.Join(data, "\n")
+				return e, nil
+			}
+			e, data, started = Event{}, nil, false
+			continue
+		}
+		started = true
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			// The spec ignores IDs containing NUL, since they can't be sent back in a header.
+			if !strings.ContainsRune(value, 0) {
+				r.lastID = value
+			}
+		case "event":
+			e.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				r.retry = time.Duration(ms) * time.Millisecond
+				e.Retry = r.retry
+			}
+		}
+	}
+}
+
+// Subscribe reads events from url and calls fn for each, reconnecting with Last-Event-ID whenever the stream
+// breaks so no buffered event is missed. It waits retry between attempts, or the delay the server last asked
+// for. Subscribe returns when ctx is done, when fn returns an error, or when the server answers with a status
+// other than 200, which per the spec means the client should stop.
+func Subscribe(ctx context.Context, client *http.Client, url string, retry time.Duration, fn func(Event) error) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	lastID := ""
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+
+		resp, err := client.Do(req)
+		if err == nil {
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				return fmt.Errorf("sse: %s: %s", url, resp.Status)
+			}
+			r := NewReader(resp.Body)
+			r.lastID = lastID
+			for {
+				var e Event
+				e, err = r.Next()
+				if err != nil {
+					break
+				}
+				if err = fn(e); err != nil {
+					resp.Body.Close()
+					return err
+				}
+			}
+			lastID = r.LastEventID()
+			if d := r.Retry(); d > 0 {
+				retry = d
+			}
+			resp.Body.Close()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// A network error or a stream that ended are both retried.
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
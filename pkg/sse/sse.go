@@ -0,0 +1,275 @@
+// Package sse implements Server-Sent Events, the text/event-stream format browsers read with EventSource. It
+// lets the HTTP Server example push live updates over a plain HTTP response instead of writing it all at once:
+// a Server keeps each client's response open and flushes every published event to it as it happens.
+//
+// Every event gets an increasing ID, and the Server keeps the most recent ones in a bounded replay buffer. A
+// client that reconnects with a Last-Event-ID header is first sent the events it missed. The same mechanism
+// handles backpressure: each client has a bounded queue, and a client too slow to keep up is disconnected
+// rather than allowed to hold up publishers or grow without limit. When it reconnects it catches up from the
+// replay buffer. Comment lines are sent as heartbeats so that proxies don't close idle streams.
+package sse
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single server-sent event.
+type Event struct {
+	// ID identifies the event. The Server assigns IDs when publishing; on the client side it is the last ID
+	// the stream has set, as the spec requires, even if this event had no id field.
+	ID string
+	// Event is the event type. An empty type is delivered as "message".
+	Event string
+	// Data is the payload. It may contain newlines.
+	Data string
+	// Retry, if set, tells the client how long to wait before reconnecting. A Reader only sets it on an event
+	// whose own block had a retry field; Reader.Retry has the latest value either way.
+	Retry time.Duration
+}
+
+// Option configures a Server.
+type Option func(*config)
+
+type config struct {
+	replay    int
+	buffer    int
+	heartbeat time.Duration
+}
+
+// WithReplay sets how many recent events are kept for clients resuming with Last-Event-ID. The default is 100.
+func WithReplay(n int) Option {
+	return func(c *config) {
+		c.replay = n
+	}
+}
+
+// WithBuffer sets how many events may be queued for a client before it is considered too slow and
+// disconnected. The default is 16.
+func WithBuffer(n int) Option {
+	return func(c *config) {
+		c.buffer = n
+	}
+}
+
+// WithHeartbeat sets how often a comment is sent on an idle stream. The default is 15 seconds; 0 disables
+// heartbeats.
+func WithHeartbeat(d time.Duration) Option {
+	return func(c *config) {
+		c.heartbeat = d
+	}
+}
+
+// Stats counts a Server's clients and events.
+type Stats struct {
+	// Clients is the number of streams currently open.
+	Clients int
+	// Published counts events published and Dropped counts clients disconnected for falling behind.
+	Published, Dropped uint64
+}
+
+// Server is an http.Handler that streams published events to every connected client. It is safe for
+// concurrent use.
+type Server struct {
+	cfg config
+
+	mu      sync.Mutex
+	seq     uint64
+	history []Event
+	clients map[*client]bool
+	closed  bool
+	dropped uint64
+}
+
+type client struct {
+	events chan Event
+	// gone is closed when the server drops the client.
+	gone chan struct{}
+}
+
+// NewServer returns a Server with no clients.
+func NewServer(opts ...Option) *Server {
+	cfg := config{replay: 100, buffer: 16, heartbeat: 15 * time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Server{cfg: cfg, clients: make(map[*client]bool)}
+}
+
+// Publish assigns e the next ID, remembers it for replay and queues it for every client. A client whose queue
+// is full is disconnected. Publish never blocks on a client, and returns the event as sent, which has any
+// line breaks in its type removed, since they would start new fields.
+func (s *Server) Publish(e Event) Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	e.ID = strconv.FormatUint(s.seq, 10)
+	e.Event = lineBreaks.Replace(e.Event)
+	if s.cfg.replay > 0 {
+		if len(s.history) == s.cfg.replay {
+			copy(s.history, s.history[1:])
+			s.history = s.history[:len(s.history)-1]
+		}
+		s.history = append(s.history, e)
+	}
+	for c := range s.clients {
+		select {
+		case c.events <- e:
+		default:
+			s.dropLocked(c)
+			s.dropped++
+		}
+	}
+	return e
+}
+
+func (s *Server) dropLocked(c *client) {
+	delete(s.clients, c)
+	close(c.gone)
+}
+
+// Stats returns the server's counters.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Clients: len(s.clients), Published: s.seq, Dropped: s.dropped}
+}
+
+// Close ends every stream and makes new requests fail with 503 Service Unavailable. It is safe to call more than
+// once, and suits http.Server.RegisterOnShutdown, since streams never finish by themselves.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for c := range s.clients {
+		s.dropLocked(c)
+	}
+}
+
+// subscribe registers a client and returns the events it missed since lastID. Both happen under the lock, so
+// no event is either missed or sent twice between the replay and the live stream.
+func (s *Server) subscribe(lastID string) (*client, []Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil, false
+	}
+
+	var missed []Event
+	if lastID != "" {
+		// An ID the server doesn't recognise, perhaps from before a restart, gets the whole buffer.
+		last, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil || last > s.seq {
+			last = 0
+		}
+		for _, e := range s.history {
+			if id, _ := strconv.ParseUint(e.ID, 10, 64); id > last {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	c := &client{events: make(chan Event, s.cfg.buffer), gone: make(chan struct{})}
+	s.clients[c] = true
+	return c, missed, true
+}
+
+func (s *Server) unsubscribe(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		s.dropLocked(c)
+	}
+}
+
+// ServeHTTP streams events to the client until it disconnects, falls behind or the server is closed. The
+// client's last event ID is read from the Last-Event-ID header, or from a lastEventId query parameter for
+// clients that can't set headers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	c, missed, ok := s.subscribe(lastID)
+	if !ok {
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(c)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream.
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range missed {
+		if _, err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if s.cfg.heartbeat > 0 {
+		t := time.NewTicker(s.cfg.heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+	for {
+		select {
+		case e := <-c.events:
+			if _, err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-c.gone:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// lineBreaks removes the characters that end a line in an event stream.
+var lineBreaks = strings.NewReplacer("\r", "", "\n", "")
+
+// writeEvent writes e in the event stream format. A line break in the ID or type would end the field and let
+// the rest of the value pass for fields or events of its own, so line breaks are dropped from both.
+func writeEvent(w io.Writer, e Event) (int, error) {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", lineBreaks.Replace(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", lineBreaks.Replace(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	// Each line of the payload goes in its own data field; the reader joins them with newlines again.
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return io.WriteString(w, b.String())
+}
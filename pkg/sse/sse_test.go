@@ -0,0 +1,247 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+		err    error
+	}{
+		{
+			"fields",
+			"id: 1\nevent: tick\nretry: 2500\ndata: hello\n\n",
+			[]Event{{ID: "1", Event: "tick", Data: "hello", Retry: 2500 * time.Millisecond}},
+			io.EOF,
+		},
+		{
+			"multi-line data and CRLF",
+			"data: one\r\ndata:two\r\ndata\r\n\r\n",
+			[]Event{{Data: "one\ntwo\n"}},
+			io.EOF,
+		},
+		{
+			"comments, empty blocks and sticky IDs",
+			": heartbeat\n\nid: 7\n\ndata: a\n\nunknown: x\ndata: b\n\n",
+			[]Event{{ID: "7", Data: "a"}, {ID: "7", Data: "b"}},
+			io.EOF,
+		},
+		{
+			"truncated",
+			"data: complete\n\ndata: partial\n",
+			[]Event{{Data: "complete"}},
+			io.ErrUnexpectedEOF,
+		},
+	}
+	for _, test := range tests {
+		r := NewReader(strings.NewReader(test.stream))
+		var got []Event
+		var err error
+		for {
+			var e Event
+			if e, err = r.Next(); err != nil {
+				break
+			}
+			got = append(got, e)
+		}
+		if !reflect.DeepEqual(got, test.want) || err != test.err {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestReaderRetryWithoutData(t *testing.T) {
+	r := NewReader(strings.NewReader("retry: 3000\n\ndata: x\n\n"))
+	e, err := r.Next()
+	if err != nil || e.Data != "x" || e.Retry != 0 {
+		t.Fatalf("got %+v, %v, want the data event without a retry of its own", e, err)
+	}
+	if got := r.Retry(); got != 3*time.Second {
+		t.Errorf("got retry %v, want 3s from the block without data", got)
+	}
+}
+
+func TestWriteEventLineBreaks(t *testing.T) {
+	var b strings.Builder
+	writeEvent(&b, Event{ID: "1\nevent: fake", Event: "tick\r\ndata: injected\n", Data: "real"})
+	r := NewReader(strings.NewReader(b.String()))
+	var got []Event
+	for {
+		e, err := r.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, e)
+	}
+	want := []Event{{ID: "1event: fake", Event: "tickdata: injected", Data: "real"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v from %q, want %+v", got, b.String(), want)
+	}
+}
+
+// connect opens a stream on srv, optionally resuming after lastID.
+func connect(t *testing.T, srv *httptest.Server, lastID string) (*Reader, func()) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", ct)
+	}
+	return NewReader(resp.Body), func() { resp.Body.Close() }
+}
+
+// waitClients polls until s has n clients.
+func waitClients(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats().Clients != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d clients, want %d", s.Stats().Clients, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expect(t *testing.T, r *Reader, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		e, err := r.Next()
+		if err != nil || e.ID != id || e.Data != "event "+id+"\nsecond line" {
+			t.Fatalf("got %+v, %v, want event %s", e, err, id)
+		}
+	}
+}
+
+func publish(s *Server, n int) {
+	for i := 0; i < n; i++ {
+		s.Publish(Event{Event: "count", Data: fmt.Sprintf("event %d\nsecond line", s.Stats().Published+1)})
+	}
+}
+
+func TestStreamAndResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID string
+		replay []string
+	}{
+		{"fresh", "", nil},
+		{"resume", "3", []string{"4", "5"}},
+		{"resume beyond the buffer", "1", []string{"3", "4", "5"}},
+		{"unknown ID", "bogus", []string{"3", "4", "5"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(WithReplay(3))
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			publish(s, 5)
+
+			r, stop := connect(t, srv, test.lastID)
+			defer stop()
+			expect(t, r, test.replay...)
+
+			waitClients(t, s, 1)
+			publish(s, 1)
+			expect(t, r, "6")
+			stop()
+			waitClients(t, s, 0)
+		})
+	}
+}
+
+func TestSlowClientIsDropped(t *testing.T) {
+	s := NewServer(WithBuffer(1))
+	c, _, _ := s.subscribe("")
+	publish(s, 2)
+
+	select {
+	case <-c.gone:
+	default:
+		t.Fatal("client with a full queue was not dropped")
+	}
+	if st := s.Stats(); st.Dropped != 1 || st.Clients != 0 {
+		t.Errorf("got %+v, want 1 dropped and no clients", st)
+	}
+}
+
+func TestHeartbeatAndClose(t *testing.T) {
+	s := NewServer(WithHeartbeat(5 * time.Millisecond))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": heartbeat\n" {
+		t.Fatalf("got %q, %v, want a heartbeat", line, err)
+	}
+
+	s.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("got %v reading to the end of a closed stream", err)
+	}
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after Close, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	// The first connection ends after two events; the second must resume after the last ID it saw.
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(lastIDs) == 1 {
+			fmt.Fprint(w, "retry: 1\nid: 1\ndata: a\n\nid: 2\ndata: b\n\n")
+			return
+		}
+		fmt.Fprint(w, "id: 3\ndata: c\n\n")
+	}))
+	defer srv.Close()
+
+	stop := errors.New("stop")
+	var got []string
+	err := Subscribe(context.Background(), nil, srv.URL, time.Hour, func(e Event) error {
+		got = append(got, e.ID+e.Data)
+		if len(got) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("got %v, want the callback's error", err)
+	}
+	if want := []string{"1a", "2b", "3c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := []string{"", "2"}; !reflect.DeepEqual(lastIDs, want) {
+		t.Errorf("got Last-Event-IDs %q, want %q", lastIDs, want)
+	}
+}
@@ -0,0 +1,303 @@
+// Package tlsutil sets up TLS for the HTTP examples without any outside certificate authority. Generate
+// creates a private CA with crypto/x509 and uses it to sign a server certificate for the local host names and
+// a client certificate, writing them all as PEM files to a directory. ServerConfig and ClientConfig then load
+// those files into tls.Configs: the client trusts only the generated CA, so it is pinned rather than trusting
+// every CA the system knows, and the server can require clients to present a certificate signed by it too,
+// which is mutual TLS.
+//
+// Keys are ECDSA on the P-256 curve, which every TLS 1.2 and 1.3 implementation supports and which is much
+// faster to generate than RSA.
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ClientName is the common name of the client certificate Generate issues.
+const ClientName = "go-by-example client"
+
+// Files names the PEM files Generate writes to a directory.
+type Files struct {
+	CA, CAKey             string
+	Cert, Key             string
+	ClientCert, ClientKey string
+}
+
+// FilesIn returns the names of the files Generate writes to dir.
+func FilesIn(dir string) Files {
+	return Files{
+		CA:         filepath.Join(dir, "ca.pem"),
+		CAKey:      filepath.Join(dir, "ca-key.pem"),
+		Cert:       filepath.Join(dir, "server.pem"),
+		Key:        filepath.Join(dir, "server-key.pem"),
+		ClientCert: filepath.Join(dir, "client.pem"),
+		ClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+}
+
+// Option configures Generate.
+type Option func(*config)
+
+type config struct {
+	validity   time.Duration
+	caValidity time.Duration
+}
+
+// WithValidity sets how long the server and client certificates are valid. The default is 90 days.
+func WithValidity(d time.Duration) Option {
+	return func(c *config) {
+		c.validity = d
+	}
+}
+
+// WithCAValidity sets how long a newly created CA certificate is valid. The default is ten years.
+func WithCAValidity(d time.Duration) Option {
+	return func(c *config) {
+		c.caValidity = d
+	}
+}
+
+// CA is a certificate authority that can issue certificates.
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// KeyPair is a certificate and its private key, both PEM-encoded.
+type KeyPair struct {
+	CertPEM, KeyPEM []byte
+}
+
+// Generate writes a CA, a server certificate for hosts and a client certificate to dir, creating the
+// directory if needed. Each host is a DNS name or an IP address; with none, the certificate is for localhost,
+// 127.0.0.1 and ::1. An existing CA in dir is reused, so clients that already trust it keep working when the
+// other certificates are reissued. Private keys are only readable by their owner.
+func Generate(dir string, hosts []string, opts ...Option) (Files, error) {
+	cfg := config{validity: 90 * 24 * time.Hour, caValidity: 10 * 365 * 24 * time.Hour}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	files := FilesIn(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Files{}, err
+	}
+
+	ca, err := LoadCA(files.CA, files.CAKey)
+	if errors.Is(err, fs.ErrNotExist) {
+		if ca, err = NewCA("go-by-example local CA", cfg.caValidity); err != nil {
+			return Files{}, err
+		}
+		if err = writePair(files.CA, files.CAKey, ca.pair()); err != nil {
+			return Files{}, err
+		}
+	} else if err != nil {
+		return Files{}, err
+	}
+
+	server, err := ca.Issue(hosts[0], hosts, false, cfg.validity)
+	if err != nil {
+		return Files{}, err
+	}
+	if err := writePair(files.Cert, files.Key, server); err != nil {
+		return Files{}, err
+	}
+	client, err := ca.Issue(ClientName, nil, true, cfg.validity)
+	if err != nil {
+		return Files{}, err
+	}
+	if err := writePair(files.ClientCert, files.ClientKey, client); err != nil {
+		return Files{}, err
+	}
+	return files, nil
+}
+
+func writePair(certFile, keyFile string, kp KeyPair) error {
+	if err := os.WriteFile(certFile, kp.CertPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, kp.KeyPEM, 0600)
+}
+
+// NewCA creates a self-signed CA certificate valid for the given duration.
+func NewCA(name string, validity time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		// The CA may only sign leaf certificates, not further CAs.
+		MaxPathLenZero: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}, nil
+}
+
+// LoadCA reads a CA written by Generate. The error wraps fs.ErrNotExist if either file is missing.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !cert.IsCA {
+		return nil, fmt.Errorf("tlsutil: %s is not an ECDSA CA", certFile)
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: key, pem: certPEM}, nil
+}
+
+func (ca *CA) pair() KeyPair {
+	der, _ := x509.MarshalECPrivateKey(ca.Key)
+	return KeyPair{CertPEM: ca.pem, KeyPEM: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})}
+}
+
+// Issue creates a certificate signed by the CA. A server certificate is valid for hosts, which may be DNS
+// names or IP addresses; a client certificate identifies its holder by name and may only be used to
+// authenticate to a server.
+func (ca *CA) Issue(name string, hosts []string, client bool, validity time.Duration) (KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return KeyPair{}, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	// Clients check the host they dialed against the subject alternative names, never the common name.
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// serialNumber returns a random 128-bit serial number, as the CA/Browser Forum requires at least 64 bits of
+// randomness.
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// certPool returns a pool holding only the certificates in the PEM file.
+func certPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tlsutil: no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// ServerConfig returns a TLS configuration that serves the server certificate in files. With
+// requireClientCert, clients must present a certificate signed by the CA in files, whose chain is then found in
+// the request's TLS.VerifiedChains. HTTP/2 is offered along with HTTP/1.1.
+func ServerConfig(files Files, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if requireClientCert {
+		if cfg.ClientCAs, err = certPool(files.CA); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientConfig returns a TLS configuration that trusts only the CA in files, so the client accepts no other
+// server even if its certificate is signed by a CA the system trusts. With clientCert, the client presents
+// the client certificate in files for servers that require one.
+func ClientConfig(files Files, clientCert bool) (*tls.Config, error) {
+	pool, err := certPool(files.CA)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if clientCert {
+		cert, err := tls.LoadX509KeyPair(files.ClientCert, files.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
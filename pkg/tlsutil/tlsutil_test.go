@@ -0,0 +1,120 @@
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serve starts an HTTPS server with the generated certificate that answers with the protocol and the client
+// certificate's name.
+func serve(t *testing.T, files Files, mutual bool) *httptest.Server {
+	cfg, err := ServerConfig(files, mutual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "anonymous"
+		if len(r.TLS.VerifiedChains) > 0 {
+			name = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		fmt.Fprintf(w, "%s %s", r.Proto, name)
+	}))
+	srv.TLS = cfg
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func client(t *testing.T, cfg *tls.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true}}
+}
+
+func get(c *http.Client, url string) (string, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var b bytes.Buffer
+	b.ReadFrom(resp.Body)
+	return b.String(), nil
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	files, err := Generate(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(files.Key); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("got %v, %v for the server key, want mode 0600", fi.Mode(), err)
+	}
+
+	// Generating again reissues the leaf certificates but keeps the CA, which clients may have pinned.
+	ca, _ := os.ReadFile(files.CA)
+	cert, _ := os.ReadFile(files.Cert)
+	if _, err := Generate(dir, []string{"example.test"}); err != nil {
+		t.Fatal(err)
+	}
+	ca2, _ := os.ReadFile(files.CA)
+	cert2, _ := os.ReadFile(files.Cert)
+	if !bytes.Equal(ca, ca2) || bytes.Equal(cert, cert2) {
+		t.Error("want the CA kept and the server certificate reissued")
+	}
+	pair, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Leaf == nil {
+		// Go versions before 1.23 don't fill in Leaf.
+		t.Skip("no parsed leaf")
+	}
+	if got := strings.Join(pair.Leaf.DNSNames, ","); got != "example.test" {
+		t.Errorf("got DNS names %q, want example.test", got)
+	}
+}
+
+func TestPinnedAndMutualTLS(t *testing.T) {
+	files, err := Generate(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := ClientConfig(files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCert, err := ClientConfig(files, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(t, files, false)
+	if got, err := get(client(t, pinned), srv.URL); err != nil || got != "HTTP/2.0 anonymous" {
+		t.Errorf("got %q, %v, want an HTTP/2 response", got, err)
+	}
+	// Without the CA pinned the generated certificate is just an unknown issuer.
+	if _, err := get(client(t, &tls.Config{}), srv.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("got %v, want a certificate error from a client without the CA", err)
+	}
+	// A pinned client refuses a server with a certificate from any other CA.
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+	if _, err := get(client(t, pinned), other.URL); err == nil {
+		t.Error("pinned client accepted a certificate from another CA")
+	}
+
+	mutual := serve(t, files, true)
+	if got, err := get(client(t, withCert), mutual.URL); err != nil || got != "HTTP/2.0 "+ClientName {
+		t.Errorf("got %q, %v, want the client authenticated", got, err)
+	}
+	if _, err := get(client(t, pinned), mutual.URL); err == nil {
+		t.Error("server requiring client certificates accepted a client without one")
+	}
+}
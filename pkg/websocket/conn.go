@@ -0,0 +1,458 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	// TextMessage is a message of UTF-8 text.
+	TextMessage MessageType = 1
+	// BinaryMessage is a message of arbitrary bytes.
+	BinaryMessage MessageType = 2
+)
+
+// Frame opcodes from section 5.2 of RFC 6455.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes from section 7.4.1 of RFC 6455.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	// CloseNoStatus is reported when a close frame carries no code. It is never sent.
+	CloseNoStatus = 1005
+	// CloseAbnormal is reported when the connection dropped without a close frame. It is never sent.
+	CloseAbnormal          = 1006
+	CloseInvalidPayload    = 1007
+	ClosePolicyViolation   = 1008
+	CloseMessageTooBig     = 1009
+	CloseMandatoryExt      = 1010
+	CloseInternalError     = 1011
+	maxControlPayload      = 125
+	closeHandshakeDuration = time.Second
+)
+
+// ErrClosed is returned when writing to a connection after a close frame has been sent.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by ReadMessage once the connection is closing. Code and Reason are those of the close
+// frame the peer sent, or, if this side failed the connection because the peer broke the protocol, those of the
+// close frame sent to the peer.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Reason)
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others write: ReadMessage must not be called
+// concurrently with itself, but the write methods and Close may be called from any goroutine.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+	cfg    config
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	// peerClosed is closed when the peer's close frame has been read, so Close can stop waiting for it.
+	peerClosed chan struct{}
+	peerOnce   sync.Once
+	closeOnce  sync.Once
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool, cfg config) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{conn: conn, br: br, client: client, cfg: cfg, peerClosed: make(chan struct{})}
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetReadDeadline sets the deadline for ReadMessage. A read that times out fails the connection.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the deadline for writes.
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+// frame is a single frame as read off the wire, already unmasked.
+type frame struct {
+	fin     bool
+	rsv     byte
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+// protocolError fails the connection with the given close code.
+type protocolError struct {
+	code int
+	msg  string
+}
+
+func (e *protocolError) Error() string { return e.msg }
+
+func fail(code int, format string, args ...interface{}) error {
+	return &protocolError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// readFrame reads one frame. Data frames longer than limit are refused from the header alone, before anything
+// is allocated for them.
+func (c *Conn) readFrame(limit int64) (frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		fin:    head[0]&0x80 != 0,
+		rsv:    head[0] & 0x70,
+		opcode: head[0] & 0x0F,
+		masked: head[1]&0x80 != 0,
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return frame{}, fail(CloseProtocolError, "payload length has its most significant bit set")
+		}
+	}
+
+	if f.rsv != 0 {
+		return frame{}, fail(CloseProtocolError, "reserved bits set without a negotiated extension")
+	}
+	switch f.opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		if !f.fin {
+			return frame{}, fail(CloseProtocolError, "fragmented control frame")
+		}
+		if length > maxControlPayload {
+			return frame{}, fail(CloseProtocolError, "control frame payload of %d bytes", length)
+		}
+	default:
+		return frame{}, fail(CloseProtocolError, "reserved opcode %#x", f.opcode)
+	}
+	// Clients must mask every frame and servers must not mask any.
+	if f.masked == c.client {
+		if c.client {
+			return frame{}, fail(CloseProtocolError, "masked frame from server")
+		}
+		return frame{}, fail(CloseProtocolError, "unmasked frame from client")
+	}
+	if f.opcode <= opBinary && length > uint64(limit) {
+		return frame{}, fail(CloseMessageTooBig, "message exceeds %d bytes", c.cfg.maxMessage)
+	}
+
+	var key [4]byte
+	if f.masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return frame{}, err
+		}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	if f.masked {
+		maskBytes(key, f.payload)
+	}
+	return f, nil
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// ReadMessage returns the next data message, reassembling fragments. Pings are answered and pongs passed to the
+// pong handler along the way. When the peer closes the connection, or breaks the protocol, ReadMessage
+// completes the closing handshake and returns a *CloseError; a connection that simply drops returns a
+// *CloseError with code CloseAbnormal.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		typ     MessageType
+		message []byte
+		started bool
+	)
+	for {
+		f, err := c.readFrame(c.cfg.maxMessage - int64(len(message)))
+		if err != nil {
+			return 0, nil, c.readFailed(err)
+		}
+
+		switch f.opcode {
+		case opPing:
+			if err := c.writeControl(opPong, f.payload); err != nil && err != ErrClosed {
+				return 0, nil, c.readFailed(err)
+			}
+			continue
+		case opPong:
+			if c.cfg.onPong != nil {
+				c.cfg.onPong(f.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(f.payload)
+		case opContinuation:
+			if !started {
+				return 0, nil, c.readFailed(fail(CloseProtocolError, "continuation frame without a message to continue"))
+			}
+		default:
+			if started {
+				return 0, nil, c.readFailed(fail(CloseProtocolError, "new message started before the last one finished"))
+			}
+			started = true
+			typ = MessageType(f.opcode)
+		}
+
+		message = append(message, f.payload...)
+		if !f.fin {
+			continue
+		}
+		// A text message may only be checked once complete, since fragments can split a character.
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.readFailed(fail(CloseInvalidPayload, "text message is not valid UTF-8"))
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return typ, message, nil
+	}
+}
+
+// readFailed turns an error from reading into the error ReadMessage returns, failing the connection with a
+// close frame if the peer broke the protocol.
+func (c *Conn) readFailed(err error) error {
+	var pe *protocolError
+	if errors.As(err, &pe) {
+		c.sendClose(pe.code, pe.msg)
+		c.closeConn()
+		return &CloseError{Code: pe.code, Reason: pe.msg}
+	}
+	c.closeConn()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormal, Reason: "connection closed without a close frame"}
+	}
+	return err
+}
+
+// handleClose answers the peer's close frame, unless it is the reply to one we sent, and closes the
+// connection.
+func (c *Conn) handleClose(payload []byte) error {
+	c.peerOnce.Do(func() { close(c.peerClosed) })
+
+	code, reason := CloseNoStatus, ""
+	switch {
+	case len(payload) == 1:
+		return c.readFailed(fail(CloseProtocolError, "close frame with a one-byte payload"))
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		if !validCloseCode(code) {
+			return c.readFailed(fail(CloseProtocolError, "invalid close code %d", code))
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.readFailed(fail(CloseInvalidPayload, "close reason is not valid UTF-8"))
+		}
+		reason = string(payload[2:])
+	}
+
+	echo := code
+	if echo == CloseNoStatus {
+		echo = CloseNormal
+	}
+	c.sendClose(echo, "")
+	c.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// validCloseCode reports whether a peer may send code: one defined by the RFC or its registry that is allowed on
+// the wire, or one in the ranges kept for libraries and applications.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// WriteMessage sends a data message, split into fragments if the connection was set up with WithFragmentSize.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+
+	opcode := byte(typ)
+	size := c.cfg.fragmentSize
+	if size <= 0 {
+		size = len(data)
+	}
+	for {
+		n := len(data)
+		if n > size {
+			n = size
+		}
+		fin := n == len(data)
+		if err := c.writeFrame(fin, opcode, data[:n]); err != nil {
+			return err
+		}
+		if fin {
+			return nil
+		}
+		data = data[n:]
+		opcode = opContinuation
+	}
+}
+
+// Ping sends a ping with the given payload, which may be at most 125 bytes. The peer's pong is passed to the
+// handler set with WithPongHandler.
+func (c *Conn) Ping(payload []byte) error {
+	return c.writeControl(opPing, payload)
+}
+
+func (c *Conn) writeControl(opcode byte, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("websocket: control payload of %d bytes exceeds %d", len(payload), maxControlPayload)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	return c.writeFrame(true, opcode, payload)
+}
+
+// sendClose sends a close frame unless one has been sent already.
+func (c *Conn) sendClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	c.closeSent = true
+	// The reason must fit in a control frame along with the two-byte code, and stay valid UTF-8 when cut.
+	if len(reason) > maxControlPayload-2 {
+		n := maxControlPayload - 2
+		for n > 0 && !utf8.RuneStart(reason[n]) {
+			n--
+		}
+		reason = reason[:n]
+	}
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+	c.conn.SetWriteDeadline(time.Now().Add(closeHandshakeDuration))
+	return c.writeFrame(true, opClose, payload)
+}
+
+// writeFrame writes a single frame, masking it if this is the client side. It is called with writeMu held.
+func (c *Conn) writeFrame(fin bool, opcode byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		buf = append(buf, maskBit|127)
+		buf = append(buf, ext[:]...)
+	}
+
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// Close starts the closing handshake with the given code and reason and closes the connection once the peer
+// has answered, or after a second if it doesn't. The answer is read by ReadMessage, so a connection whose
+// messages are being read in another goroutine closes promptly; otherwise Close waits out the second.
+func (c *Conn) Close(code int, reason string) error {
+	err := c.sendClose(code, reason)
+	if err == nil {
+		select {
+		case <-c.peerClosed:
+		case <-time.After(closeHandshakeDuration):
+		}
+	}
+	c.closeConn()
+	if err == ErrClosed {
+		return nil
+	}
+	return err
+}
+
+func (c *Conn) closeConn() {
+	c.closeOnce.Do(func() { c.conn.Close() })
+}
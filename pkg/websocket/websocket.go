@@ -0,0 +1,301 @@
+// Package websocket is a minimal implementation of the WebSocket protocol, RFC 6455, using only the standard
+// library. It grows the HTTP Server and Client examples a two-way channel: the server upgrades an ordinary
+// request with Upgrade, or mounts a handler function with Handle, and the client connects with Dial.
+//
+// A Conn reads and writes whole messages. Fragmented messages are reassembled on the way in and, if asked,
+// split on the way out; pings are answered automatically; and a peer that breaks the protocol, sends invalid
+// UTF-8 or exceeds the message size limit has its connection failed with the matching close code. Extensions
+// such as compression and subprotocol negotiation are not supported.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// acceptGUID is the fixed GUID from section 1.3 of RFC 6455 that the server appends to the client's key.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned by Dial when the server doesn't complete the opening handshake.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Option configures a Conn.
+type Option func(*config)
+
+type config struct {
+	maxMessage   int64
+	fragmentSize int
+	checkOrigin  func(*http.Request) bool
+	header       http.Header
+	tlsConfig    *tls.Config
+	onPong       func([]byte)
+}
+
+// WithMaxMessageSize sets the largest message ReadMessage accepts, after reassembly. A bigger one fails the
+// connection with CloseMessageTooBig. The default is 1 MiB.
+func WithMaxMessageSize(n int64) Option {
+	return func(c *config) {
+		c.maxMessage = n
+	}
+}
+
+// WithFragmentSize makes WriteMessage split messages into frames of at most n bytes. By default every message
+// is sent as a single frame.
+func WithFragmentSize(n int) Option {
+	return func(c *config) {
+		c.fragmentSize = n
+	}
+}
+
+// WithCheckOrigin sets the function Upgrade uses to accept or refuse a request's Origin. By default only
+// requests without an Origin header, or whose Origin host matches the request's Host, are accepted, which stops
+// other web sites from opening connections with a visitor's cookies.
+func WithCheckOrigin(fn func(*http.Request) bool) Option {
+	return func(c *config) {
+		c.checkOrigin = fn
+	}
+}
+
+// WithHeader adds headers to the request Dial sends, such as Origin or Authorization.
+func WithHeader(h http.Header) Option {
+	return func(c *config) {
+		c.header = h
+	}
+}
+
+// WithTLSConfig sets the TLS configuration Dial uses for wss:// URLs, for example to trust a private
+// certificate authority. By default the system's roots are used and the server name is taken from the URL.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithPongHandler sets a function called with the payload of every pong received. ReadMessage calls it, so it
+// must not block.
+func WithPongHandler(fn func(payload []byte)) Option {
+	return func(c *config) {
+		c.onPong = fn
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{maxMessage: 1 << 20, checkOrigin: sameOrigin}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a client's Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains reports whether the comma-separated header h has a token equal to value, ignoring case.
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the server side of the opening handshake and takes over the connection. If the request
+// isn't a valid WebSocket handshake Upgrade replies with an error status itself and returns an error, so the
+// handler only has to return.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts ...Option) (*Conn, error) {
+	cfg := newConfig(opts)
+	refuse := func(status int, msg string) (*Conn, error) {
+		http.Error(w, msg, status)
+		return nil, fmt.Errorf("websocket: %s", msg)
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return refuse(http.StatusMethodNotAllowed, "handshake must use GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return refuse(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return refuse(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return refuse(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if !cfg.checkOrigin(r) {
+		return refuse(http.StatusForbidden, "origin not allowed")
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return refuse(http.StatusInternalServerError, "response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return refuse(http.StatusInternalServerError, err.Error())
+	}
+	// The server may have set deadlines for the HTTP request; they don't apply to the connection it became.
+	conn.SetDeadline(time.Time{})
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The buffered reader may already hold the client's first frames, so the Conn must keep reading from it.
+	return newConn(conn, rw.Reader, false, cfg), nil
+}
+
+// Handle returns a handler that upgrades every request and passes the connection to fn. The connection is
+// closed when fn returns, with CloseNormal if fn didn't close it already.
+func Handle(fn func(*Conn), opts ...Option) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, opts...)
+		if err != nil {
+			return
+		}
+		defer c.Close(CloseNormal, "")
+		fn(c)
+	})
+}
+
+// Dial opens a client connection to a ws:// or wss:// URL. The handshake response is returned even when it
+// fails, so the caller can see why the server refused.
+func Dial(ctx context.Context, rawURL string, opts ...Option) (*Conn, *http.Response, error) {
+	cfg := newConfig(opts)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	var d interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	}
+	switch u.Scheme {
+	case "ws":
+		d = &net.Dialer{}
+	case "wss":
+		d = &tls.Dialer{Config: cfg.tlsConfig}
+	default:
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "ws" {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The handshake is bound by ctx; the connection itself outlives it. Rather than closing the connection, the
+	// watcher interrupts a blocked read or write by moving its deadline into the past, and Dial waits for the
+	// watcher to stop before deciding the outcome, so a connection that has been returned is never touched.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	// stopWatching stops the watcher and reports whether ctx ended before it did.
+	stopWatching := func() bool {
+		close(stop)
+		return <-interrupted
+	}
+	fail := func(resp *http.Response, err error) (*Conn, *http.Response, error) {
+		// The connection's deadline can pass a moment before ctx notices its own.
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			<-ctx.Done()
+		}
+		stopWatching()
+		conn.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, resp, err
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fail(nil, err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, v := range cfg.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		return fail(nil, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fail(nil, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContains(resp.Header, "Upgrade", "websocket") ||
+		!headerContains(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return fail(resp, fmt.Errorf("%w: %s", ErrBadHandshake, resp.Status))
+	}
+	if stopWatching() {
+		conn.Close()
+		return nil, resp, ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+	return newConn(conn, br, true, cfg), resp, nil
+}
@@ -0,0 +1,460 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from section 1.3 of RFC 6455.
+	if got, want := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// echo serves a handler that sends every message back until the connection closes, then reports how
+// ReadMessage ended on errs.
+func echo(t *testing.T, opts ...Option) (*httptest.Server, chan error) {
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(Handle(func(c *Conn) {
+		for {
+			typ, msg, err := c.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := c.WriteMessage(typ, msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}, opts...))
+	t.Cleanup(srv.Close)
+	return srv, errs
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestHandshakeRefused(t *testing.T) {
+	srv, _ := echo(t)
+	valid := func() http.Header {
+		return http.Header{
+			"Connection":            {"keep-alive, Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		}
+	}
+	tests := []struct {
+		name   string
+		method string
+		edit   func(http.Header)
+		status int
+	}{
+		{"POST", http.MethodPost, func(http.Header) {}, http.StatusMethodNotAllowed},
+		{"no Upgrade", http.MethodGet, func(h http.Header) { h.Del("Upgrade") }, http.StatusBadRequest},
+		{"no Connection token", http.MethodGet, func(h http.Header) { h.Set("Connection", "keep-alive") }, http.StatusBadRequest},
+		{"old version", http.MethodGet, func(h http.Header) { h.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"short key", http.MethodGet, func(h http.Header) { h.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+		{"foreign origin", http.MethodGet, func(h http.Header) { h.Set("Origin", "https://evil.example") }, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, srv.URL, nil)
+		req.Header = valid()
+		test.edit(req.Header)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+		if test.status == http.StatusUpgradeRequired && resp.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("%s: got Sec-WebSocket-Version %q, want 13", test.name, resp.Header.Get("Sec-WebSocket-Version"))
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	srv, _ := echo(t)
+	for _, fragment := range []int{0, 1000} {
+		c, _, err := Dial(context.Background(), wsURL(srv), WithFragmentSize(fragment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The lengths either side of the 7-bit, 16-bit and 64-bit length encodings.
+		for _, n := range []int{0, 125, 126, 65535, 65536} {
+			for _, typ := range []MessageType{TextMessage, BinaryMessage} {
+				want := bytes.Repeat([]byte("a"), n)
+				if err := c.WriteMessage(typ, want); err != nil {
+					t.Fatal(err)
+				}
+				gotType, got, err := c.ReadMessage()
+				if err != nil || gotType != typ || !bytes.Equal(got, want) {
+					t.Errorf("fragment %d: got %d, %d bytes, %v, want %d, %d bytes", fragment, gotType, len(got), err, typ, n)
+				}
+			}
+		}
+		// Close waits for the server's answer, which only ReadMessage can see.
+		closed := make(chan error)
+		go func() { closed <- c.Close(CloseNormal, "") }()
+		var ce *CloseError
+		if _, _, err := c.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseNormal {
+			t.Errorf("got %v, want the server to echo close 1000", err)
+		}
+		if err := <-closed; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCloseAndPing(t *testing.T) {
+	srv, serverErr := echo(t)
+	pongs := make(chan string, 1)
+	c, _, err := Dial(context.Background(), wsURL(srv), WithPongHandler(func(p []byte) { pongs <- string(p) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				clientErr <- err
+				return
+			}
+		}
+	}()
+
+	if err := c.Ping([]byte("are you there")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-pongs; got != "are you there" {
+		t.Errorf("got pong %q", got)
+	}
+
+	start := time.Now()
+	if err := c.Close(CloseGoingAway, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= closeHandshakeDuration {
+		t.Errorf("Close took %v; it should not have waited for the timeout", d)
+	}
+	var ce *CloseError
+	if err := <-serverErr; !errors.As(err, &ce) || ce.Code != CloseGoingAway || ce.Reason != "bye" {
+		t.Errorf("server got %v, want close 1001 bye", err)
+	}
+	if err := <-clientErr; !errors.As(err, &ce) || ce.Code != CloseGoingAway {
+		t.Errorf("client got %v, want the server to echo close 1001", err)
+	}
+	if err := c.WriteMessage(TextMessage, nil); err != ErrClosed {
+		t.Errorf("got %v writing after Close, want ErrClosed", err)
+	}
+}
+
+// frameBytes encodes a frame from a client, masked unless unmasked is set.
+func frameBytes(fin bool, rsv, opcode byte, payload []byte, unmasked bool) []byte {
+	b0 := rsv | opcode
+	if fin {
+		b0 |= 0x80
+	}
+	var b []byte
+	maskBit := byte(0x80)
+	if unmasked {
+		maskBit = 0
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, b0, maskBit|byte(n))
+	case n <= 0xFFFF:
+		b = append(b, b0, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		b = append(append(b, b0, maskBit|127), ext[:]...)
+	}
+	if unmasked {
+		return append(b, payload...)
+	}
+	key := [4]byte{0x12, 0x34, 0x56, 0x78}
+	b = append(b, key[:]...)
+	start := len(b)
+	b = append(b, payload...)
+	maskBytes(key, b[start:])
+	return b
+}
+
+func text(fin bool, s string) []byte { return frameBytes(fin, 0, opText, []byte(s), false) }
+
+func cont(fin bool, s string) []byte { return frameBytes(fin, 0, opContinuation, []byte(s), false) }
+
+func closeFrame(code int, reason string) []byte {
+	p := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	return frameBytes(true, 0, opClose, append(p, reason...), false)
+}
+
+// rawDial performs the opening handshake by hand, so the test can then send frames no well-behaved client
+// would.
+func rawDial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", srv.Listener.Addr())
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("got %s with accept %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return conn, br
+}
+
+// reply is a frame read back from the server, with a close frame's code split out of its payload.
+type reply struct {
+	opcode  byte
+	code    int
+	payload string
+}
+
+// readReplies reads frames until the server closes the TCP connection.
+func readReplies(br *bufio.Reader) ([]reply, error) {
+	var replies []reply
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(br, head[:]); err == io.EOF {
+			return replies, nil
+		} else if err != nil {
+			return replies, err
+		}
+		if head[1]&0x80 != 0 {
+			return replies, errors.New("server sent a masked frame")
+		}
+		n := uint64(head[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			io.ReadFull(br, ext[:])
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			io.ReadFull(br, ext[:])
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return replies, err
+		}
+		r := reply{opcode: head[0] & 0x0F, payload: string(payload)}
+		if r.opcode == opClose && len(payload) >= 2 {
+			r.code = int(binary.BigEndian.Uint16(payload))
+			r.payload = ""
+		}
+		replies = append(replies, r)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	closed := func(code int) reply { return reply{opcode: opClose, code: code} }
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   []reply
+	}{
+		{
+			"fragments with an interleaved ping",
+			[][]byte{text(false, "Hel"), frameBytes(true, 0, opPing, []byte("p"), false), cont(true, "lo"), closeFrame(1000, "")},
+			[]reply{{opcode: opPong, payload: "p"}, {opcode: opText, payload: "Hello"}, closed(1000)},
+		},
+		{
+			"UTF-8 split across fragments",
+			[][]byte{text(false, "caf\xc3"), cont(true, "\xa9"), closeFrame(1000, "")},
+			[]reply{{opcode: opText, payload: "café"}, closed(1000)},
+		},
+		{
+			"empty fragments",
+			[][]byte{frameBytes(false, 0, opBinary, nil, false), cont(false, ""), cont(true, ""), closeFrame(1000, "")},
+			[]reply{{opcode: opBinary}, closed(1000)},
+		},
+		{
+			"unsolicited pong",
+			[][]byte{frameBytes(true, 0, opPong, []byte("x"), false), closeFrame(3000, "app")},
+			[]reply{closed(3000)},
+		},
+		{
+			"close without a code",
+			[][]byte{frameBytes(true, 0, opClose, nil, false)},
+			[]reply{closed(1000)},
+		},
+		{"unmasked frame", [][]byte{frameBytes(true, 0, opText, []byte("hi"), true)}, []reply{closed(1002)}},
+		{"reserved bit", [][]byte{frameBytes(true, 0x40, opText, []byte("hi"), false)}, []reply{closed(1002)}},
+		{"reserved opcode", [][]byte{frameBytes(true, 0, 0x3, nil, false)}, []reply{closed(1002)}},
+		{"reserved control opcode", [][]byte{frameBytes(true, 0, 0xB, nil, false)}, []reply{closed(1002)}},
+		{"fragmented ping", [][]byte{frameBytes(false, 0, opPing, nil, false)}, []reply{closed(1002)}},
+		{"ping over 125 bytes", [][]byte{frameBytes(true, 0, opPing, make([]byte, 126), false)}, []reply{closed(1002)}},
+		{"continuation without a message", [][]byte{cont(true, "x")}, []reply{closed(1002)}},
+		{"new message mid-fragment", [][]byte{text(false, "a"), text(true, "b")}, []reply{closed(1002)}},
+		{
+			"64-bit length with the top bit set",
+			[][]byte{{0x81, 0xFF, 0x80, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}},
+			[]reply{closed(1002)},
+		},
+		{"invalid UTF-8", [][]byte{text(true, "\xff\xfe")}, []reply{closed(1007)}},
+		{"truncated UTF-8", [][]byte{text(false, "caf\xc3"), cont(true, "")}, []reply{closed(1007)}},
+		{"message too big", [][]byte{text(true, strings.Repeat("a", 65))}, []reply{closed(1009)}},
+		{"fragments too big together", [][]byte{text(false, strings.Repeat("a", 40)), cont(true, strings.Repeat("a", 40))}, []reply{closed(1009)}},
+		{"one-byte close payload", [][]byte{frameBytes(true, 0, opClose, []byte{3}, false)}, []reply{closed(1002)}},
+		{"close code 1005", [][]byte{closeFrame(1005, "")}, []reply{closed(1002)}},
+		{"close code 999", [][]byte{closeFrame(999, "")}, []reply{closed(1002)}},
+		{"close code 5000", [][]byte{closeFrame(5000, "")}, []reply{closed(1002)}},
+		{"invalid UTF-8 close reason", [][]byte{closeFrame(1000, "\xff")}, []reply{closed(1007)}},
+	}
+	srv, _ := echo(t, WithMaxMessageSize(64))
+	for _, test := range tests {
+		conn, br := rawDial(t, srv)
+		for _, f := range test.frames {
+			if _, err := conn.Write(f); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		got, err := readReplies(br)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClientRefusesMaskedFrame(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(r.Header.Get("Sec-WebSocket-Key")))
+		conn.Write(text(true, "masked"))
+		io.Copy(io.Discard, conn)
+	}))
+	defer srv.Close()
+
+	c, _, err := Dial(context.Background(), wsURL(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce *CloseError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseProtocolError {
+		t.Errorf("got %v, want close 1002", err)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, resp, err := Dial(context.Background(), wsURL(srv))
+	if !errors.Is(err, ErrBadHandshake) || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, want ErrBadHandshake with the 404 response", err)
+	}
+}
+
+func TestCloseReasonTrimmed(t *testing.T) {
+	// 62 two-byte runes don't fit in the 123 bytes left for the reason; the cut must not split the last one.
+	reason := strings.Repeat("é", 62)
+	srv := httptest.NewServer(Handle(func(c *Conn) {
+		c.Close(CloseGoingAway, reason)
+	}))
+	defer srv.Close()
+
+	c, _, err := Dial(context.Background(), wsURL(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce *CloseError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseGoingAway {
+		t.Fatalf("got %v, want close 1001", err)
+	}
+	if want := strings.Repeat("é", 61); ce.Reason != want {
+		t.Errorf("got reason of %d bytes, want %d", len(ce.Reason), len(want))
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(Handle(func(c *Conn) {
+		typ, msg, err := c.ReadMessage()
+		if err == nil {
+			c.WriteMessage(typ, msg)
+		}
+	}))
+	// The first Dial is expected to fail the TLS handshake; the server needn't log it.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	url := "wss" + strings.TrimPrefix(srv.URL, "https")
+	if _, _, err := Dial(context.Background(), url); err == nil {
+		t.Error("got no error for the test server's certificate without its roots")
+	}
+	cfg := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	c, _, err := Dial(context.Background(), url, WithTLSConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(CloseNormal, "")
+	if err := c.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "hello" {
+		t.Errorf("got %q, %v, want hello", got, err)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	// The connection outlives the context that bounded its handshake.
+	srv, _ := echo(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	c, _, err := Dial(ctx, wsURL(srv))
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := c.WriteMessage(TextMessage, []byte("still open")); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "still open" {
+		t.Errorf("after cancel: got %q, %v", got, err)
+	}
+	c.Close(CloseNormal, "")
+
+	// A server that never answers the handshake is given up on when the context ends.
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer stalled.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := Dial(ctx, wsURL(stalled)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
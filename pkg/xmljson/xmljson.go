@@ -0,0 +1,714 @@
+// Package xmljson converts XML documents to JSON values and back. The XML example maps XML onto structs
+// declared for it; this package is for documents with no such structs, to be queried, diffed or stored as JSON.
+//
+// An element becomes a JSON object with these members:
+//
+//   - each attribute as "@name": "value", namespace declarations included, as in "@xmlns:g": "urn:garden";
+//   - its text as "#text": "...";
+//   - each child element under its name, with an array when the name repeats.
+//
+// An element with no attributes and no child elements becomes just its text, a string, "" when it is empty.
+// A document becomes an object with one member, its root element. So
+//
+//	<plant id="27"><name>Coffee</name><origin>Ethiopia</origin><origin>Brazil</origin></plant>
+//
+// becomes
+//
+//	{"plant": {"@id": "27", "name": "Coffee", "origin": ["Ethiopia", "Brazil"]}}
+//
+// Names are written as they are in the document, with their namespace prefixes, and since the declarations of
+// those prefixes are kept as attributes, converting back gives the same namespaces. Values are always strings:
+// XML has no numbers or booleans, and guessing would turn a ZIP code such as 01234 into 1234.
+//
+// This compact form is what most JSON consumers want, but it doesn't keep everything. The order of children
+// with different names is lost, as are comments and processing instructions, text between child elements is
+// joined and stripped of surrounding white space, and a name that sometimes repeats is sometimes an array.
+// WithArrays fixes the last; WithOrder keeps the rest too, for documents such as XHTML where it matters:
+// an element's content then becomes an array of nodes in document order under "#content".
+//
+// FromJSON converts either form back to XML. Converting a document to JSON and back gives the same document
+// up to what XML itself doesn't distinguish, such as the order of attributes, the quotes around them, and
+// whether text was written with CDATA sections or with escapes.
+package xmljson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalid is returned by FromJSON for a value that can't be written as XML, such as an element name with
+// a space in it. The error returned wraps it with the path to the value.
+var ErrInvalid = errors.New("xmljson: not representable as XML")
+
+const (
+	// ContentKey is the member that holds an element's content in the ordered form.
+	ContentKey = "#content"
+	// CommentKey, DirectiveKey and ProcInstPrefix name the members of the objects that stand for comments,
+	// directives such as <!DOCTYPE ...>, and processing instructions such as <?xml-stylesheet ...?>, in the
+	// ordered form's content arrays. A processing instruction's target follows the prefix:
+	// {"?xml-stylesheet": "href=\"style.css\""}.
+	CommentKey     = "#comment"
+	DirectiveKey   = "#directive"
+	ProcInstPrefix = "?"
+)
+
+// Option configures a conversion.
+type Option func(*config)
+
+type config struct {
+	attrPrefix string
+	textKey    string
+	arrays     map[string]bool
+	order      bool
+	localNames bool
+	indent     string
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{attrPrefix: "@", textKey: "#text", arrays: map[string]bool{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithAttrPrefix sets the prefix that marks attributes among an object's members. The default is "@". It must
+// not be something an element name can start with.
+func WithAttrPrefix(prefix string) Option {
+	return func(c *config) {
+		c.attrPrefix = prefix
+	}
+}
+
+// WithTextKey sets the member that holds an element's text in the compact form. The default is "#text".
+func WithTextKey(key string) Option {
+	return func(c *config) {
+		c.textKey = key
+	}
+}
+
+// WithArrays makes the children with the given names arrays in the compact form even when there is only one,
+// so documents with one and several of them have the same shape.
+func WithArrays(names ...string) Option {
+	return func(c *config) {
+		for _, name := range names {
+			c.arrays[name] = true
+		}
+	}
+}
+
+// WithOrder converts to the ordered form, which keeps the order of an element's content, text exactly as
+// written, comments and processing instructions. An element's content is an array of nodes under "#content":
+// strings for text, and for everything else objects with one member, such as {"name": "Coffee"} for an
+// element or {"#comment": " text "}. An element with no attributes whose content is just text is still a
+// string. A document is the array of nodes at its top level.
+func WithOrder() Option {
+	return func(c *config) {
+		c.order = true
+	}
+}
+
+// WithLocalNames drops namespace prefixes and declarations, so <g:plant xmlns:g="urn:garden"> becomes
+// "plant". Which namespace a name was in is lost, so this suits documents where names don't clash.
+func WithLocalNames() Option {
+	return func(c *config) {
+		c.localNames = true
+	}
+}
+
+// WithIndent makes FromJSON put each child element of an element without text on a line of its own,
+// indented by indent for each level of nesting. Elements with text are left alone, since white space there
+// would change it.
+func WithIndent(indent string) Option {
+	return func(c *config) {
+		c.indent = indent
+	}
+}
+
+// ToJSON reads an XML document and converts it to a JSON value: a map[string]interface{} with the root
+// element in the compact form, or a []interface{} of the document's top-level nodes in the ordered form.
+func ToJSON(r io.Reader, opts ...Option) (interface{}, error) {
+	c := &converter{cfg: newConfig(opts)}
+	d := xml.NewDecoder(r)
+	var (
+		nodes []interface{}
+		root  map[string]interface{}
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("xmljson: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root != nil {
+				return nil, fmt.Errorf("xmljson: more than one root element at offset %d", d.InputOffset())
+			}
+			name, v, err := c.element(d, tok)
+			if err != nil {
+				return nil, err
+			}
+			root = map[string]interface{}{name: v}
+			nodes = append(nodes, root)
+		case xml.CharData:
+			if len(strings.TrimSpace(string(tok))) > 0 {
+				return nil, fmt.Errorf("xmljson: text outside the root element at offset %d", d.InputOffset())
+			}
+		default:
+			nodes = append(nodes, node(tok))
+		}
+	}
+	if root == nil {
+		return nil, errors.New("xmljson: no root element")
+	}
+	if c.cfg.order {
+		return nodes, nil
+	}
+	return root, nil
+}
+
+// Element is a single element converted to JSON. It implements xml.Unmarshaler, so it can be decoded from the
+// middle of a document, as with xml.Decoder.DecodeElement or an xmlstream.Reader, and it encodes to JSON as
+// an object with one member, as ToJSON writes the root element:
+//
+//	var e xmljson.Element
+//	for r.Next(&e) == nil {
+//		out, _ := json.Marshal(e) // {"plant": {...}}
+//	}
+//
+// The namespace declarations of the element's ancestors are out of its reach, so an element that uses a
+// prefix declared on one of them gets a declaration of its own.
+type Element struct {
+	// Options configure the conversion. Set them before decoding.
+	Options []Option
+	Name    string
+	Value   interface{}
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (e *Element) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	c := &converter{cfg: newConfig(e.Options)}
+	name, v, err := c.element(d, start)
+	if err != nil {
+		return err
+	}
+	e.Name, e.Value = name, v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e Element) MarshalJSON() ([]byte, error) {
+	// Escaping <, > and & is left to the encoder that called this, which knows whether it should.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]interface{}{e.Name: e.Value}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+type converter struct {
+	cfg config
+	// scope lists the namespace declarations of the elements being converted, outermost first.
+	scope []binding
+	// generated counts the namespace prefixes made up for attributes.
+	generated int
+}
+
+type binding struct {
+	prefix, url string
+}
+
+const xmlURL = "http://www.w3.org/XML/1998/namespace"
+
+// element converts the element that starts with start, reading the rest of it from d, and returns its name
+// and value.
+func (c *converter) element(d *xml.Decoder, start xml.StartElement) (string, interface{}, error) {
+	defer func(n int) { c.scope = c.scope[:n] }(len(c.scope))
+	for _, a := range start.Attr {
+		switch {
+		case a.Name.Space == "xmlns":
+			c.scope = append(c.scope, binding{a.Name.Local, a.Value})
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			c.scope = append(c.scope, binding{"", a.Value})
+		}
+	}
+
+	attrs := map[string]interface{}{}
+	name := c.qname(start.Name, true, attrs)
+	for _, a := range start.Attr {
+		if c.cfg.localNames && (a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		key := c.cfg.attrPrefix + c.qname(a.Name, false, attrs)
+		if _, ok := attrs[key]; ok {
+			// encoding/xml doesn't check this, and only one of the values could be kept.
+			return "", nil, fmt.Errorf("xmljson: duplicate attribute %s at offset %d", key, d.InputOffset())
+		}
+		attrs[key] = a.Value
+	}
+
+	var content []interface{}
+	var text strings.Builder
+	children := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", nil, fmt.Errorf("xmljson: %w", err)
+		}
+		if t, ok := tok.(xml.CharData); ok {
+			text.Write(t)
+			continue
+		}
+		if text.Len() > 0 {
+			content = append(content, text.String())
+			text.Reset()
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			if c.cfg.order {
+				return name, c.ordered(attrs, content), nil
+			}
+			return name, c.compact(attrs, content, children), nil
+		case xml.StartElement:
+			childName, v, err := c.element(d, tok)
+			if err != nil {
+				return "", nil, err
+			}
+			content = append(content, map[string]interface{}{childName: v})
+			children++
+		default:
+			content = append(content, node(tok))
+		}
+	}
+}
+
+// qname returns the name as it was written in the document. Where the prefix of a namespace can't be found,
+// because the element was decoded on its own, it declares one in attrs.
+func (c *converter) qname(n xml.Name, element bool, attrs map[string]interface{}) string {
+	switch {
+	case c.cfg.localNames || n.Space == "":
+		return n.Local
+	case n.Space == "xmlns":
+		return "xmlns:" + n.Local
+	case n.Space == xmlURL:
+		return "xml:" + n.Local
+	}
+	if prefix, ok := c.prefix(n.Space, element); ok && prefix == "" {
+		return n.Local
+	} else if ok {
+		return prefix + ":" + n.Local
+	}
+	if !strings.ContainsAny(n.Space, ":/") {
+		// The decoder leaves a prefix it has no declaration for as it is.
+		return n.Space + ":" + n.Local
+	}
+	if element {
+		attrs[c.cfg.attrPrefix+"xmlns"] = n.Space
+		c.scope = append(c.scope, binding{"", n.Space})
+		return n.Local
+	}
+	for {
+		c.generated++
+		prefix := "ns" + strconv.Itoa(c.generated)
+		if _, ok := c.url(prefix); !ok {
+			attrs[c.cfg.attrPrefix+"xmlns:"+prefix] = n.Space
+			c.scope = append(c.scope, binding{prefix, n.Space})
+			return prefix + ":" + n.Local
+		}
+	}
+}
+
+// prefix returns the innermost prefix in scope for the namespace url. Only elements use the default
+// namespace, which has the prefix "".
+func (c *converter) prefix(url string, element bool) (string, bool) {
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		b := c.scope[i]
+		if b.url != url || b.prefix == "" && !element {
+			continue
+		}
+		if u, _ := c.url(b.prefix); u == url {
+			return b.prefix, true
+		}
+	}
+	return "", false
+}
+
+// url returns the namespace that prefix stands for.
+func (c *converter) url(prefix string) (string, bool) {
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if c.scope[i].prefix == prefix {
+			return c.scope[i].url, true
+		}
+	}
+	return "", false
+}
+
+func (c *converter) compact(attrs map[string]interface{}, content []interface{}, children int) interface{} {
+	if children == 0 {
+		var text strings.Builder
+		for _, n := range content {
+			if s, ok := n.(string); ok {
+				text.WriteString(s)
+			}
+		}
+		if len(attrs) == 0 {
+			return text.String()
+		}
+		if text.Len() > 0 {
+			attrs[c.cfg.textKey] = text.String()
+		}
+		return attrs
+	}
+
+	var texts []string
+	for _, n := range content {
+		switch n := n.(type) {
+		case string:
+			if s := strings.TrimSpace(n); s != "" {
+				texts = append(texts, s)
+			}
+		case map[string]interface{}:
+			for name, v := range n {
+				if name == CommentKey || name == DirectiveKey || strings.HasPrefix(name, ProcInstPrefix) {
+					continue
+				}
+				switch prev := attrs[name].(type) {
+				case nil:
+					if c.cfg.arrays[name] {
+						attrs[name] = []interface{}{v}
+					} else {
+						attrs[name] = v
+					}
+				case []interface{}:
+					attrs[name] = append(prev, v)
+				default:
+					attrs[name] = []interface{}{prev, v}
+				}
+			}
+		}
+	}
+	if len(texts) > 0 {
+		attrs[c.cfg.textKey] = strings.Join(texts, " ")
+	}
+	return attrs
+}
+
+func (c *converter) ordered(attrs map[string]interface{}, content []interface{}) interface{} {
+	if len(attrs) == 0 {
+		if len(content) == 0 {
+			return ""
+		}
+		if s, ok := content[0].(string); ok && len(content) == 1 {
+			return s
+		}
+	}
+	if len(content) > 0 {
+		attrs[ContentKey] = content
+	}
+	return attrs
+}
+
+// node converts a comment, directive or processing instruction.
+func node(tok xml.Token) map[string]interface{} {
+	switch tok := tok.(type) {
+	case xml.Comment:
+		return map[string]interface{}{CommentKey: string(tok)}
+	case xml.Directive:
+		return map[string]interface{}{DirectiveKey: string(tok)}
+	case xml.ProcInst:
+		return map[string]interface{}{ProcInstPrefix + tok.Target: string(tok.Inst)}
+	}
+	return nil
+}
+
+// FromJSON writes the XML for a JSON value in either of the forms ToJSON produces: an object with one member,
+// the root element, or an array of top-level nodes. It also accepts an Element. Numbers and booleans become
+// their JSON text, and null an empty element.
+func FromJSON(w io.Writer, v interface{}, opts ...Option) error {
+	e := &encoder{cfg: newConfig(opts), w: bufio.NewWriter(w)}
+	var err error
+	switch v := v.(type) {
+	case Element:
+		err = e.element(v.Name, v.Value, 0)
+	case *Element:
+		err = e.element(v.Name, v.Value, 0)
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return fmt.Errorf("%w: a document has one root element, not %d", ErrInvalid, len(v))
+		}
+		for name, value := range v {
+			err = e.element(name, value, 0)
+		}
+	case []interface{}:
+		for i, n := range v {
+			if s, ok := n.(string); ok && strings.TrimSpace(s) != "" {
+				return invalid(strconv.Itoa(i), "text outside the root element")
+			}
+			if i > 0 {
+				e.w.WriteByte('\n')
+			}
+			if err = e.node(n, strconv.Itoa(i), 0); err != nil {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("%w: a document is an object or an array, not %T", ErrInvalid, v)
+	}
+	if err != nil {
+		return err
+	}
+	e.w.WriteByte('\n')
+	return e.w.Flush()
+}
+
+type encoder struct {
+	cfg config
+	w   *bufio.Writer
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func invalid(path, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalid, path, fmt.Sprintf(format, args...))
+}
+
+// node writes one node of an ordered content array.
+func (e *encoder) node(n interface{}, path string, depth int) error {
+	switch n := n.(type) {
+	case string:
+		return e.text(n, path)
+	case map[string]interface{}:
+		if len(n) != 1 {
+			return invalid(path, "a node is an object with one member, not %d", len(n))
+		}
+		for name, v := range n {
+			s, ok := v.(string)
+			switch {
+			case name == CommentKey:
+				if !ok || strings.Contains(s, "--") || strings.HasSuffix(s, "-") || !validText(s) {
+					return invalid(path, "invalid comment %v", v)
+				}
+				e.w.WriteString("<!--" + s + "-->")
+			case name == DirectiveKey:
+				if !ok || !validText(s) {
+					return invalid(path, "invalid directive %v", v)
+				}
+				e.w.WriteString("<!" + s + ">")
+			case strings.HasPrefix(name, ProcInstPrefix):
+				target := strings.TrimPrefix(name, ProcInstPrefix)
+				if !ok || !validName(target) || strings.Contains(s, "?>") || !validText(s) {
+					return invalid(path, "invalid processing instruction %s %v", target, v)
+				}
+				e.w.WriteString("<?" + target)
+				if s != "" {
+					e.w.WriteString(" " + s)
+				}
+				e.w.WriteString("?>")
+			default:
+				return e.element(name, v, depth)
+			}
+		}
+		return nil
+	}
+	return invalid(path, "a node is a string or an object, not %s", describe(n))
+}
+
+func (e *encoder) text(s, path string) error {
+	if !validText(s) {
+		return invalid(path, "text has characters XML doesn't allow")
+	}
+	textEscaper.WriteString(e.w, s)
+	return nil
+}
+
+func (e *encoder) element(name string, v interface{}, depth int) error {
+	if !validName(name) {
+		return invalid(name, "invalid element name")
+	}
+	switch v := v.(type) {
+	case nil:
+		e.w.WriteString("<" + name + "/>")
+		return nil
+	case map[string]interface{}:
+		return e.object(name, v, depth)
+	case []interface{}:
+		return invalid(name, "an array can only hold repeated child elements")
+	}
+	s, err := scalar(v)
+	if err != nil {
+		return invalid(name, "%v", err)
+	}
+	if s == "" {
+		e.w.WriteString("<" + name + "/>")
+		return nil
+	}
+	e.w.WriteString("<" + name + ">")
+	if err := e.text(s, name); err != nil {
+		return err
+	}
+	e.w.WriteString("</" + name + ">")
+	return nil
+}
+
+func (e *encoder) object(name string, obj map[string]interface{}, depth int) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.w.WriteString("<" + name)
+	var children []string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, e.cfg.attrPrefix) || k == e.cfg.textKey || k == ContentKey {
+			children = append(children, k)
+			continue
+		}
+		attr := strings.TrimPrefix(k, e.cfg.attrPrefix)
+		s, err := scalar(obj[k])
+		if err != nil {
+			return invalid(name+"/"+k, "%v", err)
+		}
+		if !validName(attr) || !validText(s) {
+			return invalid(name+"/"+k, "invalid attribute")
+		}
+		e.w.WriteString(" " + attr + `="`)
+		attrEscaper.WriteString(e.w, s)
+		e.w.WriteString(`"`)
+	}
+	if len(children) == 0 {
+		e.w.WriteString("/>")
+		return nil
+	}
+	e.w.WriteString(">")
+
+	if content, ok := obj[ContentKey]; ok {
+		nodes, ok := content.([]interface{})
+		if !ok || len(children) > 1 {
+			return invalid(name, "%s is an array and the only member besides attributes", ContentKey)
+		}
+		for i, n := range nodes {
+			if err := e.node(n, name+"/"+ContentKey+"/"+strconv.Itoa(i), depth+1); err != nil {
+				return err
+			}
+		}
+		e.w.WriteString("</" + name + ">")
+		return nil
+	}
+
+	_, hasText := obj[e.cfg.textKey]
+	indent := e.cfg.indent != "" && !hasText
+	for _, k := range children {
+		if k == e.cfg.textKey {
+			s, err := scalar(obj[k])
+			if err != nil {
+				return invalid(name+"/"+k, "%v", err)
+			}
+			if err := e.text(s, name+"/"+k); err != nil {
+				return err
+			}
+			continue
+		}
+		items, ok := obj[k].([]interface{})
+		if !ok {
+			items = []interface{}{obj[k]}
+		}
+		for _, item := range items {
+			if indent {
+				e.newline(depth + 1)
+			}
+			if err := e.element(k, item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if indent {
+		e.newline(depth)
+	}
+	e.w.WriteString("</" + name + ">")
+	return nil
+}
+
+func (e *encoder) newline(depth int) {
+	e.w.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.w.WriteString(e.cfg.indent)
+	}
+}
+
+// scalar returns the text for a string, number or boolean.
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64, bool:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return "", fmt.Errorf("want a string, number or boolean, not %s", describe(v))
+}
+
+func describe(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validName reports whether s is an XML name. It accepts the common letters, digits and punctuation rather
+// than the exact character classes of the specification.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.' || unicode.Is(unicode.Mn, r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validText reports whether s is UTF-8 and every character of it may appear in an XML document.
+func validText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package xmljson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/keithwegner/go-by-example/pkg/xmlstream"
+)
+
+func encode(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		xml  string
+		opts []Option
+		want string
+	}{
+		{`<plant/>`, nil, `{"plant":""}`},
+		{`<plant>Coffee</plant>`, nil, `{"plant":"Coffee"}`},
+		{`<plant id="27">Coffee</plant>`, nil, `{"plant":{"#text":"Coffee","@id":"27"}}`},
+		{
+			`<plant id="27"><name>Coffee</name><origin>Ethiopia</origin><origin>Brazil</origin></plant>`, nil,
+			`{"plant":{"@id":"27","name":"Coffee","origin":["Ethiopia","Brazil"]}}`,
+		},
+		{
+			"<plant>\n  <name> Coffee </name>\n  <!-- dropped -->\n  <origin>Ethiopia</origin>\n</plant>", nil,
+			`{"plant":{"name":" Coffee ","origin":"Ethiopia"}}`,
+		},
+		{
+			`<plant><name>Coffee</name><origin>Ethiopia</origin></plant>`, []Option{WithArrays("origin")},
+			`{"plant":{"name":"Coffee","origin":["Ethiopia"]}}`,
+		},
+		{`<p>Hello <b>big</b> world</p>`, nil, `{"p":{"#text":"Hello world","b":"big"}}`},
+		{`<p a="1">x</p>`, []Option{WithAttrPrefix("-"), WithTextKey("_")}, `{"p":{"-a":"1","_":"x"}}`},
+		{`<a>&lt;&amp;<![CDATA[<b>]]></a>`, nil, `{"a":"<&<b>"}`},
+		{
+			`<g:plant xmlns:g="urn:garden" xmlns="urn:default" xml:lang="en"><name g:kind="x"/></g:plant>`, nil,
+			`{"g:plant":{"@xml:lang":"en","@xmlns":"urn:default","@xmlns:g":"urn:garden","name":{"@g:kind":"x"}}}`,
+		},
+		{
+			`<g:plant xmlns:g="urn:garden" xmlns="urn:default"><name g:kind="x"/></g:plant>`, []Option{WithLocalNames()},
+			`{"plant":{"name":{"@kind":"x"}}}`,
+		},
+		{
+			`<a xmlns:p="urn:one"><b xmlns:p="urn:two"><p:c/></b><p:c/></a>`, nil,
+			`{"a":{"@xmlns:p":"urn:one","b":{"@xmlns:p":"urn:two","p:c":""},"p:c":""}}`,
+		},
+		{
+			"<?xml version=\"1.0\"?>\n<!-- top -->\n<p id=\"1\">Hello <b>big</b> world<!--c--></p>", []Option{WithOrder()},
+			`[{"?xml":"version=\"1.0\""},{"#comment":" top "},{"p":{"#content":["Hello ",{"b":"big"}," world",{"#comment":"c"}],"@id":"1"}}]`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ToJSON(strings.NewReader(tt.xml), tt.opts...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.xml, err)
+		} else if encode(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.xml, encode(got), tt.want)
+		}
+	}
+
+	for _, bad := range []string{``, `<a>`, `<a></b>`, `<a/><b/>`, `text<a/>`, `<a x="1" x="2"/>`} {
+		if got, err := ToJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: got %s, want an error", bad, encode(got))
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		opts []Option
+		want string
+	}{
+		{`{"plant":""}`, nil, `<plant/>`},
+		{`{"plant":null}`, nil, `<plant/>`},
+		{`{"page":1.5}`, nil, `<page>1.5</page>`},
+		{`{"plant":{"@id":27,"name":"Coffee","origin":["Ethiopia","Brazil"]}}`, nil,
+			`<plant id="27"><name>Coffee</name><origin>Ethiopia</origin><origin>Brazil</origin></plant>`},
+		{`{"plant":{"@id":"27","name":"Coffee","origin":["Ethiopia","Brazil"]}}`, []Option{WithIndent("  ")},
+			"<plant id=\"27\">\n  <name>Coffee</name>\n  <origin>Ethiopia</origin>\n  <origin>Brazil</origin>\n</plant>"},
+		{`{"a":{"@t":"\"<&>\"\n","#text":"<&>\"\r"}}`, nil, `<a t="&quot;&lt;&amp;&gt;&quot;&#xA;">&lt;&amp;&gt;"&#xD;</a>`},
+		{`[{"?xml":"version=\"1.0\""},{"#directive":"DOCTYPE p"},{"p":{"#content":["a ",{"#comment":"c"},{"b":""}]}}]`, nil,
+			"<?xml version=\"1.0\"?>\n<!DOCTYPE p>\n<p>a <!--c--><b/></p>"},
+	}
+	for _, tt := range tests {
+		var v interface{}
+		if err := json.Unmarshal([]byte(tt.json), &v); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := FromJSON(&buf, v, tt.opts...); err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+		} else if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.json, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{}`, `{"a":1,"b":2}`, `"text"`, `{"a b":""}`, `{"a":[[1]]}`, `{"a":{"@b":{}}}`, `{"a":{"@1":""}}`,
+		`{"a":"\u0001"}`, `{"a":{"#content":"x"}}`, `{"a":{"#content":[],"b":""}}`, `[{"#comment":"a--b"}]`,
+		`["text",{"a":""}]`, `[{"a":"","b":""}]`,
+	} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(bad), &v); err != nil {
+			t.Fatal(err)
+		}
+		if err := FromJSON(io.Discard, v); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", bad, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	docs := []string{
+		`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE catalog>
+<!-- plants -->
+<catalog xmlns="urn:catalog" xmlns:g="urn:garden">
+  <g:plant id="27" g:kind="shrub">
+    <name>Coffee</name>
+    <origin>Ethiopia</origin>
+    <note>Grows <em>best</em> in &lt;shade&gt;, &amp; likes rain.<?pi data?></note>
+    <origin>Brazil</origin>
+  </g:plant>
+  <empty/>
+</catalog>`,
+		`<p>Tab	and
+newline &#xD; kept</p>`,
+	}
+	for _, doc := range docs {
+		v, err := ToJSON(strings.NewReader(doc), WithOrder())
+		if err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+		// Through JSON text and back, as a real conversion would go.
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(encode(v)), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := FromJSON(&buf, decoded); err != nil {
+			t.Fatalf("%s: %v", doc, err)
+		}
+		again, err := ToJSON(&buf, WithOrder())
+		if err != nil {
+			t.Fatalf("%s: converting back gave invalid XML %s: %v", doc, buf.String(), err)
+		}
+		if encode(again) != encode(v) {
+			t.Errorf("round trip changed\n%s\nto\n%s", encode(v), encode(again))
+		}
+	}
+}
+
+func TestElement(t *testing.T) {
+	const doc = `<catalog xmlns:g="urn:garden">
+  <g:plant id="27"><name>Coffee</name><origin>Ethiopia</origin></g:plant>
+  <g:plant id="81"><name>Tomato</name><origin>Mexico</origin><origin>California</origin></g:plant>
+</catalog>`
+	r := xmlstream.NewReader(strings.NewReader(doc), "plant")
+	var got []string
+	for {
+		e := Element{Options: []Option{WithArrays("origin")}}
+		err := r.Next(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, encode(e))
+	}
+	// The declaration of g is on the catalog, so each plant declares its namespace itself.
+	want := []string{
+		`{"plant":{"@id":"27","@xmlns":"urn:garden","name":"Coffee","origin":["Ethiopia"]}}`,
+		`{"plant":{"@id":"81","@xmlns":"urn:garden","name":"Tomato","origin":["Mexico","California"]}}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,154 @@
+// Package xmlstream reads repeated elements, such as the <plant>s of a large catalog, out of an XML document
+// one at a time. xml.Unmarshal in the XML example needs the whole document in memory and a type for every
+// level of it; a Reader walks the document with xml.Decoder.Token instead, skipping everything but the
+// elements it is after, so memory use depends on the size of the largest element rather than of the document.
+//
+// Each element is decoded with the usual xml struct tags, into a value that the caller provides as it would to
+// xml.Decoder.Decode. An element that can't be decoded into that value is reported with its index and byte
+// offset, and reading carries on with the next one; a document that isn't well-formed XML ends the stream.
+package xmlstream
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// ElementError reports an element that couldn't be decoded.
+type ElementError struct {
+	// Index counts matching elements from 0, including ones that failed to decode.
+	Index int
+	// Offset is the byte offset in the input where the element starts.
+	Offset int64
+	Err    error
+}
+
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("xmlstream: element %d at offset %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *ElementError) Unwrap() error {
+	return e.Err
+}
+
+// Option configures a Reader.
+type Option func(*config)
+
+type config struct {
+	space    string
+	anySpace bool
+}
+
+// WithNamespace matches only elements in the namespace with the given URL, "" being no namespace at all. By
+// default the namespace is ignored and elements match by local name alone.
+func WithNamespace(url string) Option {
+	return func(c *config) {
+		c.space = url
+		c.anySpace = false
+	}
+}
+
+// Reader reads the elements with a given name from an XML document, wherever they are nested.
+type Reader struct {
+	cfg   config
+	name  string
+	dec   *xml.Decoder
+	index int
+	err   error
+}
+
+// NewReader returns a Reader that reads the elements of r with the local name name. Matching elements nested
+// inside a matching element are decoded as part of it rather than on their own.
+func NewReader(r io.Reader, name string, opts ...Option) *Reader {
+	cfg := config{anySpace: true}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Reader{cfg: cfg, name: name, dec: xml.NewDecoder(r)}
+}
+
+// Next decodes the next matching element into v, as xml.Decoder.Decode would, and returns io.EOF when there
+// are no more. An element that can't be decoded into v is returned as an *ElementError, and calling Next again
+// moves on to the element after it. Any other error, such as the document turning out not to be well-formed,
+// is returned from then on, and Err reports it.
+func (r *Reader) Next(v interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	offset, tokens, err := r.nextElement()
+	if err != nil {
+		r.err = err
+		return err
+	}
+	eerr := &ElementError{Index: r.index, Offset: offset}
+	r.index++
+	// The element has been read whole, so decoding it from its tokens can fail without losing the place in
+	// the document.
+	if err := xml.NewTokenDecoder(&tokenReader{tokens: tokens}).Decode(v); err != nil {
+		eerr.Err = err
+		return eerr
+	}
+	return nil
+}
+
+// Err returns the error that ended the stream early, or nil if the stream is still going or reached its end.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// nextElement skips to the next matching element and returns its offset and tokens, from its start element
+// to its end element.
+func (r *Reader) nextElement() (int64, []xml.Token, error) {
+	for {
+		offset := r.dec.InputOffset()
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		} else if err != nil {
+			return 0, nil, fmt.Errorf("xmlstream: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || !r.matches(start.Name) {
+			continue
+		}
+		tokens := []xml.Token{start.Copy()}
+		for depth := 1; depth > 0; {
+			tok, err := r.dec.Token()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, nil, fmt.Errorf("xmlstream: element %d at offset %d: %w", r.index, offset, err)
+			}
+			switch tok.(type) {
+			case xml.StartElement:
+				depth++
+			case xml.EndElement:
+				depth--
+			}
+			tokens = append(tokens, xml.CopyToken(tok))
+		}
+		return offset, tokens, nil
+	}
+}
+
+func (r *Reader) matches(name xml.Name) bool {
+	return name.Local == r.name && (r.cfg.anySpace || name.Space == r.cfg.space)
+}
+
+// tokenReader replays the tokens of one element.
+type tokenReader struct {
+	tokens []xml.Token
+}
+
+func (t *tokenReader) Token() (xml.Token, error) {
+	if len(t.tokens) == 0 {
+		return nil, io.EOF
+	}
+	tok := t.tokens[0]
+	t.tokens = t.tokens[1:]
+	return tok, nil
+}
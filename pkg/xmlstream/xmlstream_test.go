@@ -0,0 +1,112 @@
+package xmlstream
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type plant struct {
+	XMLName xml.Name `xml:"plant"`
+	Id      int      `xml:"id,attr"`
+	Name    string   `xml:"name"`
+	Origin  []string `xml:"origin"`
+}
+
+const catalog = `<?xml version="1.0"?>
+<catalog xmlns:g="urn:garden">
+  <shelf>
+    <plant id="1"><name>Coffee</name><origin>Ethiopia</origin><origin>Brazil</origin></plant>
+    <plant id="x"><name>Broken</name></plant>
+  </shelf>
+  <g:plant id="2"><name>Tomato</name><origin>Mexico</origin></g:plant>
+  <note>a <plant id="3"><name>Mint</name></plant> in a note</note>
+</catalog>`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(catalog), "plant")
+	var got []string
+	for {
+		var p plant
+		err := r.Next(&p)
+		if err == io.EOF {
+			break
+		}
+		var eerr *ElementError
+		if errors.As(err, &eerr) {
+			offset := int64(strings.Index(catalog, `<plant id="x">`))
+			if eerr.Index != 1 || eerr.Offset != offset {
+				t.Errorf("got error %v, want element 1 at offset %d", err, offset)
+			}
+			got = append(got, "error")
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strconv.Itoa(p.Id)+" "+p.Name+" "+strings.Join(p.Origin, ","))
+	}
+	want := []string{"1 Coffee Ethiopia,Brazil", "error", "2 Tomato Mexico", "3 Mint "}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("Err: %v", err)
+	}
+	if err := r.Next(&plant{}); err != io.EOF {
+		t.Errorf("after the end: got %v, want io.EOF", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		space string
+		want  []int
+	}{
+		{"urn:garden", []int{2}},
+		{"", []int{1, 3}},
+	}
+	for _, tt := range tests {
+		r := NewReader(strings.NewReader(catalog), "plant", WithNamespace(tt.space))
+		var got []int
+		for {
+			var p plant
+			err := r.Next(&p)
+			if err == io.EOF {
+				break
+			} else if err == nil {
+				got = append(got, p.Id)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("namespace %q: got %v, want %v", tt.space, got, tt.want)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	tests := []string{
+		`<catalog><plant id="1"><name>Coffee</name></plant><plant id="2"><name>Tea</plant></catalog>`,
+		`<catalog><plant id="1"><name>Coffee</name></plant><plant id="2"><name>Tea</name>`,
+		`<catalog><plant id="1"><name>Coffee</name></plant><shelf></catalog>`,
+	}
+	for _, doc := range tests {
+		r := NewReader(strings.NewReader(doc), "plant")
+		var p plant
+		if err := r.Next(&p); err != nil || p.Name != "Coffee" {
+			t.Errorf("%s: got %v, %v", doc, p, err)
+			continue
+		}
+		err := r.Next(&p)
+		var eerr *ElementError
+		if err == nil || err == io.EOF || errors.As(err, &eerr) {
+			t.Errorf("%s: got %v, want a syntax error", doc, err)
+		}
+		if again := r.Next(&p); again != err || r.Err() != err {
+			t.Errorf("%s: the error didn't stick: got %v then %v", doc, err, again)
+		}
+	}
+}